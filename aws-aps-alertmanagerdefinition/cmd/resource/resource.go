@@ -0,0 +1,408 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+)
+
+const (
+	phaseWaitForAlertManagerActive  internal.Phase = "WaitForAlertManagerActive"
+	phaseWaitForAlertManagerDeleted internal.Phase = "WaitForAlertManagerDeleted"
+
+	messageCreateComplete = "Create Completed"
+	messageUpdateComplete = "Update Completed"
+	messageDeleteComplete = "Delete Complete"
+)
+
+// poller schedules the callbacks that wait for the definition to stabilize.
+var poller = internal.NewPoller(map[internal.Phase]time.Duration{
+	phaseWaitForAlertManagerActive:  15 * time.Minute,
+	phaseWaitForAlertManagerDeleted: 15 * time.Minute,
+})
+
+// newClient builds the APS client for a request. Tests replace it with a fake.
+var newClient internal.ClientFactory = internal.NewClient
+
+// resourceType names the resource in metrics.
+const resourceType = "AWS::APS::AlertManagerDefinition"
+
+// propertyPaths maps the fields of definition requests that aren't named after
+// their property, for reporting ValidationExceptions.
+var propertyPaths = internal.PropertyPaths{"workspaceId": "/properties/Workspace"}
+
+// Create handles the Create event from the Cloudformation service.
+func Create(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionCreate, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return create(req, prevModel, currentModel)
+	})
+}
+
+func create(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	// this resource was released after callback contexts were versioned, so
+	// there are no legacy contexts to read
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, nil)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionCreate)
+	if cbCtx.InPhase(phaseWaitForAlertManagerActive) {
+		currentModel.Workspace = aws.String(cbCtx.Arn)
+		return validateAlertManagerState(client, cbCtx, currentModel, messageCreateComplete)
+	}
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
+
+	workspaceID, err := validateModel(currentModel, nil)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	// a workspace has at most one definition, which may belong to the
+	// workspace resource or another stack
+	_, err = client.DescribeAlertManagerDefinition(&prometheusservice.DescribeAlertManagerDefinitionInput{
+		WorkspaceId: workspaceID,
+	})
+	if err == nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          fmt.Sprintf("AlertManagerDefinition already exists for workspace %s", aws.StringValue(workspaceID)),
+			HandlerErrorCode: cloudformation.HandlerErrorCodeAlreadyExists,
+		}, nil
+	}
+	if !internal.IsNotFound(err) {
+		return internal.NewFailedEvent(err)
+	}
+
+	_, err = client.CreateAlertManagerDefinition(&prometheusservice.CreateAlertManagerDefinitionInput{
+		Data:        []byte(internal.MarkAlertManagerDefinitionOwned(*currentModel.Data)),
+		WorkspaceId: workspaceID,
+	})
+	if err != nil {
+		return internal.NewFailedEvent(internal.WithCreateConflict(internal.WithPropertyPaths(err, propertyPaths)))
+	}
+
+	return poller.Next(nil, phaseWaitForAlertManagerActive, aws.StringValue(currentModel.Workspace), currentModel), nil
+}
+
+// Read handles the Read event from the Cloudformation service.
+func Read(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionRead, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return read(req, prevModel, currentModel)
+	})
+}
+
+func read(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	// contract test: contract_read_without_create
+	if currentModel.Workspace == nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid Read: Workspace cannot be empty",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		}, nil
+	}
+
+	if err := readAlertManagerDefinition(newClient(req, internal.ActionRead), currentModel); err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	return handler.ProgressEvent{
+		OperationStatus: handler.Success,
+		Message:         "Read Complete",
+		ResourceModel:   currentModel,
+	}, nil
+}
+
+// Update handles the Update event from the Cloudformation service.
+func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionUpdate, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return update(req, prevModel, currentModel)
+	})
+}
+
+func update(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	// contract test: contract_read_without_create
+	if currentModel.Workspace == nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid Update: Workspace cannot be empty",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		}, nil
+	}
+
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, nil)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionUpdate)
+	if cbCtx.InPhase(phaseWaitForAlertManagerActive) {
+		currentModel.Workspace = aws.String(cbCtx.Arn)
+		return validateAlertManagerState(client, cbCtx, currentModel, messageUpdateComplete)
+	}
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
+
+	workspaceID, err := validateModel(currentModel, prevModel)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	// reformatting the definition leaves it ACTIVE, so there is nothing to
+	// put or wait for
+	if !dataChanged(currentModel, prevModel) {
+		return handler.ProgressEvent{
+			OperationStatus: handler.Success,
+			Message:         messageUpdateComplete,
+			ResourceModel:   currentModel,
+		}, nil
+	}
+
+	// only a definition this resource put may be overwritten
+	owned, err := definitionOwned(client, workspaceID)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+	if !owned {
+		return notOwnedEvent(workspaceID), nil
+	}
+
+	_, err = client.PutAlertManagerDefinition(&prometheusservice.PutAlertManagerDefinitionInput{
+		Data:        []byte(internal.MarkAlertManagerDefinitionOwned(*currentModel.Data)),
+		WorkspaceId: workspaceID,
+	})
+	if err != nil {
+		return internal.NewFailedEvent(internal.WithBusyConflict(internal.WithPropertyPaths(err, propertyPaths)))
+	}
+
+	return poller.Next(nil, phaseWaitForAlertManagerActive, aws.StringValue(currentModel.Workspace), currentModel), nil
+}
+
+// Delete handles the Delete event from the Cloudformation service.
+func Delete(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionDelete, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return delete(req, prevModel, currentModel)
+	})
+}
+
+func delete(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	if currentModel.Workspace == nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid Delete: Workspace cannot be empty",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		}, nil
+	}
+
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, nil)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionDelete)
+	if cbCtx.InPhase(phaseWaitForAlertManagerDeleted) {
+		currentModel.Workspace = aws.String(cbCtx.Arn)
+		return validateAlertManagerDeleted(client, cbCtx, currentModel, messageDeleteComplete)
+	}
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
+
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Workspace)
+	if err != nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid Delete: invalid Workspace ARN format",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		}, nil
+	}
+
+	workspaceID := aws.String(workspaceARN.WorkspaceID)
+	// a definition of the workspace resource is deleted with the workspace
+	owned, err := definitionOwned(client, workspaceID)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+	if !owned {
+		return notOwnedEvent(workspaceID), nil
+	}
+
+	_, err = client.DeleteAlertManagerDefinition(&prometheusservice.DeleteAlertManagerDefinitionInput{
+		WorkspaceId: workspaceID,
+	})
+	if err != nil {
+		return internal.NewFailedEvent(internal.WithBusyConflict(err))
+	}
+
+	return poller.Next(nil, phaseWaitForAlertManagerDeleted, aws.StringValue(currentModel.Workspace), currentModel), nil
+}
+
+// List handles the List event from the Cloudformation service. A workspace
+// has at most one definition, so the list is empty or holds that one.
+func List(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionList, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return list(req, prevModel, currentModel)
+	})
+}
+
+func list(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	if currentModel == nil || currentModel.Workspace == nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid List: Workspace ARN cannot be empty",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeInvalidRequest,
+		}, nil
+	}
+	if _, err := internal.ParseWorkspaceARN(*currentModel.Workspace); err != nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid List: invalid Workspace ARN format",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeInvalidRequest,
+		}, nil
+	}
+
+	models := []interface{}{}
+	model := Model{Workspace: currentModel.Workspace}
+	err := readAlertManagerDefinition(newClient(req, internal.ActionList), &model)
+	if err == nil {
+		models = append(models, model)
+	} else if !internal.IsNotFound(err) {
+		return internal.NewFailedEvent(err)
+	}
+
+	return handler.ProgressEvent{
+		OperationStatus: handler.Success,
+		Message:         "List complete",
+		ResourceModels:  models,
+	}, nil
+}
+
+// validateModel checks the model before it is sent to APS and returns the ID
+// of its workspace. On Update Data is only checked when it differs from
+// prevModel's, so a definition that predates a check can still be updated.
+func validateModel(currentModel, prevModel *Model) (*string, error) {
+	if currentModel.Workspace == nil {
+		return nil, internal.NewValidationError("Workspace", errors.New("must be set"))
+	}
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Workspace)
+	if err != nil {
+		return nil, internal.NewValidationError("Workspace", err)
+	}
+	if !dataChanged(currentModel, prevModel) {
+		return aws.String(workspaceARN.WorkspaceID), nil
+	}
+	if strings.TrimSpace(aws.StringValue(currentModel.Data)) == "" {
+		return nil, internal.NewValidationError("Data", errors.New("must not be empty"))
+	}
+	if err := internal.ValidateAlertManagerDefinition(*currentModel.Data); err != nil {
+		return nil, internal.NewValidationError("Data", err)
+	}
+	return aws.String(workspaceARN.WorkspaceID), nil
+}
+
+// dataChanged reports whether currentModel defines a different definition
+// than prevModel, which is nil on Create.
+func dataChanged(currentModel, prevModel *Model) bool {
+	if prevModel == nil || prevModel.Data == nil || currentModel.Data == nil {
+		return true
+	}
+	return !internal.AlertManagerDefinitionsEqual(*currentModel.Data, *prevModel.Data)
+}
+
+// definitionOwned reports whether the definition of the workspace workspaceID
+// was put by an AWS::APS::AlertManagerDefinition resource. A definition of an
+// AWS::APS::Workspace, or one put outside of CloudFormation, isn't.
+func definitionOwned(client internal.APSService, workspaceID *string) (bool, error) {
+	data, err := client.DescribeAlertManagerDefinition(&prometheusservice.DescribeAlertManagerDefinitionInput{
+		WorkspaceId: workspaceID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return internal.AlertManagerDefinitionOwned(string(data.AlertManagerDefinition.Data)), nil
+}
+
+// notOwnedEvent returns the failure for changing a definition this resource
+// doesn't own.
+func notOwnedEvent(workspaceID *string) handler.ProgressEvent {
+	return handler.ProgressEvent{
+		OperationStatus:  handler.Failed,
+		Message:          fmt.Sprintf("AlertManagerDefinition of workspace %s is not managed by an AWS::APS::AlertManagerDefinition resource", aws.StringValue(workspaceID)),
+		HandlerErrorCode: cloudformation.HandlerErrorCodeResourceConflict,
+	}
+}
+
+func readAlertManagerDefinition(client internal.APSService, currentModel *Model) error {
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Workspace)
+	if err != nil {
+		return err
+	}
+
+	data, err := client.DescribeAlertManagerDefinition(&prometheusservice.DescribeAlertManagerDefinitionInput{
+		WorkspaceId: aws.String(workspaceARN.WorkspaceID),
+	})
+	if err != nil {
+		return err
+	}
+
+	setAlertManagerDefinition(currentModel, data.AlertManagerDefinition)
+	return nil
+}
+
+// setAlertManagerDefinition sets the Data of currentModel from the live
+// definition.
+func setAlertManagerDefinition(currentModel *Model, definition *prometheusservice.AlertManagerDefinitionDescription) {
+	// keep the template's form of an equivalent definition so reformatting
+	// it doesn't show up as drift
+	live := internal.UnmarkAlertManagerDefinition(string(definition.Data))
+	if currentModel.Data == nil || !internal.AlertManagerDefinitionsEqual(*currentModel.Data, live) {
+		currentModel.Data = aws.String(live)
+	}
+}
+
+func validateAlertManagerState(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Workspace)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	definition, evt, err := internal.WaitForAlertManagerDefinition(client, poller, cbCtx, phaseWaitForAlertManagerActive,
+		aws.StringValue(currentModel.Workspace), aws.String(workspaceARN.WorkspaceID), currentModel)
+	if evt != nil {
+		return *evt, err
+	}
+	setAlertManagerDefinition(currentModel, definition)
+
+	return handler.ProgressEvent{
+		ResourceModel:   currentModel,
+		OperationStatus: handler.Success,
+		Message:         successMessage,
+	}, nil
+}
+
+func validateAlertManagerDeleted(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Workspace)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	if evt, err := internal.WaitForAlertManagerDefinitionDeleted(client, poller, cbCtx, phaseWaitForAlertManagerDeleted,
+		aws.StringValue(currentModel.Workspace), aws.String(workspaceARN.WorkspaceID), currentModel); evt != nil {
+		return *evt, err
+	}
+
+	return handler.ProgressEvent{
+		OperationStatus: handler.Success,
+		Message:         successMessage,
+	}, nil
+}
@@ -0,0 +1,315 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal"
+	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal/apstest"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAlertManagerDefinition = `alertmanager_config: |
+  route:
+    receiver: default
+  receivers:
+    - name: default
+`
+
+// definitionModel returns a definition for the workspace workspaceArn.
+func definitionModel(workspaceArn *string) *Model {
+	return &Model{
+		Workspace: workspaceArn,
+		Data:      aws.String(testAlertManagerDefinition),
+	}
+}
+
+// liveData returns the definition APS stores for the workspace of model.
+func liveData(t *testing.T, client *apstest.Service, model *Model) string {
+	workspaceARN, err := internal.ParseWorkspaceARN(aws.StringValue(model.Workspace))
+	require.NoError(t, err)
+	out, err := client.DescribeAlertManagerDefinition(&prometheusservice.DescribeAlertManagerDefinitionInput{
+		WorkspaceId: aws.String(workspaceARN.WorkspaceID),
+	})
+	require.NoError(t, err)
+	return string(out.AlertManagerDefinition.Data)
+}
+
+func TestAlertManagerDefinition_lifecycle(t *testing.T) {
+	client := apstest.NewService(2)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	model := definitionModel(ws.Arn)
+	evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, messageCreateComplete, evt.Message)
+	assert.True(t, internal.AlertManagerDefinitionOwned(liveData(t, client, model)))
+
+	read := &Model{Workspace: model.Workspace}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	}).OperationStatus)
+	assert.Equal(t, testAlertManagerDefinition, aws.StringValue(read.Data))
+
+	// reformatting the definition is not a change
+	reformatted := &Model{
+		Workspace: model.Workspace,
+		Data:      aws.String("alertmanager_config: \"route: {receiver: default}\\nreceivers: [{name: default}]\"\n"),
+	}
+	require.Equal(t, handler.Success, apstest.Run(t, reformatted, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, reformatted)
+	}).OperationStatus)
+	assert.Zero(t, client.Calls("PutAlertManagerDefinition"))
+
+	updated := &Model{
+		Workspace: model.Workspace,
+		Data:      aws.String(strings.ReplaceAll(testAlertManagerDefinition, "default", "renamed")),
+	}
+	evt = apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, reformatted, updated)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, messageUpdateComplete, evt.Message)
+	assert.Equal(t, 1, client.Calls("PutAlertManagerDefinition"))
+	assert.True(t, internal.AlertManagerDefinitionOwned(liveData(t, client, model)))
+
+	read = &Model{Workspace: model.Workspace}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	}).OperationStatus)
+	assert.Equal(t, updated.Data, read.Data)
+
+	deleted := &Model{Workspace: model.Workspace}
+	evt = apstest.Run(t, deleted, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Delete(req, nil, deleted)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, messageDeleteComplete, evt.Message)
+
+	read = &Model{Workspace: model.Workspace}
+	evt = apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, evt.HandlerErrorCode)
+
+	deleted = &Model{Workspace: model.Workspace}
+	evt = apstest.Run(t, deleted, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Delete(req, nil, deleted)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, evt.HandlerErrorCode)
+}
+
+func TestCreate_alreadyExists(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	model := definitionModel(ws.Arn)
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	}).OperationStatus)
+
+	duplicate := &Model{Workspace: model.Workspace, Data: model.Data}
+	evt := apstest.Run(t, duplicate, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, duplicate)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeAlreadyExists, evt.HandlerErrorCode)
+	assert.Equal(t, 1, client.Calls("CreateAlertManagerDefinition"))
+}
+
+func TestHandlers_notOwned(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	// a definition of the workspace resource carries no ownership marker
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	_, err = client.CreateAlertManagerDefinition(&prometheusservice.CreateAlertManagerDefinitionInput{
+		Data:        []byte(testAlertManagerDefinition),
+		WorkspaceId: ws.WorkspaceId,
+	})
+	require.NoError(t, err)
+
+	model := definitionModel(ws.Arn)
+	updated := &Model{
+		Workspace: model.Workspace,
+		Data:      aws.String(strings.ReplaceAll(testAlertManagerDefinition, "default", "renamed")),
+	}
+	evt := apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeResourceConflict, evt.HandlerErrorCode)
+	assert.Contains(t, evt.Message, "is not managed by an AWS::APS::AlertManagerDefinition resource")
+
+	evt = apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Delete(req, nil, model)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeResourceConflict, evt.HandlerErrorCode)
+
+	assert.Zero(t, client.Calls("PutAlertManagerDefinition"))
+	assert.Zero(t, client.Calls("DeleteAlertManagerDefinition"))
+	assert.Equal(t, testAlertManagerDefinition, liveData(t, client, model))
+
+	// without a definition there is nothing to update
+	other, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	missing := &Model{Workspace: other.Arn, Data: updated.Data}
+	evt = apstest.Run(t, missing, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, definitionModel(other.Arn), missing)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, evt.HandlerErrorCode)
+}
+
+func TestList(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	model := definitionModel(ws.Arn)
+	evt, err := List(handler.Request{}, nil, &Model{Workspace: model.Workspace})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Empty(t, evt.ResourceModels)
+
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	}).OperationStatus)
+	evt, err = List(handler.Request{}, nil, &Model{Workspace: model.Workspace})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, []interface{}{*model}, evt.ResourceModels)
+
+	evt, err = List(handler.Request{}, nil, &Model{})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+}
+
+func TestAlertManagerDefinition_failedStates(t *testing.T) {
+	client := apstest.NewService(1)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	client.FailTransitions = true
+	failed := definitionModel(ws.Arn)
+	evt := apstest.Run(t, failed, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, failed)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotStabilized, evt.HandlerErrorCode)
+	assert.Equal(t, "AlertManagerDefinition status: CREATION_FAILED, reason: simulated failure", evt.Message)
+
+	client.FailTransitions = false
+	ws, err = client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	model := definitionModel(ws.Arn)
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	}).OperationStatus)
+
+	client.FailTransitions = true
+	updated := &Model{
+		Workspace: model.Workspace,
+		Data:      aws.String(strings.ReplaceAll(testAlertManagerDefinition, "default", "renamed")),
+	}
+	evt = apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotStabilized, evt.HandlerErrorCode)
+	assert.Equal(t, "AlertManagerDefinition status: UPDATE_FAILED, reason: simulated failure", evt.Message)
+}
+
+func TestCreate_definitionDeletedOutOfBand(t *testing.T) {
+	client := apstest.NewService(5)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	model := definitionModel(ws.Arn)
+	evt, err := Create(handler.Request{}, nil, model)
+	require.NoError(t, err)
+	require.Equal(t, handler.InProgress, evt.OperationStatus)
+
+	client.InjectError("DescribeAlertManagerDefinition", &prometheusservice.ResourceNotFoundException{Message_: aws.String("not found")})
+
+	evt, err = Create(handler.Request{CallbackContext: evt.CallbackContext}, nil, model)
+	require.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, evt.HandlerErrorCode)
+	assert.Equal(t, "AlertManagerDefinition was deleted out-of-band", evt.Message)
+}
+
+func TestHandlers_withInvalidModel(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		modify  func(*Model)
+		message string
+	}{
+		{
+			"empty data",
+			func(m *Model) { m.Data = aws.String(" ") },
+			"invalid Data: must not be empty",
+		},
+		{
+			"invalid data",
+			func(m *Model) { m.Data = aws.String("alertmanager_config: ''") },
+			"invalid Data: alertmanager_config must be set",
+		},
+		{
+			"workspace is not a workspace",
+			func(m *Model) { m.Workspace = aws.String("arn:aws:aps:us-west-2:111111111111:scraper/s-1") },
+			`invalid Workspace: invalid resource type "scraper" in "arn:aws:aps:us-west-2:111111111111:scraper/s-1": expected workspace`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			model := definitionModel(ws.Arn)
+			tc.modify(model)
+			for _, action := range []func(handler.Request, *Model, *Model) (handler.ProgressEvent, error){Create, Update} {
+				evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+					return action(req, definitionModel(ws.Arn), model)
+				})
+				assert.Equal(t, handler.Failed, evt.OperationStatus)
+				assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+				assert.Equal(t, tc.message, evt.Message)
+			}
+		})
+	}
+	assert.Zero(t, client.Calls("CreateAlertManagerDefinition"))
+	assert.Zero(t, client.Calls("PutAlertManagerDefinition"))
+
+	// a definition that predates its validation only fails once it changes
+	legacy := definitionModel(ws.Arn)
+	legacy.Data = aws.String("alertmanager_config: ''")
+	unchanged := *legacy
+	evt := apstest.Run(t, &unchanged, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, legacy, &unchanged)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus, evt.Message)
+	assert.Zero(t, client.Calls("PutAlertManagerDefinition"))
+}
@@ -2,67 +2,116 @@ package resource
 
 import (
 	"errors"
-	"fmt"
 	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/prometheusservice"
-	"strings"
+	"time"
 
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
 )
 
-const defaultCallbackSeconds = 2
+const phaseWaitForRuleGroupsNamespace internal.Phase = "WaitForRuleGroupsNamespace"
+
+// ruleGroupsNamespaceFailedStates are the terminal namespace states a handler
+// can't recover from.
+var ruleGroupsNamespaceFailedStates = map[string]struct{}{
+	prometheusservice.RuleGroupsNamespaceStatusCodeCreationFailed: {},
+	prometheusservice.RuleGroupsNamespaceStatusCodeUpdateFailed:   {},
+}
+
+// legacyCallbackPhases maps the keys of the unversioned callback context to
+// the phase they stand for, for backwards compatibility during release.
+var legacyCallbackPhases = map[string]internal.Phase{
+	"Arn": phaseWaitForRuleGroupsNamespace,
+}
+
+// poller schedules the callbacks that wait for the namespace to stabilize.
+var poller = internal.NewPoller(map[internal.Phase]time.Duration{
+	phaseWaitForRuleGroupsNamespace: 15 * time.Minute,
+})
+
+// errMissing is the cause of the ValidationError for a required property that
+// isn't set.
+var errMissing = errors.New("must be set")
+
+// newClient builds the APS client for a request. Tests replace it with a fake.
+var newClient internal.ClientFactory = internal.NewClient
+
+// resourceType names the resource in metrics.
+const resourceType = "AWS::APS::RuleGroupsNamespace"
+
+// propertyPaths maps the fields of namespace requests that aren't named after
+// their property, for reporting ValidationExceptions.
+var propertyPaths = internal.PropertyPaths{"workspaceId": "/properties/Workspace"}
 
 // Create handles the Create event from the Cloudformation service.
 func Create(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
-	client := internal.NewAPS(req.Session)
-	if _, ok := req.CallbackContext["Arn"]; ok {
-		currentModel.Arn = aws.String(req.CallbackContext["Arn"].(string))
+	return internal.Invoke(resourceType, internal.ActionCreate, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return create(req, prevModel, currentModel)
+	})
+}
+
+func create(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, legacyCallbackPhases)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionCreate)
+	if cbCtx.InPhase(phaseWaitForRuleGroupsNamespace) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
 		return validateRuleGroupsNamespaceState(
 			client,
+			cbCtx,
 			currentModel,
 			prometheusservice.RuleGroupsNamespaceStatusCodeActive,
 			"Create Completed")
 	}
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
 
 	if currentModel.Workspace == nil {
-		return internal.NewFailedEvent(errors.New("Missing Workspace ARN"))
+		return internal.NewFailedEvent(internal.NewValidationError("Workspace", errMissing))
 	}
 	if currentModel.Data == nil {
-		return internal.NewFailedEvent(errors.New("Missing RuleGroupsNamespace Data"))
+		return internal.NewFailedEvent(internal.NewValidationError("Data", errMissing))
 	}
 	if currentModel.Name == nil {
-		return internal.NewFailedEvent(errors.New("Missing RuleGroupsNamespace Name"))
+		return internal.NewFailedEvent(internal.NewValidationError("Name", errMissing))
+	}
+	if err := internal.ValidateRuleGroups(*currentModel.Data); err != nil {
+		return internal.NewFailedEvent(internal.NewValidationError("Data", err))
 	}
 
-	_, workspaceID, err := internal.ParseARN(*currentModel.Workspace)
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Workspace)
 	if err != nil {
-		return internal.NewFailedEvent(err)
+		return internal.NewFailedEvent(internal.NewValidationError("Workspace", err))
 	}
 	resp, err := client.CreateRuleGroupsNamespace(&prometheusservice.CreateRuleGroupsNamespaceInput{
-		WorkspaceId: aws.String(workspaceID),
+		WorkspaceId: aws.String(workspaceARN.WorkspaceID),
 		Name:        currentModel.Name,
 		Data:        []byte(*currentModel.Data),
 		Tags:        tagsToStringMap(currentModel.Tags),
 	})
 	if err != nil {
-		return internal.NewFailedEvent(err)
+		return internal.NewFailedEvent(internal.WithCreateConflict(internal.WithPropertyPaths(err, propertyPaths)))
 	}
 	currentModel.Arn = resp.Arn
 
-	return handler.ProgressEvent{
-		OperationStatus:      handler.InProgress,
-		Message:              "In Progress",
-		ResourceModel:        currentModel,
-		CallbackDelaySeconds: defaultCallbackSeconds,
-		CallbackContext:      buildCallbackContext(currentModel),
-	}, nil
+	return poller.Next(nil, phaseWaitForRuleGroupsNamespace, aws.StringValue(currentModel.Arn), currentModel), nil
 }
 
 // Read handles the Read event from the Cloudformation service.
 func Read(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionRead, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return read(req, prevModel, currentModel)
+	})
+}
+
+func read(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
 	// contract test: contract_read_without_create
 	if currentModel.Arn == nil {
 		return handler.ProgressEvent{
@@ -73,7 +122,7 @@ func Read(req handler.Request, prevModel *Model, currentModel *Model) (handler.P
 		}, nil
 	}
 
-	client := internal.NewAPS(req.Session)
+	client := newClient(req, internal.ActionRead)
 	if _, err := readRuleGroupsNamespaceDefinition(client, currentModel); err != nil {
 		return internal.NewFailedEvent(err)
 	}
@@ -87,6 +136,12 @@ func Read(req handler.Request, prevModel *Model, currentModel *Model) (handler.P
 
 // Update handles the Update event from the Cloudformation service.
 func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionUpdate, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return update(req, prevModel, currentModel)
+	})
+}
+
+func update(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
 	// contract test: contract_read_without_create
 	if currentModel.Arn == nil {
 		return handler.ProgressEvent{
@@ -97,17 +152,26 @@ func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler
 		}, nil
 	}
 
-	client := internal.NewAPS(req.Session)
-	if _, ok := req.CallbackContext["Arn"]; ok {
-		currentModel.Arn = aws.String(req.CallbackContext["Arn"].(string))
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, legacyCallbackPhases)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionUpdate)
+	if cbCtx.InPhase(phaseWaitForRuleGroupsNamespace) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
 		return validateRuleGroupsNamespaceState(
 			client,
+			cbCtx,
 			currentModel,
 			prometheusservice.RuleGroupsNamespaceStatusCodeActive,
 			"Update Complete")
 	}
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
 
-	_, workspaceID, err := internal.ParseARN(*currentModel.Arn)
+	namespaceARN, err := internal.ParseRuleGroupsNamespaceARN(*currentModel.Arn)
 	if err != nil {
 		return handler.ProgressEvent{
 			OperationStatus:  handler.Failed,
@@ -117,6 +181,16 @@ func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler
 		}, nil
 	}
 
+	if currentModel.Data == nil {
+		return internal.NewFailedEvent(internal.NewValidationError("Data", errMissing))
+	}
+	dataChanged := prevModel.Data == nil || !internal.RuleGroupsEqual(*currentModel.Data, *prevModel.Data)
+	if dataChanged {
+		if err := internal.ValidateRuleGroups(*currentModel.Data); err != nil {
+			return internal.NewFailedEvent(internal.NewValidationError("Data", err))
+		}
+	}
+
 	toAdd, toRemove := internal.StringMapDifference(tagsToStringMap(currentModel.Tags), tagsToStringMap(prevModel.Tags))
 	if len(toRemove) > 0 {
 		_, err = client.UntagResource(&prometheusservice.UntagResourceInput{
@@ -124,7 +198,7 @@ func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler
 			TagKeys:     toRemove,
 		})
 		if err != nil {
-			return internal.NewFailedEvent(err)
+			return internal.NewFailedEvent(internal.WithBusyConflict(err))
 		}
 	}
 
@@ -134,31 +208,41 @@ func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler
 			Tags:        toAdd,
 		})
 		if err != nil {
-			return internal.NewFailedEvent(err)
+			return internal.NewFailedEvent(internal.WithBusyConflict(err))
 		}
 	}
 
+	// a tag-only update leaves the namespace ACTIVE, so there is nothing to
+	// put or wait for
+	if !dataChanged {
+		return handler.ProgressEvent{
+			OperationStatus: handler.Success,
+			Message:         "Update Complete",
+			ResourceModel:   currentModel,
+		}, nil
+	}
+
 	_, err = client.
 		PutRuleGroupsNamespace(&prometheusservice.PutRuleGroupsNamespaceInput{
-			WorkspaceId: aws.String(workspaceID),
-			Name:        currentModel.Name,
+			WorkspaceId: aws.String(namespaceARN.WorkspaceID),
+			Name:        aws.String(namespaceARN.NamespaceName),
 			Data:        []byte(*currentModel.Data),
 		})
 	if err != nil {
-		return internal.NewFailedEvent(err)
+		return internal.NewFailedEvent(internal.WithBusyConflict(internal.WithPropertyPaths(err, propertyPaths)))
 	}
 
-	return handler.ProgressEvent{
-		OperationStatus:      handler.InProgress,
-		Message:              "In Progress",
-		ResourceModel:        currentModel,
-		CallbackDelaySeconds: defaultCallbackSeconds,
-		CallbackContext:      buildCallbackContext(currentModel),
-	}, nil
+	return poller.Next(nil, phaseWaitForRuleGroupsNamespace, aws.StringValue(currentModel.Arn), currentModel), nil
 }
 
 // Delete handles the Delete event from the Cloudformation service.
 func Delete(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionDelete, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return delete(req, prevModel, currentModel)
+	})
+}
+
+func delete(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
 	if currentModel.Arn == nil {
 		return handler.ProgressEvent{
 			OperationStatus:  handler.Failed,
@@ -168,16 +252,25 @@ func Delete(req handler.Request, prevModel *Model, currentModel *Model) (handler
 		}, nil
 	}
 
-	client := internal.NewAPS(req.Session)
-	if _, ok := req.CallbackContext["Arn"]; ok {
-		currentModel.Arn = aws.String(req.CallbackContext["Arn"].(string))
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, legacyCallbackPhases)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionDelete)
+	if cbCtx.InPhase(phaseWaitForRuleGroupsNamespace) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
 		return validateRuleGroupsNamespaceDeleted(
 			client,
+			cbCtx,
 			currentModel,
 			"Delete Complete")
 	}
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
 
-	_, workspaceID, err := internal.ParseARN(*currentModel.Arn)
+	namespaceARN, err := internal.ParseRuleGroupsNamespaceARN(*currentModel.Arn)
 	if err != nil {
 		return handler.ProgressEvent{
 			OperationStatus:  handler.Failed,
@@ -189,64 +282,111 @@ func Delete(req handler.Request, prevModel *Model, currentModel *Model) (handler
 
 	_, err = client.
 		DeleteRuleGroupsNamespace(&prometheusservice.DeleteRuleGroupsNamespaceInput{
-			WorkspaceId: aws.String(workspaceID),
-			Name:        currentModel.Name,
+			WorkspaceId: aws.String(namespaceARN.WorkspaceID),
+			Name:        aws.String(namespaceARN.NamespaceName),
 		})
 	if err != nil {
-		return internal.NewFailedEvent(err)
+		return internal.NewFailedEvent(internal.WithBusyConflict(err))
 	}
 
-	return handler.ProgressEvent{
-		OperationStatus:      handler.InProgress,
-		Message:              "In Progress",
-		ResourceModel:        currentModel,
-		CallbackDelaySeconds: defaultCallbackSeconds,
-		CallbackContext:      buildCallbackContext(currentModel),
-	}, nil
+	return poller.Next(nil, phaseWaitForRuleGroupsNamespace, aws.StringValue(currentModel.Arn), currentModel), nil
 }
 
 // List handles the List event from the Cloudformation service.
 func List(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
-	return handler.ProgressEvent{}, errors.New("Not implemented: List")
+	return internal.Invoke(resourceType, internal.ActionList, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return list(req, prevModel, currentModel)
+	})
+}
+
+func list(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	if currentModel == nil || currentModel.Workspace == nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid List: Workspace ARN cannot be empty",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeInvalidRequest,
+		}, nil
+	}
+
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Workspace)
+	if err != nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid List: invalid Workspace ARN format",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeInvalidRequest,
+		}, nil
+	}
+
+	var nextToken *string
+	if req.RequestContext.NextToken != "" {
+		nextToken = &req.RequestContext.NextToken
+	}
+
+	resp, err := newClient(req, internal.ActionList).ListRuleGroupsNamespaces(&prometheusservice.ListRuleGroupsNamespacesInput{
+		WorkspaceId: aws.String(workspaceARN.WorkspaceID),
+		NextToken:   nextToken,
+	})
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	models := make([]interface{}, 0, len(resp.RuleGroupsNamespaces))
+	for _, ns := range resp.RuleGroupsNamespaces {
+		models = append(models, Model{
+			Arn:       ns.Arn,
+			Name:      ns.Name,
+			Workspace: currentModel.Workspace,
+			Tags:      stringMapToTags(ns.Tags),
+		})
+	}
+
+	var responseNextToken string
+	if resp.NextToken != nil {
+		responseNextToken = *resp.NextToken
+	}
+
+	return handler.ProgressEvent{
+		OperationStatus: handler.Success,
+		Message:         "List complete",
+		ResourceModels:  models,
+		NextToken:       responseNextToken,
+	}, nil
 }
 
 func readRuleGroupsNamespaceDefinition(
-	client *prometheusservice.PrometheusService,
+	client internal.APSService,
 	currentModel *Model,
 ) (*prometheusservice.RuleGroupsNamespaceStatus, error) {
-	arn, workspaceID, err := internal.ParseARN(*currentModel.Arn)
+	namespaceARN, err := internal.ParseRuleGroupsNamespaceARN(*currentModel.Arn)
 	if err != nil {
 		return nil, err
 	}
 
-	resourceParts := strings.Split(arn.Resource, "/")
-	currentModel.Name = aws.String(resourceParts[len(resourceParts)-1])
+	currentModel.Name = aws.String(namespaceARN.NamespaceName)
 
 	data, err := client.DescribeRuleGroupsNamespace(&prometheusservice.DescribeRuleGroupsNamespaceInput{
-		WorkspaceId: aws.String(workspaceID),
+		WorkspaceId: aws.String(namespaceARN.WorkspaceID),
 		Name:        currentModel.Name,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	arn.Resource = fmt.Sprintf("workspace/%s", workspaceID)
-	currentModel.Workspace = aws.String(arn.String())
-	currentModel.Data = aws.String(string(data.RuleGroupsNamespace.Data))
+	currentModel.Workspace = aws.String(namespaceARN.WorkspaceARN().String())
+	// keep the template's form of equivalent rules so reformatting them
+	// doesn't show up as drift
+	live := string(data.RuleGroupsNamespace.Data)
+	if currentModel.Data == nil || !internal.RuleGroupsEqual(*currentModel.Data, live) {
+		currentModel.Data = aws.String(live)
+	}
 	currentModel.Tags = stringMapToTags(data.RuleGroupsNamespace.Tags)
 	return data.RuleGroupsNamespace.Status, nil
 }
 
-func validateRuleGroupsNamespaceDeleted(client *prometheusservice.PrometheusService, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+func validateRuleGroupsNamespaceDeleted(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
 	_, err := readRuleGroupsNamespaceDefinition(client, currentModel)
 	if err == nil {
-		return handler.ProgressEvent{
-			ResourceModel:        currentModel,
-			OperationStatus:      handler.InProgress,
-			Message:              "In Progress",
-			CallbackDelaySeconds: defaultCallbackSeconds,
-			CallbackContext:      buildCallbackContext(currentModel),
-		}, nil
+		return poller.Next(cbCtx, phaseWaitForRuleGroupsNamespace, aws.StringValue(currentModel.Arn), currentModel), nil
 	}
 
 	if awsErr, ok := err.(awserr.Error); ok {
@@ -258,23 +398,24 @@ func validateRuleGroupsNamespaceDeleted(client *prometheusservice.PrometheusServ
 		}
 	}
 
-	return handler.ProgressEvent{}, err
+	return internal.NewFailedEvent(err)
 }
 
-func validateRuleGroupsNamespaceState(client *prometheusservice.PrometheusService, currentModel *Model, targetState string, successMessage string) (handler.ProgressEvent, error) {
+func validateRuleGroupsNamespaceState(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, targetState string, successMessage string) (handler.ProgressEvent, error) {
 	state, err := readRuleGroupsNamespaceDefinition(client, currentModel)
+	if internal.IsNotFound(err) {
+		return internal.NewDeletedOutOfBandEvent("RuleGroupsNamespace", currentModel), nil
+	}
 	if err != nil {
-		return handler.ProgressEvent{}, err
+		return internal.NewFailedEvent(err)
+	}
+
+	if _, ok := ruleGroupsNamespaceFailedStates[aws.StringValue(state.StatusCode)]; ok {
+		return internal.NewStatusFailedEvent("RuleGroupsNamespace", state.StatusCode, state.StatusReason, currentModel), nil
 	}
 
 	if aws.StringValue(state.StatusCode) != targetState {
-		return handler.ProgressEvent{
-			ResourceModel:        currentModel,
-			OperationStatus:      handler.InProgress,
-			Message:              "In Progress",
-			CallbackDelaySeconds: defaultCallbackSeconds,
-			CallbackContext:      buildCallbackContext(currentModel),
-		}, nil
+		return poller.Next(cbCtx, phaseWaitForRuleGroupsNamespace, aws.StringValue(currentModel.Arn), currentModel), nil
 	}
 
 	return handler.ProgressEvent{
@@ -284,12 +425,6 @@ func validateRuleGroupsNamespaceState(client *prometheusservice.PrometheusServic
 	}, nil
 }
 
-func buildCallbackContext(model *Model) map[string]interface{} {
-	return map[string]interface{}{
-		"Arn": aws.StringValue(model.Arn),
-	}
-}
-
 func stringMapToTags(m map[string]*string) []Tag {
 	res := []Tag{}
 	for key, val := range m {
@@ -1,36 +1,45 @@
 package resource
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal/apstest"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/defaults"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreate_withInvalidModel(t *testing.T) {
 	testCases := map[string]struct {
-		currentModel  Model
+		currentModel Model
+		message      string
 	}{
 		"Should return Failed when Workspace is missing": {
 			Model{
-				Data:      aws.String("ruleGroupData"),
-				Name:      aws.String("name"),
+				Data: aws.String("ruleGroupData"),
+				Name: aws.String("name"),
 			},
+			"invalid Workspace: must be set",
 		},
 		"Should return Failed when Data is missing": {
 			Model{
 				Workspace: aws.String("workspaceArn"),
 				Name:      aws.String("name"),
 			},
+			"invalid Data: must be set",
 		},
 		"Should return Failed when Name is missing": {
 			Model{
 				Workspace: aws.String("workspaceArn"),
 				Data:      aws.String("ruleGroupData"),
 			},
+			"invalid Name: must be set",
 		},
 	}
 
@@ -47,7 +56,349 @@ func TestCreate_withInvalidModel(t *testing.T) {
 
 			assert.NoError(t, err)
 			assert.Equal(t, handler.Failed, failedEvent.OperationStatus)
-			assert.Equal(t, "Internal Failure", failedEvent.Message)
+			assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, failedEvent.HandlerErrorCode)
+			assert.Equal(t, tc.message, failedEvent.Message)
+		})
+	}
+}
+
+func TestList_withInvalidModel(t *testing.T) {
+	testCases := map[string]struct {
+		currentModel *Model
+	}{
+		"Should return InvalidRequest when model is missing": {
+			nil,
+		},
+		"Should return InvalidRequest when Workspace is missing": {
+			&Model{},
+		},
+		"Should return InvalidRequest when Workspace is not a workspace ARN": {
+			&Model{
+				Workspace: aws.String("arn:aws:aps:us-west-2:111111111111:scraper/s-11111111"),
+			},
+		},
+	}
+
+	req := handler.Request{
+		LogicalResourceID: "foo",
+		Session: &session.Session{
+			Config: defaults.Config(),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			failedEvent, err := List(req, nil, tc.currentModel)
+
+			assert.NoError(t, err)
+			assert.Equal(t, handler.Failed, failedEvent.OperationStatus)
+			assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, failedEvent.HandlerErrorCode)
 		})
 	}
 }
+
+const testRuleData = `groups:
+  - name: test
+    rules:
+      - record: metric:recording_rule
+        expr: avg(rate(container_cpu_usage_seconds_total[5m]))
+`
+
+func TestRuleGroupsNamespace_lifecycle(t *testing.T) {
+	client := apstest.NewService(2)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	model := &Model{
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(testRuleData),
+		Tags:      []Tag{{Key: aws.String("k"), Value: aws.String("v")}},
+	}
+	evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, "Create Completed", evt.Message)
+	assert.Equal(t, 3, client.Calls("DescribeRuleGroupsNamespace"))
+
+	read := &Model{Arn: model.Arn}
+	evt = apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, ws.Arn, read.Workspace)
+	assert.Equal(t, "rules", aws.StringValue(read.Name))
+	assert.Equal(t, testRuleData, aws.StringValue(read.Data))
+
+	updated := &Model{
+		Arn:       model.Arn,
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(strings.Replace(testRuleData, "5m", "10m", 1)),
+	}
+	evt = apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Empty(t, updated.Tags)
+	assert.Equal(t, 1, client.Calls("UntagResource"))
+
+	deleted := &Model{Arn: model.Arn, Name: model.Name}
+	evt = apstest.Run(t, deleted, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Delete(req, nil, deleted)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+
+	read = &Model{Arn: model.Arn}
+	evt = apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, evt.HandlerErrorCode)
+}
+
+func TestRuleGroupsNamespace_conflicts(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	model := &Model{
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(testRuleData),
+	}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	}).OperationStatus)
+
+	// a namespace of the same name already exists, which retrying won't fix
+	duplicate := &Model{Workspace: ws.Arn, Name: model.Name, Data: model.Data}
+	evt := apstest.Run(t, duplicate, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, duplicate)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeAlreadyExists, evt.HandlerErrorCode)
+	assert.Equal(t, 2, client.Calls("CreateRuleGroupsNamespace"))
+
+	// a namespace busy with another change is retried
+	client.InjectError("PutRuleGroupsNamespace", &prometheusservice.ConflictException{Message_: aws.String("busy")})
+	updated := &Model{
+		Arn:       model.Arn,
+		Workspace: ws.Arn,
+		Name:      model.Name,
+		Data:      aws.String(strings.Replace(testRuleData, "5m", "10m", 1)),
+	}
+	evt = apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, 2, client.Calls("PutRuleGroupsNamespace"))
+}
+
+func TestList(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	for _, name := range []string{"a", "b"} {
+		_, err := client.CreateRuleGroupsNamespace(&prometheusservice.CreateRuleGroupsNamespaceInput{
+			WorkspaceId: ws.WorkspaceId,
+			Name:        aws.String(name),
+			Data:        []byte(testRuleData),
+			Tags:        map[string]*string{"name": aws.String(name)},
+		})
+		require.NoError(t, err)
+	}
+
+	evt, err := List(handler.Request{}, nil, &Model{Workspace: ws.Arn})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Empty(t, evt.NextToken)
+	require.Len(t, evt.ResourceModels, 2)
+
+	first := evt.ResourceModels[0].(Model)
+	assert.Equal(t, "a", aws.StringValue(first.Name))
+	assert.Equal(t, ws.Arn, first.Workspace)
+	assert.Contains(t, aws.StringValue(first.Arn), "rulegroupsnamespace/"+aws.StringValue(ws.WorkspaceId)+"/a")
+	assert.Equal(t, []Tag{{Key: aws.String("name"), Value: aws.String("a")}}, first.Tags)
+}
+
+func TestRuleGroupsNamespace_failedStates(t *testing.T) {
+	client := apstest.NewService(1)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	client.FailTransitions = true
+	model := &Model{
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(testRuleData),
+	}
+	evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotStabilized, evt.HandlerErrorCode)
+	assert.Equal(t, "RuleGroupsNamespace status: CREATION_FAILED, reason: simulated failure", evt.Message)
+
+	updated := &Model{
+		Arn:       model.Arn,
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(strings.Replace(testRuleData, "5m", "10m", 1)),
+	}
+	evt = apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, "RuleGroupsNamespace status: UPDATE_FAILED, reason: simulated failure", evt.Message)
+}
+
+func TestHandlers_withInvalidRuleData(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	data := strings.Replace(testRuleData, "[5m]))", "[5m])", 1)
+	message := `invalid Data: groups[0] "test": rules[0] "metric:recording_rule": could not parse expression: ` +
+		`1:48: parse error: unexpected end of input in aggregation`
+
+	invalid := &Model{
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(data),
+	}
+	evt := apstest.Run(t, invalid, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, invalid)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+	assert.Equal(t, message, evt.Message)
+	assert.Zero(t, client.Calls("CreateRuleGroupsNamespace"))
+
+	model := &Model{
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(testRuleData),
+		Tags:      []Tag{{Key: aws.String("k"), Value: aws.String("v")}},
+	}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) { return Create(req, nil, model) }).OperationStatus)
+
+	updated := &Model{
+		Arn:       model.Arn,
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(data),
+	}
+	evt = apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+	assert.Equal(t, message, evt.Message)
+	assert.Zero(t, client.Calls("UntagResource"))
+	assert.Zero(t, client.Calls("PutRuleGroupsNamespace"))
+
+	// rules that APS accepted before they were validated can still be tagged
+	legacy, err := client.CreateRuleGroupsNamespace(&prometheusservice.CreateRuleGroupsNamespaceInput{
+		WorkspaceId: ws.WorkspaceId,
+		Name:        aws.String("legacy"),
+		Data:        []byte(data),
+	})
+	require.NoError(t, err)
+	prev := &Model{Arn: legacy.Arn, Workspace: ws.Arn, Name: aws.String("legacy"), Data: aws.String(data)}
+	tagged := &Model{
+		Arn:       legacy.Arn,
+		Workspace: ws.Arn,
+		Name:      aws.String("legacy"),
+		Data:      aws.String(data),
+		Tags:      []Tag{{Key: aws.String("k"), Value: aws.String("v")}},
+	}
+	evt = apstest.Run(t, tagged, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, prev, tagged)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus, evt.Message)
+	assert.Equal(t, 1, client.Calls("TagResource"))
+	assert.Zero(t, client.Calls("PutRuleGroupsNamespace"))
+}
+
+func TestUpdate_unchangedRuleData(t *testing.T) {
+	client := apstest.NewService(2)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	model := &Model{
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(testRuleData),
+	}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) { return Create(req, nil, model) }).OperationStatus)
+	describes := client.Calls("DescribeRuleGroupsNamespace")
+
+	reformatted := "groups:\n- name: test\n  rules:\n  - expr: |\n      avg(rate(container_cpu_usage_seconds_total[5m]))\n    record: metric:recording_rule\n"
+	updated := &Model{
+		Arn:       model.Arn,
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(reformatted),
+		Tags:      []Tag{{Key: aws.String("k"), Value: aws.String("v")}},
+	}
+	evt, err := Update(handler.Request{}, model, updated)
+	require.NoError(t, err)
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, 1, client.Calls("TagResource"))
+	assert.Zero(t, client.Calls("PutRuleGroupsNamespace"))
+	assert.Equal(t, describes, client.Calls("DescribeRuleGroupsNamespace"))
+
+	read := &Model{Arn: model.Arn, Data: aws.String(reformatted)}
+	evt = apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, reformatted, aws.StringValue(read.Data))
+
+	changed := strings.Replace(reformatted, "5m", "10m", 1)
+	read = &Model{Arn: model.Arn, Data: aws.String(changed)}
+	evt = apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, testRuleData, aws.StringValue(read.Data))
+}
+
+func TestCreate_validationExceptionFields(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	client.InjectError("CreateRuleGroupsNamespace", &prometheusservice.ValidationException{
+		Message_: aws.String("Invalid request."),
+		Reason:   aws.String(prometheusservice.ValidationExceptionReasonFieldValidationFailed),
+		FieldList: []*prometheusservice.ValidationExceptionField{
+			{Name: aws.String("workspaceId"), Message: aws.String("workspace is not active")},
+			{Name: aws.String("name"), Message: aws.String("name is too long")},
+		},
+	})
+	invalid := &Model{
+		Workspace: ws.Arn,
+		Name:      aws.String("rules"),
+		Data:      aws.String(testRuleData),
+	}
+	evt := apstest.Run(t, invalid, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, invalid)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+	assert.Equal(t, "ValidationException: Invalid request. Invalid properties: /properties/Workspace (workspace is not active), /properties/Name (name is too long)", evt.Message)
+}
@@ -0,0 +1,541 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+)
+
+const (
+	phaseWaitForScraperActive  internal.Phase = "WaitForScraperActive"
+	phaseWaitForScraperDeleted internal.Phase = "WaitForScraperDeleted"
+
+	messageCreateComplete = "Create Completed"
+	messageUpdateComplete = "Update Completed"
+	messageDeleteComplete = "Delete Complete"
+)
+
+// scraperFailedStates are the terminal scraper states a handler can't recover
+// from.
+var scraperFailedStates = map[string]struct{}{
+	prometheusservice.ScraperStatusCodeCreationFailed: {},
+	prometheusservice.ScraperStatusCodeDeletionFailed: {},
+	internal.ScraperStatusCodeUpdateFailed:            {},
+}
+
+// poller schedules the callbacks that wait for the scraper to stabilize.
+// Scrapers take a long time to create because they connect to the EKS
+// cluster's network.
+var poller = internal.NewPoller(map[internal.Phase]time.Duration{
+	phaseWaitForScraperActive:  45 * time.Minute,
+	phaseWaitForScraperDeleted: 30 * time.Minute,
+})
+
+// newClient builds the APS client for a request. Tests replace it with a fake.
+var newClient internal.ClientFactory = internal.NewClient
+
+// resourceType names the resource in metrics.
+const resourceType = "AWS::APS::Scraper"
+
+// Create handles the Create event from the Cloudformation service.
+func Create(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionCreate, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return create(req, prevModel, currentModel)
+	})
+}
+
+func create(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	// scrapers were released after callback contexts were versioned, so there
+	// are no legacy contexts to read
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, nil)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionCreate)
+	if cbCtx.InPhase(phaseWaitForScraperActive) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+		return validateScraperState(client, cbCtx, currentModel, messageCreateComplete)
+	}
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
+
+	if currentModel.ScraperId != nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid Create: cannot create a resource using readOnly ScraperId property",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeInvalidRequest,
+		}, nil
+	}
+
+	source, err := sourceToAPI(currentModel.Source)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+	destination, err := destinationToAPI(currentModel.Destination)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+	scrapeConfiguration, err := scrapeConfigurationToAPI(currentModel.ScrapeConfiguration)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	resp, err := client.CreateScraper(&prometheusservice.CreateScraperInput{
+		Alias:               currentModel.Alias,
+		Source:              source,
+		Destination:         destination,
+		ScrapeConfiguration: scrapeConfiguration,
+		Tags:                tagsToStringMap(currentModel.Tags),
+	})
+	if err != nil {
+		return internal.NewFailedEvent(internal.WithCreateConflict(err))
+	}
+	currentModel.Arn = resp.Arn
+	currentModel.ScraperId = resp.ScraperId
+
+	return poller.Next(nil, phaseWaitForScraperActive, aws.StringValue(currentModel.Arn), currentModel), nil
+}
+
+// Read handles the Read event from the Cloudformation service.
+func Read(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionRead, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return read(req, prevModel, currentModel)
+	})
+}
+
+func read(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	// contract test: contract_read_without_create
+	if currentModel.Arn == nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid Read: scraper ARN cannot be empty",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		}, nil
+	}
+
+	if _, err := readScraper(newClient(req, internal.ActionRead), currentModel); err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	return handler.ProgressEvent{
+		OperationStatus: handler.Success,
+		Message:         "Read Complete",
+		ResourceModel:   currentModel,
+	}, nil
+}
+
+// Update handles the Update event from the Cloudformation service. The Source
+// of a scraper is create-only, everything else is updated in place.
+func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionUpdate, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return update(req, prevModel, currentModel)
+	})
+}
+
+func update(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	// contract test: contract_read_without_create
+	if currentModel.Arn == nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid Update: scraper ARN cannot be empty",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		}, nil
+	}
+
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, nil)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionUpdate)
+	if cbCtx.InPhase(phaseWaitForScraperActive) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+		return validateScraperState(client, cbCtx, currentModel, messageUpdateComplete)
+	}
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
+
+	scraperARN, err := internal.ParseScraperARN(*currentModel.Arn)
+	if err != nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid Update: invalid scraper ARN format",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		}, nil
+	}
+	currentModel.ScraperId = aws.String(scraperARN.ScraperID)
+
+	// only the fields an update changes are validated, so a configuration
+	// that passed an older validator doesn't block unrelated updates
+	var destination *prometheusservice.Destination
+	if internal.StringDiffers(workspaceArn(currentModel.Destination), workspaceArn(prevModel.Destination)) {
+		if destination, err = destinationToAPI(currentModel.Destination); err != nil {
+			return internal.NewFailedEvent(err)
+		}
+	}
+	var scrapeConfiguration *prometheusservice.ScrapeConfiguration
+	if scrapeConfigurationUpdated(currentModel.ScrapeConfiguration, prevModel.ScrapeConfiguration) {
+		if scrapeConfiguration, err = scrapeConfigurationToAPI(currentModel.ScrapeConfiguration); err != nil {
+			return internal.NewFailedEvent(err)
+		}
+	}
+
+	toAdd, toRemove := internal.StringMapDifference(tagsToStringMap(currentModel.Tags), tagsToStringMap(prevModel.Tags))
+	if len(toRemove) > 0 {
+		_, err = client.UntagResource(&prometheusservice.UntagResourceInput{
+			ResourceArn: currentModel.Arn,
+			TagKeys:     toRemove,
+		})
+		if err != nil {
+			return internal.NewFailedEvent(internal.WithBusyConflict(err))
+		}
+	}
+	if len(toAdd) > 0 {
+		_, err = client.TagResource(&prometheusservice.TagResourceInput{
+			ResourceArn: currentModel.Arn,
+			Tags:        toAdd,
+		})
+		if err != nil {
+			return internal.NewFailedEvent(internal.WithBusyConflict(err))
+		}
+	}
+
+	// UpdateScraper leaves fields that aren't set alone, so only the changed
+	// ones are sent. An alias can't be removed, only replaced.
+	input := &internal.UpdateScraperInput{ScraperId: currentModel.ScraperId}
+	changed := false
+	if currentModel.Alias != nil && internal.StringDiffers(currentModel.Alias, prevModel.Alias) {
+		input.Alias = currentModel.Alias
+		changed = true
+	}
+	if destination != nil {
+		input.Destination = destination
+		changed = true
+	}
+	if scrapeConfiguration != nil {
+		input.ScrapeConfiguration = scrapeConfiguration
+		changed = true
+	}
+
+	// a tag-only update leaves the scraper ACTIVE, so there is nothing to
+	// update or wait for
+	if !changed {
+		return handler.ProgressEvent{
+			OperationStatus: handler.Success,
+			Message:         messageUpdateComplete,
+			ResourceModel:   currentModel,
+		}, nil
+	}
+
+	if _, err := client.UpdateScraper(input); err != nil {
+		return internal.NewFailedEvent(internal.WithBusyConflict(err))
+	}
+
+	return poller.Next(nil, phaseWaitForScraperActive, aws.StringValue(currentModel.Arn), currentModel), nil
+}
+
+// Delete handles the Delete event from the Cloudformation service.
+func Delete(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionDelete, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return delete(req, prevModel, currentModel)
+	})
+}
+
+func delete(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	if currentModel.Arn == nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid Delete: scraper ARN cannot be empty",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		}, nil
+	}
+
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, nil)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionDelete)
+	if cbCtx.InPhase(phaseWaitForScraperDeleted) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+		return validateScraperDeleted(client, cbCtx, currentModel, messageDeleteComplete)
+	}
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
+
+	scraperARN, err := internal.ParseScraperARN(*currentModel.Arn)
+	if err != nil {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "Invalid Delete: invalid scraper ARN format",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		}, nil
+	}
+
+	_, err = client.DeleteScraper(&prometheusservice.DeleteScraperInput{
+		ScraperId: aws.String(scraperARN.ScraperID),
+	})
+	if err != nil {
+		return internal.NewFailedEvent(internal.WithBusyConflict(err))
+	}
+
+	return poller.Next(nil, phaseWaitForScraperDeleted, aws.StringValue(currentModel.Arn), currentModel), nil
+}
+
+// List handles the List event from the Cloudformation service.
+func List(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionList, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return list(req, prevModel, currentModel)
+	})
+}
+
+func list(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	var nextToken *string
+	if req.RequestContext.NextToken != "" {
+		nextToken = &req.RequestContext.NextToken
+	}
+
+	resp, err := newClient(req, internal.ActionList).ListScrapers(&prometheusservice.ListScrapersInput{
+		NextToken: nextToken,
+	})
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	models := make([]interface{}, 0, len(resp.Scrapers))
+	for _, s := range resp.Scrapers {
+		models = append(models, Model{
+			ScraperId:   s.ScraperId,
+			Alias:       s.Alias,
+			Arn:         s.Arn,
+			RoleArn:     s.RoleArn,
+			Source:      sourceFromAPI(s.Source),
+			Destination: destinationFromAPI(s.Destination),
+			Tags:        stringMapToTags(s.Tags),
+		})
+	}
+
+	var responseNextToken string
+	if resp.NextToken != nil {
+		responseNextToken = *resp.NextToken
+	}
+
+	return handler.ProgressEvent{
+		OperationStatus: handler.Success,
+		Message:         "List complete",
+		ResourceModels:  models,
+		NextToken:       responseNextToken,
+	}, nil
+}
+
+func readScraper(client internal.APSService, currentModel *Model) (*prometheusservice.ScraperDescription, error) {
+	scraperARN, err := internal.ParseScraperARN(*currentModel.Arn)
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.DescribeScraper(&prometheusservice.DescribeScraperInput{
+		ScraperId: aws.String(scraperARN.ScraperID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scraper := data.Scraper
+	currentModel.ScraperId = scraper.ScraperId
+	currentModel.Arn = scraper.Arn
+	currentModel.Alias = scraper.Alias
+	currentModel.RoleArn = scraper.RoleArn
+	currentModel.Source = sourceFromAPI(scraper.Source)
+	currentModel.Destination = destinationFromAPI(scraper.Destination)
+	currentModel.Tags = stringMapToTags(scraper.Tags)
+
+	// keep the template's encoding of the same configuration so padding
+	// differences don't show up as drift
+	if scraper.ScrapeConfiguration != nil {
+		live := scraper.ScrapeConfiguration.ConfigurationBlob
+		if scrapeConfigurationChanged(&prometheusservice.ScrapeConfiguration{ConfigurationBlob: live}, currentModel.ScrapeConfiguration) {
+			currentModel.ScrapeConfiguration = &ScrapeConfiguration{
+				ConfigurationBlob: aws.String(base64.StdEncoding.EncodeToString(live)),
+			}
+		}
+	}
+
+	return scraper, nil
+}
+
+func validateScraperState(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+	scraper, err := readScraper(client, currentModel)
+	if internal.IsNotFound(err) {
+		return internal.NewDeletedOutOfBandEvent("Scraper", currentModel), nil
+	}
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	statusCode := scraper.Status.StatusCode
+	if _, ok := scraperFailedStates[aws.StringValue(statusCode)]; ok {
+		return internal.NewStatusFailedEvent("Scraper", statusCode, scraper.StatusReason, currentModel), nil
+	}
+
+	if aws.StringValue(statusCode) != prometheusservice.ScraperStatusCodeActive {
+		return poller.Next(cbCtx, phaseWaitForScraperActive, aws.StringValue(currentModel.Arn), currentModel), nil
+	}
+
+	return handler.ProgressEvent{
+		ResourceModel:   currentModel,
+		OperationStatus: handler.Success,
+		Message:         successMessage,
+	}, nil
+}
+
+func validateScraperDeleted(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+	scraper, err := readScraper(client, currentModel)
+	if internal.IsNotFound(err) {
+		return handler.ProgressEvent{
+			OperationStatus: handler.Success,
+			Message:         successMessage,
+		}, nil
+	}
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	statusCode := scraper.Status.StatusCode
+	if aws.StringValue(statusCode) == prometheusservice.ScraperStatusCodeDeletionFailed {
+		return internal.NewStatusFailedEvent("Scraper", statusCode, scraper.StatusReason, currentModel), nil
+	}
+
+	return poller.Next(cbCtx, phaseWaitForScraperDeleted, aws.StringValue(currentModel.Arn), currentModel), nil
+}
+
+func sourceToAPI(source *Source) (*prometheusservice.Source, error) {
+	if source == nil || source.EksConfiguration == nil {
+		return nil, internal.NewValidationError("Source", errors.New("EksConfiguration must be set"))
+	}
+	eks := source.EksConfiguration
+	if eks.ClusterArn == nil {
+		return nil, internal.NewValidationError("Source", errors.New("EksConfiguration.ClusterArn must be set"))
+	}
+	if len(eks.SubnetIds) == 0 {
+		return nil, internal.NewValidationError("Source", errors.New("EksConfiguration.SubnetIds must not be empty"))
+	}
+
+	config := &prometheusservice.EksConfiguration{
+		ClusterArn: eks.ClusterArn,
+		SubnetIds:  aws.StringSlice(eks.SubnetIds),
+	}
+	if len(eks.SecurityGroupIds) > 0 {
+		config.SecurityGroupIds = aws.StringSlice(eks.SecurityGroupIds)
+	}
+	return &prometheusservice.Source{EksConfiguration: config}, nil
+}
+
+func sourceFromAPI(source *prometheusservice.Source) *Source {
+	if source == nil || source.EksConfiguration == nil {
+		return nil
+	}
+	eks := source.EksConfiguration
+	config := &EksConfiguration{
+		ClusterArn: eks.ClusterArn,
+		SubnetIds:  aws.StringValueSlice(eks.SubnetIds),
+	}
+	if len(eks.SecurityGroupIds) > 0 {
+		config.SecurityGroupIds = aws.StringValueSlice(eks.SecurityGroupIds)
+	}
+	return &Source{EksConfiguration: config}
+}
+
+func destinationToAPI(destination *Destination) (*prometheusservice.Destination, error) {
+	arn := workspaceArn(destination)
+	if arn == nil {
+		return nil, internal.NewValidationError("Destination", errors.New("AmpConfiguration.WorkspaceArn must be set"))
+	}
+	if _, err := internal.ParseWorkspaceARN(*arn); err != nil {
+		return nil, internal.NewValidationError("Destination", err)
+	}
+	return &prometheusservice.Destination{
+		AmpConfiguration: &prometheusservice.AmpConfiguration{WorkspaceArn: arn},
+	}, nil
+}
+
+func destinationFromAPI(destination *prometheusservice.Destination) *Destination {
+	if destination == nil || destination.AmpConfiguration == nil {
+		return nil
+	}
+	return &Destination{
+		AmpConfiguration: &AmpConfiguration{WorkspaceArn: destination.AmpConfiguration.WorkspaceArn},
+	}
+}
+
+func workspaceArn(destination *Destination) *string {
+	if destination == nil || destination.AmpConfiguration == nil {
+		return nil
+	}
+	return destination.AmpConfiguration.WorkspaceArn
+}
+
+func scrapeConfigurationToAPI(config *ScrapeConfiguration) (*prometheusservice.ScrapeConfiguration, error) {
+	if config == nil || config.ConfigurationBlob == nil {
+		return nil, internal.NewValidationError("ScrapeConfiguration", errors.New("ConfigurationBlob must be set"))
+	}
+	data, err := internal.DecodeScrapeConfiguration(*config.ConfigurationBlob)
+	if err == nil {
+		err = internal.ValidateScrapeConfiguration(data)
+	}
+	if err != nil {
+		return nil, internal.NewValidationError("ScrapeConfiguration", err)
+	}
+	return &prometheusservice.ScrapeConfiguration{ConfigurationBlob: data}, nil
+}
+
+// scrapeConfigurationUpdated reports whether an update changes the scrape
+// configuration from previous to current. A current configuration that is
+// missing or doesn't decode counts as changed, so its validation fails.
+func scrapeConfigurationUpdated(current, previous *ScrapeConfiguration) bool {
+	if current == nil || current.ConfigurationBlob == nil {
+		return true
+	}
+	data, err := internal.DecodeScrapeConfiguration(*current.ConfigurationBlob)
+	return err != nil || scrapeConfigurationChanged(&prometheusservice.ScrapeConfiguration{ConfigurationBlob: data}, previous)
+}
+
+// scrapeConfigurationChanged reports whether current decodes to a different
+// configuration than previous. A previous configuration that doesn't decode
+// is always different.
+func scrapeConfigurationChanged(current *prometheusservice.ScrapeConfiguration, previous *ScrapeConfiguration) bool {
+	if previous == nil || previous.ConfigurationBlob == nil {
+		return true
+	}
+	data, err := internal.DecodeScrapeConfiguration(*previous.ConfigurationBlob)
+	return err != nil || !bytes.Equal(current.ConfigurationBlob, data)
+}
+
+func stringMapToTags(m map[string]*string) []Tag {
+	res := []Tag{}
+	for key, val := range m {
+		res = append(res, Tag{
+			Key:   aws.String(key),
+			Value: val,
+		})
+	}
+	return res
+}
+
+func tagsToStringMap(tags []Tag) map[string]*string {
+	result := map[string]*string{}
+	for _, tag := range tags {
+		result[aws.StringValue(tag.Key)] = tag.Value
+	}
+	return result
+}
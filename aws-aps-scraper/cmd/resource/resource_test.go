@@ -0,0 +1,234 @@
+package resource
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal/apstest"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testScrapeConfiguration = `global:
+  scrape_interval: 30s
+scrape_configs:
+  - job_name: kubernetes-pods
+    kubernetes_sd_configs:
+      - role: pod
+`
+
+// scraperModel returns a scraper that sends metrics to the workspace
+// workspaceArn.
+func scraperModel(workspaceArn *string) *Model {
+	return &Model{
+		Alias: aws.String("cluster"),
+		Source: &Source{EksConfiguration: &EksConfiguration{
+			ClusterArn:       aws.String("arn:aws:eks:us-west-2:111111111111:cluster/demo"),
+			SubnetIds:        []string{"subnet-1", "subnet-2"},
+			SecurityGroupIds: []string{"sg-1"},
+		}},
+		Destination: &Destination{AmpConfiguration: &AmpConfiguration{WorkspaceArn: workspaceArn}},
+		ScrapeConfiguration: &ScrapeConfiguration{
+			ConfigurationBlob: aws.String(base64.StdEncoding.EncodeToString([]byte(testScrapeConfiguration))),
+		},
+		Tags: []Tag{{Key: aws.String("team"), Value: aws.String("a")}},
+	}
+}
+
+// TestUpdate_changedFields checks that Update only sends the fields that
+// changed, and that Read maps the scraper back to the template's form.
+func TestUpdate_changedFields(t *testing.T) {
+	client := apstest.NewService(2)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	model := scraperModel(ws.Arn)
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	}).OperationStatus)
+
+	read := &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	}).OperationStatus)
+	assert.Equal(t, model.ScraperId, read.ScraperId)
+	assert.NotEmpty(t, aws.StringValue(read.RoleArn))
+	assert.Equal(t, model.Source, read.Source)
+	assert.Equal(t, model.Destination, read.Destination)
+	assert.Equal(t, model.ScrapeConfiguration, read.ScrapeConfiguration)
+
+	// a tag-only update doesn't touch the scraper
+	retagged := *model
+	retagged.Tags = []Tag{{Key: aws.String("team"), Value: aws.String("b")}}
+	require.Equal(t, handler.Success, apstest.Run(t, &retagged, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, &retagged)
+	}).OperationStatus)
+	assert.Zero(t, client.Calls("UpdateScraper"))
+	assert.Equal(t, 1, client.Calls("TagResource"))
+
+	// the same configuration without padding is not a change either
+	unpadded := retagged
+	unpadded.ScrapeConfiguration = &ScrapeConfiguration{
+		ConfigurationBlob: aws.String(base64.RawStdEncoding.EncodeToString([]byte(testScrapeConfiguration))),
+	}
+	require.Equal(t, handler.Success, apstest.Run(t, &unpadded, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, &retagged, &unpadded)
+	}).OperationStatus)
+	assert.Zero(t, client.Calls("UpdateScraper"))
+
+	other, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	updated := unpadded
+	updated.Alias = aws.String("renamed")
+	updated.Destination = &Destination{AmpConfiguration: &AmpConfiguration{WorkspaceArn: other.Arn}}
+	updated.ScrapeConfiguration = &ScrapeConfiguration{
+		ConfigurationBlob: aws.String(base64.StdEncoding.EncodeToString([]byte("scrape_configs: []\n"))),
+	}
+	evt := apstest.Run(t, &updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, &unpadded, &updated)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, messageUpdateComplete, evt.Message)
+	assert.Equal(t, 1, client.Calls("UpdateScraper"))
+
+	read = &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	}).OperationStatus)
+	assert.Equal(t, "renamed", aws.StringValue(read.Alias))
+	assert.Equal(t, other.Arn, read.Destination.AmpConfiguration.WorkspaceArn)
+	assert.Equal(t, updated.ScrapeConfiguration, read.ScrapeConfiguration)
+	assert.Equal(t, "b", aws.StringValue(read.Tags[0].Value))
+}
+
+func TestUpdate_unchangedInvalidConfiguration(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	// a scraper created before its configuration was validated
+	config := []byte("scrape_configs:\n  - job_name: pods\n    ec2_sd_configs: []\n")
+	model := scraperModel(ws.Arn)
+	model.ScrapeConfiguration.ConfigurationBlob = aws.String(base64.StdEncoding.EncodeToString(config))
+	sc, err := client.CreateScraper(&prometheusservice.CreateScraperInput{
+		Alias: model.Alias,
+		Source: &prometheusservice.Source{EksConfiguration: &prometheusservice.EksConfiguration{
+			ClusterArn: model.Source.EksConfiguration.ClusterArn,
+			SubnetIds:  aws.StringSlice(model.Source.EksConfiguration.SubnetIds),
+		}},
+		Destination:         &prometheusservice.Destination{AmpConfiguration: &prometheusservice.AmpConfiguration{WorkspaceArn: ws.Arn}},
+		ScrapeConfiguration: &prometheusservice.ScrapeConfiguration{ConfigurationBlob: config},
+	})
+	require.NoError(t, err)
+	model.Arn = sc.Arn
+	// the scraper settles once it is described
+	_, err = client.DescribeScraper(&prometheusservice.DescribeScraperInput{ScraperId: sc.ScraperId})
+	require.NoError(t, err)
+
+	renamed := *model
+	renamed.Alias = aws.String("renamed")
+	evt := apstest.Run(t, &renamed, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, &renamed)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus, evt.Message)
+	assert.Equal(t, 1, client.Calls("UpdateScraper"))
+}
+
+func TestList(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	model := scraperModel(ws.Arn)
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	}).OperationStatus)
+
+	evt, err := List(handler.Request{}, nil, &Model{})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	require.Len(t, evt.ResourceModels, 1)
+	listed := evt.ResourceModels[0].(Model)
+	assert.Equal(t, model.Arn, listed.Arn)
+	assert.Equal(t, model.Source, listed.Source)
+	assert.Equal(t, model.Destination, listed.Destination)
+}
+
+func TestCreate_validation(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		modify  func(*Model)
+		code    string
+		message string
+	}{
+		{
+			"missing source",
+			func(m *Model) { m.Source = nil },
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			"invalid Source: EksConfiguration must be set",
+		},
+		{
+			"missing subnets",
+			func(m *Model) { m.Source.EksConfiguration.SubnetIds = nil },
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			"invalid Source: EksConfiguration.SubnetIds must not be empty",
+		},
+		{
+			"destination is not a workspace",
+			func(m *Model) {
+				m.Destination.AmpConfiguration.WorkspaceArn = aws.String("arn:aws:aps:us-west-2:111111111111:scraper/s-1")
+			},
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			`invalid Destination: invalid resource type "scraper" in "arn:aws:aps:us-west-2:111111111111:scraper/s-1": expected workspace`,
+		},
+		{
+			"configuration not base64",
+			func(m *Model) { m.ScrapeConfiguration.ConfigurationBlob = aws.String(testScrapeConfiguration) },
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			"invalid ScrapeConfiguration: configuration blob is not valid base64: illegal base64 data at input byte 6",
+		},
+		{
+			"invalid scrape configuration",
+			func(m *Model) {
+				m.ScrapeConfiguration.ConfigurationBlob = aws.String(base64.StdEncoding.EncodeToString([]byte("scrape_configs:\n  - job_name: pods\n    ec2_sd_configs: []\n")))
+			},
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			`invalid ScrapeConfiguration: scrape_configs[0] "pods": ec2_sd_configs: service discovery is not supported by managed collectors`,
+		},
+		{
+			"missing workspace",
+			func(m *Model) {
+				m.Destination.AmpConfiguration.WorkspaceArn = aws.String("arn:aws:aps:us-west-2:111111111111:workspace/ws-missing")
+			},
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			"ValidationException: Invalid destination. Invalid properties: /properties/Destination/AmpConfiguration/WorkspaceArn (workspace arn:aws:aps:us-west-2:111111111111:workspace/ws-missing does not exist)",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			model := scraperModel(ws.Arn)
+			tc.modify(model)
+			evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+				return Create(req, nil, model)
+			})
+			assert.Equal(t, handler.Failed, evt.OperationStatus)
+			assert.Equal(t, tc.code, evt.HandlerErrorCode)
+			assert.Equal(t, tc.message, evt.Message)
+		})
+	}
+	assert.Equal(t, 1, client.Calls("CreateScraper"))
+}
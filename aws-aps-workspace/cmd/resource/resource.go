@@ -1,36 +1,110 @@
 package resource
 
 import (
+	"errors"
 	"fmt"
 	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/cfnerr"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/service/prometheusservice"
 )
 
 const (
-	defaultCallbackSeconds             = 2
-	waitForWorkspaceStatusKey          = "Arn" // for backwards compatibility during release
-	waitForAlertManagerStatusActiveKey = "waitForAlertManagerActive"
-	waitForAlertManagerStatusDeleteKey = "waitForAlertManagerDeleted"
+	phaseWaitForWorkspace              internal.Phase = "WaitForWorkspace"
+	phaseWaitForWorkspaceConfiguration internal.Phase = "WaitForWorkspaceConfiguration"
+	phaseWaitForAlertManagerActive     internal.Phase = "WaitForAlertManagerActive"
+	phaseWaitForAlertManagerDeleted    internal.Phase = "WaitForAlertManagerDeleted"
+	phaseWaitForLoggingActive          internal.Phase = "WaitForLoggingActive"
+	phaseWaitForLoggingDeleted         internal.Phase = "WaitForLoggingDeleted"
+	phaseWaitForResourcePolicyActive   internal.Phase = "WaitForResourcePolicyActive"
+	phaseWaitForResourcePolicyDeleted  internal.Phase = "WaitForResourcePolicyDeleted"
 
 	messageUpdateComplete = "Update Completed"
 	messageCreateComplete = "Create Completed"
-	messageInProgress     = "In Progress"
 )
 
-var alertManagerFailedStates = map[string]struct{}{
-	prometheusservice.AlertManagerDefinitionStatusCodeCreationFailed: {},
-	prometheusservice.AlertManagerDefinitionStatusCodeUpdateFailed:   {},
+// legacyCallbackPhases maps the keys of the unversioned callback context to
+// the phase they stand for, for backwards compatibility during release.
+var legacyCallbackPhases = map[string]internal.Phase{
+	"Arn":                        phaseWaitForWorkspace,
+	"waitForAlertManagerActive":  phaseWaitForAlertManagerActive,
+	"waitForAlertManagerDeleted": phaseWaitForAlertManagerDeleted,
+}
+
+// poller schedules the callbacks that wait for each phase to complete.
+var poller = internal.NewPoller(map[internal.Phase]time.Duration{
+	phaseWaitForWorkspace:              30 * time.Minute,
+	phaseWaitForWorkspaceConfiguration: 15 * time.Minute,
+	phaseWaitForAlertManagerActive:     15 * time.Minute,
+	phaseWaitForAlertManagerDeleted:    15 * time.Minute,
+	phaseWaitForLoggingActive:          15 * time.Minute,
+	phaseWaitForLoggingDeleted:         15 * time.Minute,
+	phaseWaitForResourcePolicyActive:   15 * time.Minute,
+	phaseWaitForResourcePolicyDeleted:  15 * time.Minute,
+})
+
+// newClient builds the APS client for a request. Tests replace it with a fake.
+var newClient internal.ClientFactory = internal.NewClient
+
+// resourceType names the resource in metrics.
+const resourceType = "AWS::APS::Workspace"
+
+// The property paths of the fields of the requests that configure a workspace,
+// for reporting ValidationExceptions. Workspace requests themselves use the
+// names of their properties.
+var (
+	alertManagerPropertyPaths  = internal.PropertyPaths{"data": "/properties/AlertManagerDefinition"}
+	loggingPropertyPaths       = internal.PropertyPaths{"logGroupArn": "/properties/LoggingConfiguration/LogGroupArn"}
+	configurationPropertyPaths = internal.PropertyPaths{
+		"limitsPerLabelSet":     "/properties/WorkspaceConfiguration/LimitsPerLabelSets",
+		"retentionPeriodInDays": "/properties/WorkspaceConfiguration/RetentionPeriodInDays",
+	}
+	resourcePolicyPropertyPaths = internal.PropertyPaths{"policyDocument": "/properties/ResourcePolicy"}
+)
+
+// listWorkers bounds the concurrent describe calls of a hydrated List, and
+// listRateLimiter keeps all of them under the APS request rate.
+var (
+	listWorkers     = 4
+	listRateLimiter = internal.NewRateLimiter(10)
+)
+
+var configurationFailedStates = map[string]struct{}{
+	internal.WorkspaceConfigurationStatusCodeUpdateFailed: {},
+}
+
+var loggingFailedStates = map[string]struct{}{
+	prometheusservice.LoggingConfigurationStatusCodeCreationFailed: {},
+	prometheusservice.LoggingConfigurationStatusCodeUpdateFailed:   {},
+}
+
+// workspaceFailedStates are the terminal workspace states a handler can't
+// recover from. Workspaces have no UPDATE_FAILED state.
+var workspaceFailedStates = map[string]struct{}{
+	prometheusservice.WorkspaceStatusCodeCreationFailed: {},
 }
 
 // Create handles the Create event from the Cloudformation service.
 func Create(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
-	if currentModel.WorkspaceId != nil && len(req.CallbackContext) == 0 {
+	return internal.Invoke(resourceType, internal.ActionCreate, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return create(req, prevModel, currentModel)
+	})
+}
+
+func create(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, legacyCallbackPhases)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	if currentModel.WorkspaceId != nil && cbCtx == nil {
 		return handler.ProgressEvent{
 			OperationStatus:  handler.Failed,
 			Message:          "Invalid Create: cannot create a resource using readOnly workspaceId property",
@@ -38,74 +112,158 @@ func Create(req handler.Request, prevModel *Model, currentModel *Model) (handler
 		}, nil
 	}
 
-	client := internal.NewAPS(req.Session)
+	client := newClient(req, internal.ActionCreate)
 	// wait for workspace to be ACTIVE before managing alert manager configuration
-	if arn, ok := req.CallbackContext[waitForWorkspaceStatusKey]; ok {
-		currentModel.Arn = aws.String(arn.(string))
+	if cbCtx.InPhase(phaseWaitForWorkspace) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
 
 		evt, err := validateWorkspaceState(
 			client,
+			cbCtx,
 			currentModel,
 			prometheusservice.WorkspaceStatusCodeActive,
 			messageCreateComplete)
-		if evt.OperationStatus == handler.InProgress || currentModel.AlertManagerDefinition == nil {
+		if err != nil || evt.OperationStatus != handler.Success {
+			return evt, err
+		}
+		if workspaceConfigurationChanged(currentModel.WorkspaceConfiguration, nil) {
+			return updateWorkspaceConfiguration(client, currentModel)
+		}
+
+		return createAlertManagerDefinition(client, currentModel)
+	}
+
+	// the WorkspaceConfiguration is applied before anything is created in the workspace
+	if cbCtx.InPhase(phaseWaitForWorkspaceConfiguration) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+
+		evt, err := validateWorkspaceConfigurationState(client, cbCtx, currentModel, messageCreateComplete)
+		if err != nil || evt.OperationStatus != handler.Success {
+			return evt, err
+		}
+
+		return createAlertManagerDefinition(client, currentModel)
+	}
+
+	// the LoggingConfiguration is only created once the AlertManagerDefinition is ACTIVE
+	if cbCtx.InPhase(phaseWaitForAlertManagerActive) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+
+		evt, err := validateAlertManagerState(client,
+			cbCtx,
+			currentModel,
+			messageCreateComplete)
+		if err != nil || evt.OperationStatus != handler.Success {
 			return evt, err
 		}
 
-		return createAlertManagerDefinition(req, client, currentModel)
+		return manageLoggingConfiguration(currentModel, &Model{}, client, messageCreateComplete)
 	}
 
-	// AlertManagerDefinition is always created last. As such we have to continue waiting after the Workspace is created
-	if arn, ok := req.CallbackContext[waitForAlertManagerStatusActiveKey]; ok {
-		currentModel.Arn = aws.String(arn.(string))
+	if cbCtx.InPhase(phaseWaitForLoggingActive) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
 
-		return validateAlertManagerState(client,
+		evt, err := validateLoggingConfigurationState(client,
+			cbCtx,
 			currentModel,
-			prometheusservice.AlertManagerDefinitionStatusCodeActive,
+			prometheusservice.LoggingConfigurationStatusCodeActive,
 			messageCreateComplete)
+		if err != nil || evt.OperationStatus != handler.Success {
+			return evt, err
+		}
+
+		return manageResourcePolicy(currentModel, &Model{}, client, messageCreateComplete)
+	}
+
+	// ResourcePolicy is always created last
+	if cbCtx.InPhase(phaseWaitForResourcePolicyActive) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+
+		return validateResourcePolicyState(client, cbCtx, currentModel, messageCreateComplete)
+	}
+
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
+
+	if err := validateAlertManagerDefinition(currentModel.AlertManagerDefinition); err != nil {
+		return internal.NewFailedEvent(err)
+	}
+	if err := validateResourcePolicy(currentModel.ResourcePolicy); err != nil {
+		return internal.NewFailedEvent(err)
+	}
+	if currentModel.KmsKeyArn != nil {
+		// the workspace is created in the region of the request
+		region := req.RequestContext.Region
+		if err := internal.ValidateKMSKeyARN(*currentModel.KmsKeyArn, internal.PartitionForRegion(region), region); err != nil {
+			return internal.NewFailedEvent(internal.NewValidationError("KmsKeyArn", err))
+		}
 	}
 
 	resp, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{
-		Alias: currentModel.Alias,
-		Tags:  tagsToStringMap(currentModel.Tags),
+		Alias:     currentModel.Alias,
+		KmsKeyArn: currentModel.KmsKeyArn,
+		Tags:      tagsToStringMap(currentModel.Tags),
 	})
 	if err != nil {
-		return internal.NewFailedEvent(err)
+		return internal.NewFailedEvent(internal.WithCreateConflict(err))
 	}
 	currentModel.Arn = resp.Arn
 
-	return handler.ProgressEvent{
-		OperationStatus:      handler.InProgress,
-		Message:              messageInProgress,
-		ResourceModel:        currentModel,
-		CallbackDelaySeconds: defaultCallbackSeconds,
-		CallbackContext:      buildWaitForWorkspaceStatusCallbackContext(currentModel),
-	}, nil
+	return poller.Next(nil, phaseWaitForWorkspace, aws.StringValue(currentModel.Arn), currentModel), nil
 }
 
-func createAlertManagerDefinition(req handler.Request, client internal.APSService, currentModel *Model) (handler.ProgressEvent, error) {
+// validateAlertManagerDefinition checks a definition before it is sent to
+// APS, so mistakes fail the request instead of ending in CREATION_FAILED.
+func validateAlertManagerDefinition(definition *string) error {
+	if strings.TrimSpace(aws.StringValue(definition)) == "" {
+		return nil
+	}
+	if err := internal.ValidateAlertManagerDefinition(*definition); err != nil {
+		return internal.NewValidationError("AlertManagerDefinition", err)
+	}
+	return nil
+}
+
+// alertManagerDefinitionChanged reports whether an update adds, removes or
+// materially changes the AlertManagerDefinition. Reformatting it doesn't
+// count as a change.
+func alertManagerDefinitionChanged(current, previous *string) bool {
+	if current == nil || previous == nil {
+		return internal.StringDiffers(current, previous)
+	}
+	return !internal.AlertManagerDefinitionsEqual(*current, *previous)
+}
+
+// createAlertManagerDefinition starts creating the AlertManagerDefinition of a
+// new workspace, or moves on to its LoggingConfiguration when it has none.
+func createAlertManagerDefinition(client internal.APSService, currentModel *Model) (handler.ProgressEvent, error) {
+	if currentModel.AlertManagerDefinition == nil {
+		return manageLoggingConfiguration(currentModel, &Model{}, client, messageCreateComplete)
+	}
+
 	_, err := client.CreateAlertManagerDefinition(&prometheusservice.CreateAlertManagerDefinitionInput{
 		Data:        []byte(aws.StringValue(currentModel.AlertManagerDefinition)),
 		WorkspaceId: currentModel.WorkspaceId,
 	})
 
 	if err != nil {
-		return internal.NewFailedEvent(err)
+		return internal.NewFailedEvent(internal.WithCreateConflict(internal.WithPropertyPaths(err, alertManagerPropertyPaths)))
 	}
 
-	return handler.ProgressEvent{
-		OperationStatus:      handler.InProgress,
-		Message:              messageInProgress,
-		ResourceModel:        currentModel,
-		CallbackDelaySeconds: defaultCallbackSeconds,
-		CallbackContext:      buildWaitForAlertManagerStatusCallbackContext(currentModel, waitForAlertManagerStatusActiveKey),
-	}, nil
+	return poller.Next(nil, phaseWaitForAlertManagerActive, aws.StringValue(currentModel.Arn), currentModel), nil
 }
 
 // Read handles the Read event from the Cloudformation service.
 func Read(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionRead, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return read(req, prevModel, currentModel)
+	})
+}
+
+func read(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
 	// contract test: contract_read_without_create
-	if currentModel.Arn == nil {
+	if currentModel.Arn == nil && currentModel.WorkspaceId == nil && currentModel.Alias == nil {
 		return handler.ProgressEvent{
 			OperationStatus:  handler.Failed,
 			Message:          "Invalid Read: workspace Arn cannot be empty",
@@ -113,7 +271,12 @@ func Read(req handler.Request, prevModel *Model, currentModel *Model) (handler.P
 		}, nil
 	}
 
-	client := internal.NewAPS(req.Session)
+	client := newClient(req, internal.ActionRead)
+	if currentModel.Arn == nil {
+		if failed := resolveWorkspaceArn(req, client, currentModel); failed != nil {
+			return *failed, nil
+		}
+	}
 	if _, err := readWorkspace(client, currentModel); err != nil {
 		return internal.NewFailedEvent(err)
 	}
@@ -126,6 +289,21 @@ func Read(req handler.Request, prevModel *Model, currentModel *Model) (handler.P
 			return internal.NewFailedEvent(err)
 		}
 	}
+	if _, err := readWorkspaceConfiguration(client, currentModel); err != nil {
+		return internal.NewFailedEvent(err)
+	}
+	if _, err := readLoggingConfiguration(client, currentModel); err != nil {
+		if !internal.IsNotFound(err) {
+			return internal.NewFailedEvent(err)
+		}
+		currentModel.LoggingConfiguration = nil
+	}
+	if _, err := readResourcePolicy(client, currentModel); err != nil {
+		if !internal.IsNotFound(err) {
+			return internal.NewFailedEvent(err)
+		}
+		currentModel.ResourcePolicy = nil
+	}
 
 	return handler.ProgressEvent{
 		OperationStatus: handler.Success,
@@ -134,8 +312,75 @@ func Read(req handler.Request, prevModel *Model, currentModel *Model) (handler.P
 	}, nil
 }
 
+// resolveWorkspaceArn sets the Arn of a model that only identifies its
+// workspace by WorkspaceId or Alias, as resource import does. It returns the
+// event to fail with when the workspace can't be resolved.
+func resolveWorkspaceArn(req handler.Request, client internal.APSService, currentModel *Model) *handler.ProgressEvent {
+	if currentModel.WorkspaceId != nil {
+		region := req.RequestContext.Region
+		workspaceARN := internal.NewWorkspaceARN(internal.PartitionForRegion(region), region, req.RequestContext.AccountID, *currentModel.WorkspaceId)
+		if _, err := internal.ParseWorkspaceARN(workspaceARN.String()); err != nil {
+			return &handler.ProgressEvent{
+				OperationStatus:  handler.Failed,
+				Message:          fmt.Sprintf("Invalid Read: invalid WorkspaceId %q", *currentModel.WorkspaceId),
+				HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+			}
+		}
+		currentModel.Arn = aws.String(workspaceARN.String())
+		return nil
+	}
+
+	// the alias filter matches prefixes, so look for exact matches
+	var matches []*prometheusservice.WorkspaceSummary
+	input := &prometheusservice.ListWorkspacesInput{Alias: currentModel.Alias}
+	for {
+		resp, err := client.ListWorkspaces(input)
+		if err != nil {
+			failed, _ := internal.NewFailedEvent(err)
+			return &failed
+		}
+		for _, ws := range resp.Workspaces {
+			if aws.StringValue(ws.Alias) == *currentModel.Alias {
+				matches = append(matches, ws)
+			}
+		}
+		if resp.NextToken == nil {
+			break
+		}
+		input.NextToken = resp.NextToken
+	}
+
+	switch len(matches) {
+	case 0:
+		return &handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          fmt.Sprintf("Invalid Read: no workspace has alias %q", *currentModel.Alias),
+			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		}
+	case 1:
+		currentModel.Arn = matches[0].Arn
+		return nil
+	}
+
+	ids := make([]string, 0, len(matches))
+	for _, ws := range matches {
+		ids = append(ids, aws.StringValue(ws.WorkspaceId))
+	}
+	return &handler.ProgressEvent{
+		OperationStatus:  handler.Failed,
+		Message:          fmt.Sprintf("Invalid Read: alias %q is used by workspaces %s, read by WorkspaceId instead", *currentModel.Alias, strings.Join(ids, ", ")),
+		HandlerErrorCode: cloudformation.HandlerErrorCodeInvalidRequest,
+	}
+}
+
 // Update handles the Update event from the Cloudformation service.
 func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionUpdate, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return update(req, prevModel, currentModel)
+	})
+}
+
+func update(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
 	// contract test: contract_read_without_create
 	if currentModel.Arn == nil {
 		return handler.ProgressEvent{
@@ -145,9 +390,14 @@ func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler
 		}, nil
 	}
 
-	client := internal.NewAPS(req.Session)
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, legacyCallbackPhases)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionUpdate)
 
-	_, workspaceID, err := internal.ParseARN(*currentModel.Arn)
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Arn)
 	if err != nil {
 		return handler.ProgressEvent{
 			OperationStatus:  handler.Failed,
@@ -156,57 +406,133 @@ func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler
 		}, nil
 	}
 
-	currentModel.WorkspaceId = aws.String(workspaceID)
+	currentModel.WorkspaceId = aws.String(workspaceARN.WorkspaceID)
 
-	if arn, ok := req.CallbackContext[waitForWorkspaceStatusKey]; ok {
-		currentModel.Arn = aws.String(arn.(string))
+	if cbCtx.InPhase(phaseWaitForWorkspace) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
 
 		evt, err := validateWorkspaceState(
 			client,
+			cbCtx,
 			currentModel,
 			prometheusservice.WorkspaceStatusCodeActive,
 			messageUpdateComplete)
-		if err != nil {
-			return internal.NewFailedEvent(err)
+		if err != nil || evt.OperationStatus != handler.Success {
+			return evt, err
 		}
 
-		if evt.OperationStatus == handler.InProgress {
-			return evt, err
+		if workspaceConfigurationChanged(currentModel.WorkspaceConfiguration, prevModel.WorkspaceConfiguration) {
+			return updateWorkspaceConfiguration(client, currentModel)
 		}
 
-		if !internal.StringDiffers(currentModel.AlertManagerDefinition, prevModel.AlertManagerDefinition) {
+		return manageAlertManagerDefinition(currentModel, prevModel, client)
+	}
+
+	if cbCtx.InPhase(phaseWaitForWorkspaceConfiguration) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+
+		evt, err := validateWorkspaceConfigurationState(client, cbCtx, currentModel, messageUpdateComplete)
+		if err != nil || evt.OperationStatus != handler.Success {
 			return evt, err
 		}
 
 		return manageAlertManagerDefinition(currentModel, prevModel, client)
 	}
 
-	// AlertManagerDefinition is always updated last. As such we have to continue waiting after the Workspace is in ACTIVE state again
-	if arn, ok := req.CallbackContext[waitForAlertManagerStatusActiveKey]; ok {
-		currentModel.Arn = aws.String(arn.(string))
+	// the LoggingConfiguration is only updated once the AlertManagerDefinition has settled
+	if cbCtx.InPhase(phaseWaitForAlertManagerActive) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
 
-		return validateAlertManagerState(client,
+		evt, err := validateAlertManagerState(client,
+			cbCtx,
 			currentModel,
-			prometheusservice.AlertManagerDefinitionStatusCodeActive,
 			messageUpdateComplete)
+		if err != nil || evt.OperationStatus != handler.Success {
+			return evt, err
+		}
+
+		return manageLoggingConfiguration(currentModel, prevModel, client, messageUpdateComplete)
 	}
 
-	if arn, ok := req.CallbackContext[waitForAlertManagerStatusDeleteKey]; ok {
-		currentModel.Arn = aws.String(arn.(string))
+	if cbCtx.InPhase(phaseWaitForAlertManagerDeleted) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
 
-		return validateAlertManagerDeleted(client,
+		evt, err := validateAlertManagerDeleted(client,
+			cbCtx,
 			currentModel,
 			messageUpdateComplete)
+		if err != nil || evt.OperationStatus != handler.Success {
+			return evt, err
+		}
+
+		return manageLoggingConfiguration(currentModel, prevModel, client, messageUpdateComplete)
+	}
+
+	if cbCtx.InPhase(phaseWaitForLoggingActive) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+
+		evt, err := validateLoggingConfigurationState(client,
+			cbCtx,
+			currentModel,
+			prometheusservice.LoggingConfigurationStatusCodeActive,
+			messageUpdateComplete)
+		if err != nil || evt.OperationStatus != handler.Success {
+			return evt, err
+		}
+
+		return manageResourcePolicy(currentModel, prevModel, client, messageUpdateComplete)
+	}
+
+	if cbCtx.InPhase(phaseWaitForLoggingDeleted) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+
+		evt, err := validateLoggingConfigurationDeleted(client,
+			cbCtx,
+			currentModel,
+			messageUpdateComplete)
+		if err != nil || evt.OperationStatus != handler.Success {
+			return evt, err
+		}
+
+		return manageResourcePolicy(currentModel, prevModel, client, messageUpdateComplete)
+	}
+
+	// ResourcePolicy is always updated last
+	if cbCtx.InPhase(phaseWaitForResourcePolicyActive) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+
+		return validateResourcePolicyState(client, cbCtx, currentModel, messageUpdateComplete)
+	}
+
+	if cbCtx.InPhase(phaseWaitForResourcePolicyDeleted) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+
+		return validateResourcePolicyDeleted(client, cbCtx, currentModel, messageUpdateComplete)
+	}
+
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
+
+	if alertManagerDefinitionChanged(currentModel.AlertManagerDefinition, prevModel.AlertManagerDefinition) {
+		if err := validateAlertManagerDefinition(currentModel.AlertManagerDefinition); err != nil {
+			return internal.NewFailedEvent(err)
+		}
+	}
+	if resourcePolicyChanged(currentModel.ResourcePolicy, prevModel.ResourcePolicy) {
+		if err := validateResourcePolicy(currentModel.ResourcePolicy); err != nil {
+			return internal.NewFailedEvent(err)
+		}
 	}
 
 	if internal.StringDiffers(currentModel.Alias, prevModel.Alias) {
 		_, err = client.
 			UpdateWorkspaceAlias(&prometheusservice.UpdateWorkspaceAliasInput{
-				WorkspaceId: aws.String(workspaceID),
+				WorkspaceId: aws.String(workspaceARN.WorkspaceID),
 				Alias:       currentModel.Alias,
 			})
 		if err != nil {
-			return internal.NewFailedEvent(err)
+			return internal.NewFailedEvent(internal.WithBusyConflict(err))
 		}
 	}
 
@@ -217,7 +543,7 @@ func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler
 			TagKeys:     toRemove,
 		})
 		if err != nil {
-			return internal.NewFailedEvent(err)
+			return internal.NewFailedEvent(internal.WithBusyConflict(err))
 		}
 	}
 
@@ -227,17 +553,11 @@ func Update(req handler.Request, prevModel *Model, currentModel *Model) (handler
 			Tags:        toAdd,
 		})
 		if err != nil {
-			return internal.NewFailedEvent(err)
+			return internal.NewFailedEvent(internal.WithBusyConflict(err))
 		}
 	}
 
-	return handler.ProgressEvent{
-		OperationStatus:      handler.InProgress,
-		Message:              messageInProgress,
-		ResourceModel:        currentModel,
-		CallbackDelaySeconds: defaultCallbackSeconds,
-		CallbackContext:      buildWaitForWorkspaceStatusCallbackContext(currentModel),
-	}, nil
+	return poller.Next(nil, phaseWaitForWorkspace, aws.StringValue(currentModel.Arn), currentModel), nil
 }
 
 // manageAlertManagerDefinition handles AlertManagerDefinition state changes for UPDATE calls
@@ -245,20 +565,40 @@ func manageAlertManagerDefinition(
 	currentModel *Model,
 	prevModel *Model,
 	client internal.APSService) (handler.ProgressEvent, error) {
-	var err error
+	if !alertManagerDefinitionChanged(currentModel.AlertManagerDefinition, prevModel.AlertManagerDefinition) {
+		return manageLoggingConfiguration(currentModel, prevModel, client, messageUpdateComplete)
+	}
+
+	// a definition owned by an AWS::APS::AlertManagerDefinition resource is
+	// left alone: removing it from the template only stops managing it here
+	owned, err := alertManagerDefinitionOwned(client, currentModel)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+	if owned {
+		if currentModel.AlertManagerDefinition == nil {
+			return manageLoggingConfiguration(currentModel, prevModel, client, messageUpdateComplete)
+		}
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "AlertManagerDefinition is managed by an AWS::APS::AlertManagerDefinition resource",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeResourceConflict,
+		}, nil
+	}
 
 	shouldCreateAlertManagerDefinition := currentModel.AlertManagerDefinition != nil &&
 		prevModel.AlertManagerDefinition == nil &&
 		strings.TrimSpace(aws.StringValue(currentModel.AlertManagerDefinition)) != ""
 
 	shouldDeleteAlertManagerDefinition := currentModel.AlertManagerDefinition == nil
-	key := waitForAlertManagerStatusActiveKey
+	phase := phaseWaitForAlertManagerActive
 
 	if shouldCreateAlertManagerDefinition {
 		_, err = client.CreateAlertManagerDefinition(&prometheusservice.CreateAlertManagerDefinitionInput{
 			Data:        []byte(aws.StringValue(currentModel.AlertManagerDefinition)),
 			WorkspaceId: currentModel.WorkspaceId,
 		})
+		err = internal.WithCreateConflict(err)
 	} else if shouldDeleteAlertManagerDefinition {
 		_, err = client.DeleteAlertManagerDefinition(&prometheusservice.DeleteAlertManagerDefinitionInput{
 			WorkspaceId: currentModel.WorkspaceId,
@@ -270,29 +610,236 @@ func manageAlertManagerDefinition(
 				}
 			}
 		}
-		key = waitForAlertManagerStatusDeleteKey
+		err = internal.WithBusyConflict(err)
+		phase = phaseWaitForAlertManagerDeleted
 	} else {
 		_, err = client.PutAlertManagerDefinition(&prometheusservice.PutAlertManagerDefinitionInput{
 			Data:        []byte(aws.StringValue(currentModel.AlertManagerDefinition)),
 			WorkspaceId: currentModel.WorkspaceId,
 		})
+		err = internal.WithBusyConflict(err)
 	}
 
 	if err != nil {
-		return internal.NewFailedEvent(err)
+		return internal.NewFailedEvent(internal.WithPropertyPaths(err, alertManagerPropertyPaths))
 	}
 
-	return handler.ProgressEvent{
-		OperationStatus:      handler.InProgress,
-		Message:              messageInProgress,
-		ResourceModel:        currentModel,
-		CallbackDelaySeconds: defaultCallbackSeconds,
-		CallbackContext:      buildWaitForAlertManagerStatusCallbackContext(currentModel, key),
-	}, nil
+	return poller.Next(nil, phase, aws.StringValue(currentModel.Arn), currentModel), nil
+}
+
+// alertManagerDefinitionOwned reports whether the workspace has an
+// AlertManagerDefinition owned by an AWS::APS::AlertManagerDefinition resource.
+func alertManagerDefinitionOwned(client internal.APSService, currentModel *Model) (bool, error) {
+	data, err := client.DescribeAlertManagerDefinition(&prometheusservice.DescribeAlertManagerDefinitionInput{
+		WorkspaceId: currentModel.WorkspaceId,
+	})
+	if internal.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return internal.AlertManagerDefinitionOwned(string(data.AlertManagerDefinition.Data)), nil
+}
+
+// workspaceConfigurationChanged reports whether applying current instead of
+// previous changes the retention period or the label set limits. Leaving the
+// WorkspaceConfiguration out is the same as using the service defaults.
+func workspaceConfigurationChanged(current, previous *WorkspaceConfiguration) bool {
+	a, b := workspaceConfigurationInput(nil, current), workspaceConfigurationInput(nil, previous)
+	return aws.Int64Value(a.RetentionPeriodInDays) != aws.Int64Value(b.RetentionPeriodInDays) ||
+		!internal.LimitsPerLabelSetsEqual(a.LimitsPerLabelSet, b.LimitsPerLabelSet)
+}
+
+// workspaceConfigurationInput builds the request that applies config. Every
+// field is sent so that settings removed from the template are reset too.
+func workspaceConfigurationInput(workspaceID *string, config *WorkspaceConfiguration) *internal.UpdateWorkspaceConfigurationInput {
+	input := &internal.UpdateWorkspaceConfigurationInput{
+		WorkspaceId:           workspaceID,
+		LimitsPerLabelSet:     []*internal.LimitsPerLabelSet{},
+		RetentionPeriodInDays: aws.Int64(internal.DefaultRetentionPeriodInDays),
+	}
+	if config == nil {
+		return input
+	}
+
+	if config.RetentionPeriodInDays != nil {
+		input.RetentionPeriodInDays = aws.Int64(int64(*config.RetentionPeriodInDays))
+	}
+	for _, limits := range config.LimitsPerLabelSets {
+		labelSet := map[string]*string{}
+		for _, label := range limits.LabelSet {
+			labelSet[aws.StringValue(label.Name)] = label.Value
+		}
+		entry := &internal.LimitsPerLabelSetEntry{}
+		if limits.Limits != nil && limits.Limits.MaxSeries != nil {
+			entry.MaxSeries = aws.Int64(int64(*limits.Limits.MaxSeries))
+		}
+		input.LimitsPerLabelSet = append(input.LimitsPerLabelSet, &internal.LimitsPerLabelSet{
+			LabelSet: labelSet,
+			Limits:   entry,
+		})
+	}
+	return input
+}
+
+func updateWorkspaceConfiguration(client internal.APSService, currentModel *Model) (handler.ProgressEvent, error) {
+	_, err := client.UpdateWorkspaceConfiguration(workspaceConfigurationInput(currentModel.WorkspaceId, currentModel.WorkspaceConfiguration))
+	if err != nil {
+		return internal.NewFailedEvent(internal.WithBusyConflict(internal.WithPropertyPaths(err, configurationPropertyPaths)))
+	}
+
+	return poller.Next(nil, phaseWaitForWorkspaceConfiguration, aws.StringValue(currentModel.Arn), currentModel), nil
+}
+
+// manageLoggingConfiguration creates, updates or deletes the LoggingConfiguration
+// when it differs from prevModel, or moves on to the ResourcePolicy when there
+// is nothing to change.
+func manageLoggingConfiguration(
+	currentModel *Model,
+	prevModel *Model,
+	client internal.APSService,
+	successMessage string) (handler.ProgressEvent, error) {
+	current, previous := logGroupArn(currentModel.LoggingConfiguration), logGroupArn(prevModel.LoggingConfiguration)
+	if !internal.StringDiffers(current, previous) {
+		return manageResourcePolicy(currentModel, prevModel, client, successMessage)
+	}
+
+	var err error
+	phase := phaseWaitForLoggingActive
+
+	if previous == nil {
+		_, err = client.CreateLoggingConfiguration(&prometheusservice.CreateLoggingConfigurationInput{
+			LogGroupArn: current,
+			WorkspaceId: currentModel.WorkspaceId,
+		})
+		err = internal.WithCreateConflict(err)
+	} else if current == nil {
+		_, err = client.DeleteLoggingConfiguration(&prometheusservice.DeleteLoggingConfigurationInput{
+			WorkspaceId: currentModel.WorkspaceId,
+		})
+		if internal.IsNotFound(err) {
+			err = nil
+		}
+		err = internal.WithBusyConflict(err)
+		phase = phaseWaitForLoggingDeleted
+	} else {
+		_, err = client.UpdateLoggingConfiguration(&prometheusservice.UpdateLoggingConfigurationInput{
+			LogGroupArn: current,
+			WorkspaceId: currentModel.WorkspaceId,
+		})
+		err = internal.WithBusyConflict(err)
+	}
+
+	if err != nil {
+		return internal.NewFailedEvent(internal.WithPropertyPaths(err, loggingPropertyPaths))
+	}
+
+	return poller.Next(nil, phase, aws.StringValue(currentModel.Arn), currentModel), nil
+}
+
+func logGroupArn(config *LoggingConfiguration) *string {
+	if config == nil {
+		return nil
+	}
+	return config.LogGroupArn
+}
+
+// validateResourcePolicy checks a policy before it is sent to APS.
+func validateResourcePolicy(policy *string) error {
+	if policy == nil {
+		return nil
+	}
+	if err := internal.ValidateResourcePolicy(*policy); err != nil {
+		return internal.NewValidationError("ResourcePolicy", err)
+	}
+	return nil
+}
+
+// resourcePolicyChanged reports whether an update adds, removes or changes the
+// meaning of the ResourcePolicy.
+func resourcePolicyChanged(current, previous *string) bool {
+	if current == nil || previous == nil {
+		return internal.StringDiffers(current, previous)
+	}
+	return !internal.PolicyDocumentsEqual(*current, *previous)
+}
+
+// manageResourcePolicy puts or deletes the ResourcePolicy when it differs from
+// prevModel. A live policy that no longer matches prevModel was changed
+// outside of CloudFormation and fails the request instead of being
+// overwritten. The change is made against the revision that was compared, so
+// a policy changed in between fails the request too.
+func manageResourcePolicy(
+	currentModel *Model,
+	prevModel *Model,
+	client internal.APSService,
+	successMessage string) (handler.ProgressEvent, error) {
+	if !resourcePolicyChanged(currentModel.ResourcePolicy, prevModel.ResourcePolicy) {
+		return handler.ProgressEvent{
+			ResourceModel:   currentModel,
+			OperationStatus: handler.Success,
+			Message:         successMessage,
+		}, nil
+	}
+
+	var revisionID, livePolicy *string
+	live, describeErr := client.DescribeResourcePolicy(&internal.DescribeResourcePolicyInput{
+		WorkspaceId: currentModel.WorkspaceId,
+	})
+	if describeErr == nil {
+		revisionID = live.RevisionId
+		livePolicy = live.PolicyDocument
+	} else if !internal.IsNotFound(describeErr) {
+		return internal.NewFailedEvent(describeErr)
+	}
+
+	// a live policy that already matches the template, e.g. one that is
+	// already gone, is not a conflict
+	if resourcePolicyChanged(livePolicy, prevModel.ResourcePolicy) && resourcePolicyChanged(livePolicy, currentModel.ResourcePolicy) {
+		return handler.ProgressEvent{
+			OperationStatus:  handler.Failed,
+			Message:          "ResourcePolicy was changed outside of CloudFormation",
+			HandlerErrorCode: cloudformation.HandlerErrorCodeResourceConflict,
+		}, nil
+	}
+
+	var err error
+	phase := phaseWaitForResourcePolicyActive
+	if currentModel.ResourcePolicy == nil {
+		phase = phaseWaitForResourcePolicyDeleted
+		if revisionID != nil {
+			_, err = client.DeleteResourcePolicy(&internal.DeleteResourcePolicyInput{
+				RevisionId:  revisionID,
+				WorkspaceId: currentModel.WorkspaceId,
+			})
+			if internal.IsNotFound(err) {
+				err = nil
+			}
+		}
+	} else {
+		_, err = client.PutResourcePolicy(&internal.PutResourcePolicyInput{
+			PolicyDocument: currentModel.ResourcePolicy,
+			RevisionId:     revisionID,
+			WorkspaceId:    currentModel.WorkspaceId,
+		})
+	}
+
+	if err != nil {
+		return internal.NewFailedEvent(internal.WithPropertyPaths(err, resourcePolicyPropertyPaths))
+	}
+
+	return poller.Next(nil, phase, aws.StringValue(currentModel.Arn), currentModel), nil
 }
 
 // Delete handles the Delete event from the Cloudformation service.
 func Delete(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionDelete, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return delete(req, prevModel, currentModel)
+	})
+}
+
+func delete(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
 	if currentModel.Arn == nil {
 		return handler.ProgressEvent{
 			OperationStatus:  handler.Failed,
@@ -301,16 +848,38 @@ func Delete(req handler.Request, prevModel *Model, currentModel *Model) (handler
 		}, nil
 	}
 
-	client := internal.NewAPS(req.Session)
-	if _, ok := req.CallbackContext[waitForWorkspaceStatusKey]; ok {
-		currentModel.Arn = aws.String(req.CallbackContext[waitForWorkspaceStatusKey].(string))
+	cbCtx, err := internal.DecodeCallbackContext(req.CallbackContext, legacyCallbackPhases)
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	client := newClient(req, internal.ActionDelete)
+	if cbCtx.InPhase(phaseWaitForWorkspace) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
 		return validateWorkspaceDeleted(
 			client,
+			cbCtx,
 			currentModel,
 			"Delete Complete")
 	}
 
-	_, workspaceID, err := internal.ParseARN(*currentModel.Arn)
+	// the workspace is deleted once its LoggingConfiguration is gone
+	if cbCtx.InPhase(phaseWaitForLoggingDeleted) {
+		currentModel.Arn = aws.String(cbCtx.Arn)
+
+		evt, err := validateLoggingConfigurationDeleted(client, cbCtx, currentModel, "Delete Complete")
+		if err != nil || evt.OperationStatus != handler.Success {
+			return evt, err
+		}
+
+		return deleteWorkspace(client, currentModel)
+	}
+
+	if cbCtx != nil {
+		return internal.NewFailedEvent(cbCtx.UnexpectedPhaseError())
+	}
+
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Arn)
 	if err != nil {
 		return handler.ProgressEvent{
 			OperationStatus:  handler.Failed,
@@ -318,35 +887,40 @@ func Delete(req handler.Request, prevModel *Model, currentModel *Model) (handler
 			HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
 		}, nil
 	}
+	currentModel.WorkspaceId = aws.String(workspaceARN.WorkspaceID)
+
+	if currentModel.LoggingConfiguration != nil {
+		_, err = client.DeleteLoggingConfiguration(&prometheusservice.DeleteLoggingConfigurationInput{
+			WorkspaceId: currentModel.WorkspaceId,
+		})
+		if err == nil {
+			return poller.Next(nil, phaseWaitForLoggingDeleted, aws.StringValue(currentModel.Arn), currentModel), nil
+		}
+		if !internal.IsNotFound(err) {
+			return internal.NewFailedEvent(internal.WithBusyConflict(err))
+		}
+	}
 
+	return deleteWorkspace(client, currentModel)
+}
+
+func deleteWorkspace(client internal.APSService, currentModel *Model) (handler.ProgressEvent, error) {
 	// no need to delete AlertManagerDefinition here, because APSService deletes this when the workspace is deleted
-	_, err = client.
+	_, err := client.
 		DeleteWorkspace(&prometheusservice.DeleteWorkspaceInput{
-			WorkspaceId: aws.String(workspaceID),
+			WorkspaceId: currentModel.WorkspaceId,
 		})
 	if err != nil {
-		return internal.NewFailedEvent(err)
+		return internal.NewFailedEvent(internal.WithBusyConflict(err))
 	}
 
-	return handler.ProgressEvent{
-		OperationStatus:      handler.InProgress,
-		Message:              messageInProgress,
-		ResourceModel:        currentModel,
-		CallbackDelaySeconds: defaultCallbackSeconds,
-		CallbackContext:      buildWaitForWorkspaceStatusCallbackContext(currentModel),
-	}, nil
+	return poller.Next(nil, phaseWaitForWorkspace, aws.StringValue(currentModel.Arn), currentModel), nil
 }
 
-func validateWorkspaceDeleted(client internal.APSService, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+func validateWorkspaceDeleted(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
 	_, err := readWorkspace(client, currentModel)
 	if err == nil {
-		return handler.ProgressEvent{
-			ResourceModel:        currentModel,
-			OperationStatus:      handler.InProgress,
-			Message:              messageInProgress,
-			CallbackDelaySeconds: defaultCallbackSeconds,
-			CallbackContext:      buildWaitForWorkspaceStatusCallbackContext(currentModel),
-		}, nil
+		return poller.Next(cbCtx, phaseWaitForWorkspace, aws.StringValue(currentModel.Arn), currentModel), nil
 	}
 
 	if awsErr, ok := err.(awserr.Error); ok {
@@ -358,31 +932,39 @@ func validateWorkspaceDeleted(client internal.APSService, currentModel *Model, s
 		}
 	}
 
-	return handler.ProgressEvent{}, err
+	return internal.NewFailedEvent(err)
 }
 
 // List handles the List event from the Cloudformation service.
 func List(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
+	return internal.Invoke(resourceType, internal.ActionList, req, currentModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return list(req, prevModel, currentModel)
+	})
+}
+
+func list(req handler.Request, prevModel *Model, currentModel *Model) (handler.ProgressEvent, error) {
 	var nextToken *string
 
 	if req.RequestContext.NextToken != "" {
 		nextToken = &req.RequestContext.NextToken
 	}
 
-	resp, err := internal.NewAPS(req.Session).ListWorkspaces(&prometheusservice.ListWorkspacesInput{
+	options, err := decodeListOptions(req)
+	if err != nil {
+		return internal.NewFailedEvent(internal.NewValidationError("HydrateResults", err))
+	}
+
+	client := newClient(req, internal.ActionList)
+	resp, err := client.ListWorkspaces(&prometheusservice.ListWorkspacesInput{
 		NextToken: nextToken,
 	})
 	if err != nil {
-		return handler.ProgressEvent{
-			OperationStatus:  handler.Failed,
-			Message:          "Internal Failure",
-			HandlerErrorCode: cloudformation.HandlerErrorCodeGeneralServiceException,
-		}, err
+		return internal.NewFailedEvent(err)
 	}
 
-	models := make([]interface{}, 0, len(resp.Workspaces))
+	workspaces := make([]Model, 0, len(resp.Workspaces))
 	for _, ws := range resp.Workspaces {
-		models = append(models, Model{
+		workspaces = append(workspaces, Model{
 			WorkspaceId: ws.WorkspaceId,
 			Alias:       ws.Alias,
 			Arn:         ws.Arn,
@@ -390,6 +972,16 @@ func List(req handler.Request, prevModel *Model, currentModel *Model) (handler.P
 		})
 	}
 
+	message := "List complete"
+	if aws.BoolValue(options.HydrateResults) {
+		message = hydrateWorkspaces(client, workspaces)
+	}
+
+	models := make([]interface{}, 0, len(workspaces))
+	for _, ws := range workspaces {
+		models = append(models, ws)
+	}
+
 	var responseNextToken string
 	if resp.NextToken != nil {
 		responseNextToken = *resp.NextToken
@@ -397,28 +989,85 @@ func List(req handler.Request, prevModel *Model, currentModel *Model) (handler.P
 
 	return handler.ProgressEvent{
 		OperationStatus: handler.Success,
-		Message:         "List complete",
+		Message:         message,
 		ResourceModels:  models,
 		NextToken:       responseNextToken,
 	}, nil
 }
 
+// listOptions are the properties of the List handlerSchema. They aren't
+// resource properties, so they are decoded from the request instead of the
+// Model.
+type listOptions struct {
+	// HydrateResults makes List describe every listed workspace to report its
+	// PrometheusEndpoint and AlertManagerDefinition, which workspace summaries
+	// lack.
+	HydrateResults *bool `json:",omitempty"`
+}
+
+// decodeListOptions returns the options of a List request. A request without
+// properties lists plain summaries.
+func decodeListOptions(req handler.Request) (listOptions, error) {
+	var options listOptions
+	err := req.Unmarshal(&options)
+	var bodyErr cfnerr.Error
+	if errors.As(err, &bodyErr) && bodyErr.Code() == "BodyEmpty" {
+		return options, nil
+	}
+	return options, err
+}
+
+// hydrateWorkspaces describes the listed workspaces concurrently, filling in
+// what their summaries lack. A workspace that can't be described keeps its
+// summary and is reported in the returned message, so one failure doesn't
+// lose the page.
+func hydrateWorkspaces(client internal.APSService, workspaces []Model) string {
+	errs := internal.RunBounded(len(workspaces), listWorkers, listRateLimiter, func(i int) error {
+		hydrated := workspaces[i]
+		status, err := readWorkspace(client, &hydrated)
+		if err != nil {
+			return err
+		}
+		// only an ACTIVE workspace can be asked for its definition
+		if aws.StringValue(status.StatusCode) == prometheusservice.WorkspaceStatusCodeActive {
+			listRateLimiter.Wait()
+			if _, err := readAlertManagerDefinition(client, &hydrated); err != nil && !internal.IsNotFound(err) {
+				return err
+			}
+		}
+		workspaces[i] = hydrated
+		return nil
+	})
+
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", aws.StringValue(workspaces[i].WorkspaceId), internal.ClassifyError(err)))
+		}
+	}
+	if len(failures) == 0 {
+		return "List complete"
+	}
+	return fmt.Sprintf("List complete, %d of %d workspaces could not be described: %s", len(failures), len(workspaces), strings.Join(failures, "; "))
+}
+
 func readWorkspace(client internal.APSService, currentModel *Model) (*prometheusservice.WorkspaceStatus, error) {
-	_, workspaceID, err := internal.ParseARN(*currentModel.Arn)
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Arn)
 	if err != nil {
 		return nil, err
 	}
 	data, err := client.DescribeWorkspace(&prometheusservice.DescribeWorkspaceInput{
-		WorkspaceId: aws.String(workspaceID),
+		WorkspaceId: aws.String(workspaceARN.WorkspaceID),
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	currentModel.WorkspaceId = &workspaceID
+	currentModel.WorkspaceId = aws.String(workspaceARN.WorkspaceID)
 	currentModel.Arn = data.Workspace.Arn
 	currentModel.PrometheusEndpoint = data.Workspace.PrometheusEndpoint
 	currentModel.Alias = data.Workspace.Alias
+	currentModel.KmsKeyArn = data.Workspace.KmsKeyArn
 	currentModel.Tags = stringMapToTags(data.Workspace.Tags)
 
 	return data.Workspace.Status, nil
@@ -428,53 +1077,125 @@ func readAlertManagerDefinition(
 	client internal.APSService,
 	currentModel *Model,
 ) (*prometheusservice.AlertManagerDefinitionStatus, error) {
-	_, workspaceID, err := internal.ParseARN(*currentModel.Arn)
+	workspaceARN, err := internal.ParseWorkspaceARN(*currentModel.Arn)
 	if err != nil {
 		return nil, err
 	}
 
 	data, err := client.DescribeAlertManagerDefinition(&prometheusservice.DescribeAlertManagerDefinitionInput{
-		WorkspaceId: aws.String(workspaceID),
+		WorkspaceId: aws.String(workspaceARN.WorkspaceID),
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	currentModel.AlertManagerDefinition = aws.String(string(data.AlertManagerDefinition.Data))
+	setAlertManagerDefinition(currentModel, data.AlertManagerDefinition)
 	return data.AlertManagerDefinition.Status, nil
 }
 
-func validateAlertManagerState(client internal.APSService, currentModel *Model, targetState string, successMessage string) (handler.ProgressEvent, error) {
+// setAlertManagerDefinition sets the AlertManagerDefinition of currentModel
+// from the live definition.
+func setAlertManagerDefinition(currentModel *Model, definition *prometheusservice.AlertManagerDefinitionDescription) {
+	// keep the template's form of an equivalent definition so reformatting
+	// it doesn't show up as drift
+	live := string(definition.Data)
+	if internal.AlertManagerDefinitionOwned(live) {
+		// owned by an AWS::APS::AlertManagerDefinition resource, not this one
+		currentModel.AlertManagerDefinition = nil
+	} else if currentModel.AlertManagerDefinition == nil || !internal.AlertManagerDefinitionsEqual(*currentModel.AlertManagerDefinition, live) {
+		currentModel.AlertManagerDefinition = aws.String(live)
+	}
+}
+
+func validateAlertManagerState(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+	if _, err := readWorkspace(client, currentModel); err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	definition, evt, err := internal.WaitForAlertManagerDefinition(client, poller, cbCtx, phaseWaitForAlertManagerActive,
+		aws.StringValue(currentModel.Arn), currentModel.WorkspaceId, currentModel)
+	if evt != nil {
+		return *evt, err
+	}
+	setAlertManagerDefinition(currentModel, definition)
+
+	return handler.ProgressEvent{
+		ResourceModel:   currentModel,
+		OperationStatus: handler.Success,
+		Message:         successMessage,
+	}, nil
+}
+
+func readWorkspaceConfiguration(
+	client internal.APSService,
+	currentModel *Model,
+) (*internal.WorkspaceConfigurationStatus, error) {
+	data, err := client.DescribeWorkspaceConfiguration(&internal.DescribeWorkspaceConfigurationInput{
+		WorkspaceId: currentModel.WorkspaceId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	live := &WorkspaceConfiguration{}
+	if retention := data.WorkspaceConfiguration.RetentionPeriodInDays; retention != nil {
+		live.RetentionPeriodInDays = aws.Int(int(*retention))
+	}
+	for _, limits := range data.WorkspaceConfiguration.LimitsPerLabelSet {
+		live.LimitsPerLabelSets = append(live.LimitsPerLabelSets, limitsPerLabelSetFromAPI(limits))
+	}
+
+	// keep the template's form of an equivalent configuration so the order
+	// of the limits doesn't show up as drift
+	if workspaceConfigurationChanged(currentModel.WorkspaceConfiguration, live) {
+		currentModel.WorkspaceConfiguration = live
+	}
+	return data.WorkspaceConfiguration.Status, nil
+}
+
+func limitsPerLabelSetFromAPI(limits *internal.LimitsPerLabelSet) LimitsPerLabelSet {
+	names := make([]string, 0, len(limits.LabelSet))
+	for name := range limits.LabelSet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := LimitsPerLabelSet{LabelSet: []Label{}}
+	for _, name := range names {
+		res.LabelSet = append(res.LabelSet, Label{
+			Name:  aws.String(name),
+			Value: limits.LabelSet[name],
+		})
+	}
+	if limits.Limits != nil {
+		res.Limits = &LimitsPerLabelSetEntry{}
+		if maxSeries := limits.Limits.MaxSeries; maxSeries != nil {
+			res.Limits.MaxSeries = aws.Int(int(*maxSeries))
+		}
+	}
+	return res
+}
+
+func validateWorkspaceConfigurationState(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
 	_, err := readWorkspace(client, currentModel)
+	if internal.IsNotFound(err) {
+		return internal.NewDeletedOutOfBandEvent("Workspace", currentModel), nil
+	}
 	if err != nil {
-		return handler.ProgressEvent{}, err
+		return internal.NewFailedEvent(err)
 	}
 
-	state, err := readAlertManagerDefinition(client, currentModel)
+	state, err := readWorkspaceConfiguration(client, currentModel)
 	if err != nil {
-		return handler.ProgressEvent{
-			ResourceModel:   currentModel,
-			OperationStatus: handler.Failed,
-			Message:         "AlertManagerDefinition was deleted out-of-band",
-		}, err
+		return internal.NewFailedEvent(err)
 	}
 
-	if _, ok := alertManagerFailedStates[aws.StringValue(state.StatusCode)]; ok {
-		return handler.ProgressEvent{
-			ResourceModel:   currentModel,
-			OperationStatus: handler.Failed,
-			Message:         fmt.Sprintf("AlertManagerDefinition status: %s", aws.StringValue(state.StatusCode)),
-		}, err
+	if _, ok := configurationFailedStates[aws.StringValue(state.StatusCode)]; ok {
+		return internal.NewStatusFailedEvent("WorkspaceConfiguration", state.StatusCode, state.StatusReason, currentModel), nil
 	}
 
-	if aws.StringValue(state.StatusCode) != targetState {
-		return handler.ProgressEvent{
-			ResourceModel:        currentModel,
-			OperationStatus:      handler.InProgress,
-			Message:              messageInProgress,
-			CallbackDelaySeconds: defaultCallbackSeconds,
-			CallbackContext:      buildWaitForAlertManagerStatusCallbackContext(currentModel, waitForAlertManagerStatusActiveKey),
-		}, nil
+	if aws.StringValue(state.StatusCode) != internal.WorkspaceConfigurationStatusCodeActive {
+		return poller.Next(cbCtx, phaseWaitForWorkspaceConfiguration, aws.StringValue(currentModel.Arn), currentModel), nil
 	}
 
 	return handler.ProgressEvent{
@@ -484,22 +1205,42 @@ func validateAlertManagerState(client internal.APSService, currentModel *Model,
 	}, nil
 }
 
-func validateWorkspaceState(client internal.APSService, currentModel *Model, targetState string, successMessage string) (handler.ProgressEvent, error) {
-	state, err := readWorkspace(client, currentModel)
+func readLoggingConfiguration(
+	client internal.APSService,
+	currentModel *Model,
+) (*prometheusservice.LoggingConfigurationStatus, error) {
+	data, err := client.DescribeLoggingConfiguration(&prometheusservice.DescribeLoggingConfigurationInput{
+		WorkspaceId: currentModel.WorkspaceId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	currentModel.LoggingConfiguration = &LoggingConfiguration{
+		LogGroupArn: data.LoggingConfiguration.LogGroupArn,
+	}
+	return data.LoggingConfiguration.Status, nil
+}
+
+func validateLoggingConfigurationState(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, targetState string, successMessage string) (handler.ProgressEvent, error) {
+	if _, err := readWorkspace(client, currentModel); err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	state, err := readLoggingConfiguration(client, currentModel)
+	if internal.IsNotFound(err) {
+		return internal.NewDeletedOutOfBandEvent("LoggingConfiguration", currentModel), nil
+	}
 	if err != nil {
-		return handler.ProgressEvent{}, err
+		return internal.NewFailedEvent(err)
+	}
+
+	if _, ok := loggingFailedStates[aws.StringValue(state.StatusCode)]; ok {
+		return internal.NewStatusFailedEvent("LoggingConfiguration", state.StatusCode, state.StatusReason, currentModel), nil
 	}
 
 	if aws.StringValue(state.StatusCode) != targetState {
-		return handler.ProgressEvent{
-			ResourceModel: &Model{
-				Arn: currentModel.Arn,
-			},
-			OperationStatus:      handler.InProgress,
-			Message:              messageInProgress,
-			CallbackDelaySeconds: defaultCallbackSeconds,
-			CallbackContext:      buildWaitForWorkspaceStatusCallbackContext(currentModel),
-		}, nil
+		return poller.Next(cbCtx, phaseWaitForLoggingActive, aws.StringValue(currentModel.Arn), currentModel), nil
 	}
 
 	return handler.ProgressEvent{
@@ -509,16 +1250,111 @@ func validateWorkspaceState(client internal.APSService, currentModel *Model, tar
 	}, nil
 }
 
-func buildWaitForWorkspaceStatusCallbackContext(model *Model) map[string]interface{} {
-	return map[string]interface{}{
-		waitForWorkspaceStatusKey: aws.StringValue(model.Arn),
+func validateLoggingConfigurationDeleted(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+	if _, err := readWorkspace(client, currentModel); err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	_, err := readLoggingConfiguration(client, currentModel)
+	if err == nil {
+		return poller.Next(cbCtx, phaseWaitForLoggingDeleted, aws.StringValue(currentModel.Arn), currentModel), nil
+	}
+	if !internal.IsNotFound(err) {
+		return internal.NewFailedEvent(err)
 	}
+
+	currentModel.LoggingConfiguration = nil
+	return handler.ProgressEvent{
+		OperationStatus: handler.Success,
+		Message:         successMessage,
+		ResourceModel:   currentModel,
+	}, nil
 }
 
-func buildWaitForAlertManagerStatusCallbackContext(model *Model, key string) map[string]interface{} {
-	return map[string]interface{}{
-		key: aws.StringValue(model.Arn),
+func readResourcePolicy(client internal.APSService, currentModel *Model) (*string, error) {
+	data, err := client.DescribeResourcePolicy(&internal.DescribeResourcePolicyInput{
+		WorkspaceId: currentModel.WorkspaceId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the template's form of an equivalent policy so key order doesn't
+	// show up as drift
+	live := aws.StringValue(data.PolicyDocument)
+	if currentModel.ResourcePolicy == nil || !internal.PolicyDocumentsEqual(*currentModel.ResourcePolicy, live) {
+		currentModel.ResourcePolicy = aws.String(live)
 	}
+	return data.PolicyStatus, nil
+}
+
+func validateResourcePolicyState(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+	if _, err := readWorkspace(client, currentModel); err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	status, err := readResourcePolicy(client, currentModel)
+	if internal.IsNotFound(err) {
+		return internal.NewDeletedOutOfBandEvent("ResourcePolicy", currentModel), nil
+	}
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	if aws.StringValue(status) != internal.WorkspacePolicyStatusCodeActive {
+		return poller.Next(cbCtx, phaseWaitForResourcePolicyActive, aws.StringValue(currentModel.Arn), currentModel), nil
+	}
+
+	return handler.ProgressEvent{
+		ResourceModel:   currentModel,
+		OperationStatus: handler.Success,
+		Message:         successMessage,
+	}, nil
+}
+
+func validateResourcePolicyDeleted(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+	if _, err := readWorkspace(client, currentModel); err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	_, err := readResourcePolicy(client, currentModel)
+	if err == nil {
+		return poller.Next(cbCtx, phaseWaitForResourcePolicyDeleted, aws.StringValue(currentModel.Arn), currentModel), nil
+	}
+	if !internal.IsNotFound(err) {
+		return internal.NewFailedEvent(err)
+	}
+
+	currentModel.ResourcePolicy = nil
+	return handler.ProgressEvent{
+		OperationStatus: handler.Success,
+		Message:         successMessage,
+		ResourceModel:   currentModel,
+	}, nil
+}
+
+func validateWorkspaceState(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, targetState string, successMessage string) (handler.ProgressEvent, error) {
+	state, err := readWorkspace(client, currentModel)
+	if internal.IsNotFound(err) {
+		return internal.NewDeletedOutOfBandEvent("Workspace", currentModel), nil
+	}
+	if err != nil {
+		return internal.NewFailedEvent(err)
+	}
+
+	if _, ok := workspaceFailedStates[aws.StringValue(state.StatusCode)]; ok {
+		return internal.NewStatusFailedEvent("Workspace", state.StatusCode, nil, currentModel), nil
+	}
+
+	if aws.StringValue(state.StatusCode) != targetState {
+		return poller.Next(cbCtx, phaseWaitForWorkspace, aws.StringValue(currentModel.Arn), currentModel), nil
+	}
+
+	return handler.ProgressEvent{
+		ResourceModel:   currentModel,
+		OperationStatus: handler.Success,
+		Message:         successMessage,
+	}, nil
 }
 
 func stringMapToTags(m map[string]*string) []Tag {
@@ -540,32 +1376,19 @@ func tagsToStringMap(tags []Tag) map[string]*string {
 	return result
 }
 
-func validateAlertManagerDeleted(client internal.APSService, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
-	_, err := readWorkspace(client, currentModel)
-	if err != nil {
-		return handler.ProgressEvent{}, err
-	}
-
-	_, err = readAlertManagerDefinition(client, currentModel)
-	if err == nil {
-		return handler.ProgressEvent{
-			ResourceModel:        currentModel,
-			OperationStatus:      handler.InProgress,
-			Message:              messageInProgress,
-			CallbackDelaySeconds: defaultCallbackSeconds,
-			CallbackContext:      buildWaitForAlertManagerStatusCallbackContext(currentModel, waitForAlertManagerStatusDeleteKey),
-		}, nil
+func validateAlertManagerDeleted(client internal.APSService, cbCtx *internal.CallbackContext, currentModel *Model, successMessage string) (handler.ProgressEvent, error) {
+	if _, err := readWorkspace(client, currentModel); err != nil {
+		return internal.NewFailedEvent(err)
 	}
 
-	if awsErr, ok := err.(awserr.Error); ok {
-		if awsErr.Code() == prometheusservice.ErrCodeResourceNotFoundException {
-			return handler.ProgressEvent{
-				OperationStatus: handler.Success,
-				Message:         successMessage,
-				ResourceModel:   currentModel,
-			}, nil
-		}
+	if evt, err := internal.WaitForAlertManagerDefinitionDeleted(client, poller, cbCtx, phaseWaitForAlertManagerDeleted,
+		aws.StringValue(currentModel.Arn), currentModel.WorkspaceId, currentModel); evt != nil {
+		return *evt, err
 	}
 
-	return handler.ProgressEvent{}, err
+	return handler.ProgressEvent{
+		OperationStatus: handler.Success,
+		Message:         successMessage,
+		ResourceModel:   currentModel,
+	}, nil
 }
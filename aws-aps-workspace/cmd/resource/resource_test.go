@@ -1,11 +1,19 @@
 package resource
 
 import (
+	"strings"
+	"testing"
+	"time"
+
 	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal"
+	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal/apstest"
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/prometheusservice"
-	"testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type MockPrometheusService struct {
@@ -33,7 +41,6 @@ func Test_validateAlertManagerState(t *testing.T) {
 	testCases := map[string]struct {
 		client        internal.APSService
 		status        handler.Status
-		targetState   string
 		targetMessage string
 	}{
 		"Should return Fail when status is failed": {
@@ -52,7 +59,6 @@ func Test_validateAlertManagerState(t *testing.T) {
 				},
 			},
 			status:        handler.InProgress,
-			targetState:   prometheusservice.AlertManagerDefinitionStatusCodeActive,
 			targetMessage: "In Progress",
 		},
 		"Should return Success when state is  target state": {
@@ -61,8 +67,7 @@ func Test_validateAlertManagerState(t *testing.T) {
 					StatusCode: aws.String(prometheusservice.AlertManagerDefinitionStatusCodeActive),
 				},
 			},
-			status:      handler.Success,
-			targetState: prometheusservice.AlertManagerDefinitionStatusCodeActive,
+			status: handler.Success,
 		},
 	}
 
@@ -72,7 +77,7 @@ func Test_validateAlertManagerState(t *testing.T) {
 
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			evt, err := validateAlertManagerState(tc.client, m, tc.targetState, "")
+			evt, err := validateAlertManagerState(tc.client, nil, m, "")
 			if err != nil {
 				t.Fatalf("Failed: %v", err)
 			}
@@ -86,3 +91,816 @@ func Test_validateAlertManagerState(t *testing.T) {
 		})
 	}
 }
+
+const testAlertManagerDefinition = `alertmanager_config: |
+  route:
+    receiver: default
+  receivers:
+    - name: default
+`
+
+func TestWorkspace_lifecycle(t *testing.T) {
+	client := apstest.NewService(2)
+	apstest.UseClient(t, &newClient, client)
+
+	model := &Model{
+		Alias:                  aws.String("alias"),
+		AlertManagerDefinition: aws.String(testAlertManagerDefinition),
+	}
+	evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, messageCreateComplete, evt.Message)
+	assert.Equal(t, 1, client.Calls("CreateAlertManagerDefinition"))
+
+	read := &Model{Arn: model.Arn}
+	evt = apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, "alias", aws.StringValue(read.Alias))
+	assert.Equal(t, testAlertManagerDefinition, aws.StringValue(read.AlertManagerDefinition))
+	assert.NotEmpty(t, aws.StringValue(read.PrometheusEndpoint))
+
+	updated := &Model{
+		Arn:                    model.Arn,
+		Alias:                  aws.String("renamed"),
+		AlertManagerDefinition: aws.String(strings.Replace(testAlertManagerDefinition, "default", "renamed", 2)),
+	}
+	evt = apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, 1, client.Calls("UpdateWorkspaceAlias"))
+	assert.Equal(t, 1, client.Calls("PutAlertManagerDefinition"))
+
+	removed := &Model{Arn: model.Arn, Alias: aws.String("renamed")}
+	evt = apstest.Run(t, removed, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, updated, removed)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, 1, client.Calls("DeleteAlertManagerDefinition"))
+
+	deleted := &Model{Arn: model.Arn}
+	evt = apstest.Run(t, deleted, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Delete(req, nil, deleted)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+
+	read = &Model{Arn: model.Arn}
+	evt = apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, evt.HandlerErrorCode)
+}
+
+func TestList(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{Alias: aws.String("alias")})
+	require.NoError(t, err)
+
+	evt, err := List(handler.Request{}, nil, &Model{})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	require.Len(t, evt.ResourceModels, 1)
+	assert.Equal(t, ws.Arn, evt.ResourceModels[0].(Model).Arn)
+	// plain summaries unless hydration is asked for
+	assert.Nil(t, evt.ResourceModels[0].(Model).PrometheusEndpoint)
+	assert.Equal(t, 0, client.Calls("DescribeWorkspace"))
+
+	client.InjectError("ListWorkspaces", &prometheusservice.ThrottlingException{Message_: aws.String("slow down")})
+	evt, err = List(handler.Request{}, nil, &Model{})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeThrottling, evt.HandlerErrorCode)
+	assert.Equal(t, "ThrottlingException: slow down", evt.Message)
+}
+
+func TestList_hydrated(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+	listRateLimiter = internal.NewRateLimiter(0)
+	t.Cleanup(func() { listRateLimiter = internal.NewRateLimiter(10) })
+
+	var arns []*string
+	for i := 0; i < 3; i++ {
+		ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+		require.NoError(t, err)
+		arns = append(arns, ws.Arn)
+	}
+	model := &Model{Arn: arns[0], AlertManagerDefinition: aws.String(testAlertManagerDefinition)}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, &Model{Arn: arns[0]}, model)
+	}).OperationStatus)
+
+	hydrate := func(nextToken string) handler.Request {
+		return handler.NewRequest("", nil, handler.RequestContext{NextToken: nextToken}, nil, nil, []byte(`{"HydrateResults":"true"}`))
+	}
+
+	evt, err := List(hydrate(""), nil, &Model{})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, "List complete", evt.Message)
+	require.Len(t, evt.ResourceModels, 3)
+	for _, m := range evt.ResourceModels {
+		listed := m.(Model)
+		assert.NotEmpty(t, aws.StringValue(listed.PrometheusEndpoint))
+		if aws.StringValue(listed.Arn) == aws.StringValue(arns[0]) {
+			assert.Equal(t, testAlertManagerDefinition, aws.StringValue(listed.AlertManagerDefinition))
+		} else {
+			assert.Nil(t, listed.AlertManagerDefinition)
+		}
+	}
+
+	// a workspace that can't be described keeps its summary
+	client.InjectError("DescribeWorkspace", &prometheusservice.AccessDeniedException{
+		Message_:     aws.String("denied"),
+		RespMetadata: protocol.ResponseMetadata{StatusCode: 403, RequestID: "req-1"},
+	})
+	evt, err = List(hydrate(""), nil, &Model{})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Contains(t, evt.Message, "List complete, 1 of 3 workspaces could not be described: ws-")
+	assert.Contains(t, evt.Message, "AccessDeniedException: denied (RequestId: req-1)")
+	require.Len(t, evt.ResourceModels, 3)
+	var summaries int
+	for _, m := range evt.ResourceModels {
+		listed := m.(Model)
+		assert.NotNil(t, listed.Arn)
+		if listed.PrometheusEndpoint == nil {
+			summaries++
+		}
+	}
+	assert.Equal(t, 1, summaries)
+
+	// later pages are hydrated too
+	evt, err = List(hydrate("1"), nil, &Model{})
+	require.NoError(t, err)
+	assert.Equal(t, "List complete", evt.Message)
+	require.Len(t, evt.ResourceModels, 2)
+	assert.Equal(t, arns[1], evt.ResourceModels[0].(Model).Arn)
+	assert.NotEmpty(t, aws.StringValue(evt.ResourceModels[0].(Model).PrometheusEndpoint))
+
+	evt, err = List(handler.NewRequest("", nil, handler.RequestContext{}, nil, nil, []byte(`{"HydrateResults":"maybe"}`)), nil, &Model{})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+}
+
+func TestRead_byWorkspaceIdOrAlias(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{Alias: aws.String("prod")})
+	require.NoError(t, err)
+	_, err = client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{Alias: aws.String("prod-eu")})
+	require.NoError(t, err)
+
+	req := handler.Request{RequestContext: handler.RequestContext{Region: client.Region, AccountID: client.AccountID}}
+	byID := &Model{WorkspaceId: ws.WorkspaceId}
+	evt, err := Read(req, nil, byID)
+	require.NoError(t, err)
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, ws.Arn, byID.Arn)
+	assert.Equal(t, "prod", aws.StringValue(byID.Alias))
+
+	// prod-eu also matches the alias filter, but isn't an exact match
+	byAlias := &Model{Alias: aws.String("prod")}
+	evt, err = Read(req, nil, byAlias)
+	require.NoError(t, err)
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, ws.Arn, byAlias.Arn)
+	assert.Equal(t, ws.WorkspaceId, byAlias.WorkspaceId)
+
+	evt, err = Read(req, nil, &Model{Alias: aws.String("staging")})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, evt.HandlerErrorCode)
+	assert.Equal(t, `Invalid Read: no workspace has alias "staging"`, evt.Message)
+
+	evt, err = Read(req, nil, &Model{WorkspaceId: aws.String("ws-missing")})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, evt.HandlerErrorCode)
+
+	evt, err = Read(req, nil, &Model{WorkspaceId: aws.String("ws/1")})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, `Invalid Read: invalid WorkspaceId "ws/1"`, evt.Message)
+
+	other, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{Alias: aws.String("prod")})
+	require.NoError(t, err)
+	evt, err = Read(req, nil, &Model{Alias: aws.String("prod")})
+	require.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+	assert.Contains(t, evt.Message, `Invalid Read: alias "prod" is used by workspaces`)
+	assert.Contains(t, evt.Message, aws.StringValue(ws.WorkspaceId))
+	assert.Contains(t, evt.Message, aws.StringValue(other.WorkspaceId))
+}
+
+func TestHandlers_withMalformedCallbackContext(t *testing.T) {
+	apstest.UseClient(t, &newClient, apstest.NewService(0))
+
+	req := handler.Request{
+		CallbackContext: map[string]interface{}{"Arn": 42},
+	}
+	m := &Model{
+		Arn: aws.String("arn:aws:aps:us-west-2:111111111111:workspace/ws-11111111-1111-1111-1111-111111111111"),
+	}
+
+	for name, action := range map[string]func(handler.Request, *Model, *Model) (handler.ProgressEvent, error){
+		"Create": Create,
+		"Update": Update,
+		"Delete": Delete,
+	} {
+		t.Run(name, func(t *testing.T) {
+			evt, err := action(req, &Model{}, m)
+			assert.NoError(t, err)
+			assert.Equal(t, handler.Failed, evt.OperationStatus)
+			assert.Equal(t, cloudformation.HandlerErrorCodeInternalFailure, evt.HandlerErrorCode)
+		})
+	}
+}
+
+func TestCreate_stabilizationTimeout(t *testing.T) {
+	client := apstest.NewService(1000)
+	apstest.UseClient(t, &newClient, client)
+
+	ws, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	started := &internal.CallbackContext{
+		Phase:     phaseWaitForWorkspace,
+		Arn:       aws.StringValue(ws.Arn),
+		StartedAt: time.Now().Add(-time.Hour),
+	}
+	req := handler.Request{
+		CallbackContext: started.Next(phaseWaitForWorkspace, aws.StringValue(ws.Arn)),
+	}
+
+	evt, err := Create(req, nil, &Model{AlertManagerDefinition: aws.String(testAlertManagerDefinition)})
+	assert.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotStabilized, evt.HandlerErrorCode)
+	assert.Contains(t, evt.Message, string(phaseWaitForWorkspace))
+	assert.Equal(t, 0, client.Calls("CreateAlertManagerDefinition"))
+}
+
+func TestCreate_workspaceCreationFailed(t *testing.T) {
+	client := apstest.NewService(1)
+	client.FailTransitions = true
+	apstest.UseClient(t, &newClient, client)
+
+	model := &Model{AlertManagerDefinition: aws.String(testAlertManagerDefinition)}
+	evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotStabilized, evt.HandlerErrorCode)
+	assert.Equal(t, "Workspace status: CREATION_FAILED", evt.Message)
+	assert.Equal(t, 0, client.Calls("CreateAlertManagerDefinition"))
+}
+
+func TestCreate_workspaceDeletedOutOfBand(t *testing.T) {
+	client := apstest.NewService(5)
+	apstest.UseClient(t, &newClient, client)
+
+	model := &Model{}
+	evt, err := Create(handler.Request{}, nil, model)
+	require.NoError(t, err)
+	require.Equal(t, handler.InProgress, evt.OperationStatus)
+
+	client.InjectError("DescribeWorkspace", &prometheusservice.ResourceNotFoundException{Message_: aws.String("not found")})
+
+	evt, err = Create(handler.Request{CallbackContext: evt.CallbackContext}, nil, model)
+	assert.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, evt.HandlerErrorCode)
+	assert.Equal(t, "Workspace was deleted out-of-band", evt.Message)
+}
+
+func TestHandlers_throttledWhilePolling(t *testing.T) {
+	client := apstest.NewService(2)
+	apstest.UseClient(t, &newClient, client)
+
+	// the waits for the workspace and its definition are throttled once
+	// each, and retried instead of failing
+	client.InjectError("DescribeWorkspace", &prometheusservice.ThrottlingException{Message_: aws.String("slow down")})
+	client.InjectError("DescribeAlertManagerDefinition", &prometheusservice.ThrottlingException{Message_: aws.String("slow down")})
+
+	model := &Model{AlertManagerDefinition: aws.String(testAlertManagerDefinition)}
+	evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, messageCreateComplete, evt.Message)
+	assert.Equal(t, 1, client.Calls("CreateWorkspace"))
+	assert.Equal(t, 1, client.Calls("CreateAlertManagerDefinition"))
+
+	client.InjectError("DescribeWorkspace", &prometheusservice.ThrottlingException{Message_: aws.String("slow down")})
+	deleted := &Model{Arn: model.Arn}
+	evt = apstest.Run(t, deleted, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Delete(req, nil, deleted)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, 1, client.Calls("DeleteWorkspace"))
+}
+
+func TestHandlers_withInvalidAlertManagerDefinition(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	invalid := strings.Replace(testAlertManagerDefinition, "receiver: default", "receiver: missing", 1)
+	message := `invalid AlertManagerDefinition: alertmanager_config: route: undefined receiver "missing" used in route`
+
+	rejected := &Model{AlertManagerDefinition: aws.String(invalid)}
+	evt := apstest.Run(t, rejected, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, rejected)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+	assert.Equal(t, message, evt.Message)
+	assert.Zero(t, client.Calls("CreateWorkspace"))
+
+	model := &Model{Alias: aws.String("alias")}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) { return Create(req, nil, model) }).OperationStatus)
+
+	updated := &Model{
+		Arn:                    model.Arn,
+		Alias:                  aws.String("renamed"),
+		AlertManagerDefinition: aws.String(invalid),
+	}
+	evt = apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+	assert.Equal(t, message, evt.Message)
+	assert.Zero(t, client.Calls("UpdateWorkspaceAlias"))
+	assert.Zero(t, client.Calls("CreateAlertManagerDefinition"))
+}
+
+func TestUpdate_reformattedAlertManagerDefinition(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	model := &Model{AlertManagerDefinition: aws.String(testAlertManagerDefinition)}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) { return Create(req, nil, model) }).OperationStatus)
+
+	reformatted := "alertmanager_config: \"route: {receiver: default}\\nreceivers: [{name: default}]\"\n"
+	updated := &Model{Arn: model.Arn, AlertManagerDefinition: aws.String(reformatted)}
+	evt := apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Zero(t, client.Calls("PutAlertManagerDefinition"))
+	assert.Equal(t, reformatted, aws.StringValue(updated.AlertManagerDefinition))
+
+	read := &Model{Arn: model.Arn, AlertManagerDefinition: aws.String(reformatted)}
+	evt = apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, reformatted, aws.StringValue(read.AlertManagerDefinition))
+
+	changed := strings.Replace(reformatted, "receivers: [{name: default}]", "receivers: [{name: default}, {name: other}]", 1)
+	read = &Model{Arn: model.Arn, AlertManagerDefinition: aws.String(changed)}
+	evt = apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, testAlertManagerDefinition, aws.StringValue(read.AlertManagerDefinition))
+}
+
+func TestUpdate_alertManagerDefinitionOwnedElsewhere(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	model := &Model{}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) { return Create(req, nil, model) }).OperationStatus)
+	_, err := client.CreateAlertManagerDefinition(&prometheusservice.CreateAlertManagerDefinitionInput{
+		Data:        []byte(internal.MarkAlertManagerDefinitionOwned(testAlertManagerDefinition)),
+		WorkspaceId: model.WorkspaceId,
+	})
+	require.NoError(t, err)
+
+	// the definition doesn't show up as part of the workspace
+	read := &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Nil(t, read.AlertManagerDefinition)
+
+	added := &Model{Arn: model.Arn, AlertManagerDefinition: aws.String(testAlertManagerDefinition)}
+	evt := apstest.Run(t, added, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, added)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeResourceConflict, evt.HandlerErrorCode)
+	assert.Equal(t, "AlertManagerDefinition is managed by an AWS::APS::AlertManagerDefinition resource", evt.Message)
+	assert.Zero(t, client.Calls("PutAlertManagerDefinition"))
+
+	// handing the definition over to the standalone resource doesn't delete it
+	removed := &Model{Arn: model.Arn}
+	evt = apstest.Run(t, removed, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, added, removed)
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Zero(t, client.Calls("DeleteAlertManagerDefinition"))
+}
+
+func TestCreate_withKmsKeyArn(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	key := "arn:aws:kms:us-west-2:222222222222:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	model := &Model{KmsKeyArn: aws.String(key)}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) { return Create(req, nil, model) }).OperationStatus)
+
+	read := &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Equal(t, key, aws.StringValue(read.KmsKeyArn))
+
+	foreign := &Model{
+		KmsKeyArn: aws.String(strings.Replace(key, "us-west-2", "eu-west-1", 1)),
+	}
+	evt := apstest.Run(t, foreign, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, foreign)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+	assert.Equal(t, `invalid KmsKeyArn: KMS key "arn:aws:kms:eu-west-1:222222222222:key/1234abcd-12ab-34cd-56ef-1234567890ab" `+
+		`is in region "eu-west-1", but the workspace is in region "us-west-2"`, evt.Message)
+	assert.Equal(t, 1, client.Calls("CreateWorkspace"))
+}
+
+func TestWorkspace_loggingConfiguration(t *testing.T) {
+	client := apstest.NewService(2)
+	apstest.UseClient(t, &newClient, client)
+
+	logGroup := "arn:aws:logs:us-west-2:111111111111:log-group:/aps/workspace:*"
+	model := &Model{
+		AlertManagerDefinition: aws.String(testAlertManagerDefinition),
+		LoggingConfiguration:   &LoggingConfiguration{LogGroupArn: aws.String(logGroup)},
+	}
+	evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, messageCreateComplete, evt.Message)
+	assert.Equal(t, 1, client.Calls("CreateLoggingConfiguration"))
+
+	read := &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	require.NotNil(t, read.LoggingConfiguration)
+	assert.Equal(t, logGroup, aws.StringValue(read.LoggingConfiguration.LogGroupArn))
+
+	// unrelated changes leave the logging configuration alone
+	renamed := &Model{
+		Arn:                    model.Arn,
+		Alias:                  aws.String("renamed"),
+		AlertManagerDefinition: model.AlertManagerDefinition,
+		LoggingConfiguration:   model.LoggingConfiguration,
+	}
+	require.Equal(t, handler.Success, apstest.Run(t, renamed, func(req handler.Request) (handler.ProgressEvent, error) { return Update(req, model, renamed) }).OperationStatus)
+	assert.Zero(t, client.Calls("UpdateLoggingConfiguration"))
+
+	otherLogGroup := strings.Replace(logGroup, "/aps/workspace", "/aps/other", 1)
+	moved := &Model{
+		Arn:                  model.Arn,
+		Alias:                aws.String("renamed"),
+		LoggingConfiguration: &LoggingConfiguration{LogGroupArn: aws.String(otherLogGroup)},
+	}
+	require.Equal(t, handler.Success, apstest.Run(t, moved, func(req handler.Request) (handler.ProgressEvent, error) { return Update(req, renamed, moved) }).OperationStatus)
+	assert.Equal(t, 1, client.Calls("DeleteAlertManagerDefinition"))
+	assert.Equal(t, 1, client.Calls("UpdateLoggingConfiguration"))
+
+	read = &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Equal(t, otherLogGroup, aws.StringValue(read.LoggingConfiguration.LogGroupArn))
+
+	disabled := &Model{Arn: model.Arn, Alias: aws.String("renamed")}
+	evt = apstest.Run(t, disabled, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, moved, disabled)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, messageUpdateComplete, evt.Message)
+	assert.Equal(t, 1, client.Calls("DeleteLoggingConfiguration"))
+
+	read = &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Nil(t, read.LoggingConfiguration)
+
+	require.Equal(t, handler.Success, apstest.Run(t, moved, func(req handler.Request) (handler.ProgressEvent, error) { return Update(req, disabled, moved) }).OperationStatus)
+	assert.Equal(t, 2, client.Calls("CreateLoggingConfiguration"))
+
+	evt = apstest.Run(t, moved, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Delete(req, nil, moved)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, 2, client.Calls("DeleteLoggingConfiguration"))
+	assert.Equal(t, 1, client.Calls("DeleteWorkspace"))
+}
+
+func TestCreate_loggingConfigurationFailed(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	model := &Model{}
+	evt, err := Create(handler.Request{}, nil, model)
+	require.NoError(t, err)
+	require.Equal(t, handler.InProgress, evt.OperationStatus)
+
+	client.FailTransitions = true
+	model.LoggingConfiguration = &LoggingConfiguration{
+		LogGroupArn: aws.String("arn:aws:logs:us-west-2:111111111111:log-group:/aps/workspace:*"),
+	}
+	for evt.OperationStatus == handler.InProgress {
+		evt, err = Create(handler.Request{CallbackContext: evt.CallbackContext}, nil, model)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotStabilized, evt.HandlerErrorCode)
+	assert.Equal(t, "LoggingConfiguration status: CREATION_FAILED, reason: simulated failure", evt.Message)
+}
+
+func TestWorkspace_workspaceConfiguration(t *testing.T) {
+	client := apstest.NewService(2)
+	apstest.UseClient(t, &newClient, client)
+
+	teamLimits := LimitsPerLabelSet{
+		LabelSet: []Label{{Name: aws.String("team"), Value: aws.String("a")}, {Name: aws.String("env"), Value: aws.String("prod")}},
+		Limits:   &LimitsPerLabelSetEntry{MaxSeries: aws.Int(1000)},
+	}
+	defaultLimits := LimitsPerLabelSet{
+		LabelSet: []Label{},
+		Limits:   &LimitsPerLabelSetEntry{MaxSeries: aws.Int(5000)},
+	}
+	model := &Model{
+		AlertManagerDefinition: aws.String(testAlertManagerDefinition),
+		WorkspaceConfiguration: &WorkspaceConfiguration{
+			RetentionPeriodInDays: aws.Int(30),
+			LimitsPerLabelSets:    []LimitsPerLabelSet{teamLimits, defaultLimits},
+		},
+	}
+	evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, 1, client.Calls("UpdateWorkspaceConfiguration"))
+	assert.Equal(t, 1, client.Calls("CreateAlertManagerDefinition"))
+
+	read := &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	require.NotNil(t, read.WorkspaceConfiguration)
+	assert.Equal(t, 30, aws.IntValue(read.WorkspaceConfiguration.RetentionPeriodInDays))
+	assert.ElementsMatch(t, []LimitsPerLabelSet{
+		{
+			LabelSet: []Label{{Name: aws.String("env"), Value: aws.String("prod")}, {Name: aws.String("team"), Value: aws.String("a")}},
+			Limits:   teamLimits.Limits,
+		},
+		defaultLimits,
+	}, read.WorkspaceConfiguration.LimitsPerLabelSets)
+
+	// reordering the limits is not a change
+	reordered := &Model{
+		Arn:                    model.Arn,
+		AlertManagerDefinition: model.AlertManagerDefinition,
+		WorkspaceConfiguration: &WorkspaceConfiguration{
+			RetentionPeriodInDays: aws.Int(30),
+			LimitsPerLabelSets:    []LimitsPerLabelSet{defaultLimits, teamLimits},
+		},
+	}
+	require.Equal(t, handler.Success, apstest.Run(t, reordered, func(req handler.Request) (handler.ProgressEvent, error) { return Update(req, model, reordered) }).OperationStatus)
+	assert.Equal(t, 1, client.Calls("UpdateWorkspaceConfiguration"))
+	read = &Model{Arn: model.Arn, WorkspaceConfiguration: reordered.WorkspaceConfiguration}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Equal(t, reordered.WorkspaceConfiguration, read.WorkspaceConfiguration)
+
+	extended := &Model{
+		Arn:                    model.Arn,
+		AlertManagerDefinition: model.AlertManagerDefinition,
+		WorkspaceConfiguration: &WorkspaceConfiguration{
+			RetentionPeriodInDays: aws.Int(90),
+			LimitsPerLabelSets:    []LimitsPerLabelSet{teamLimits},
+		},
+	}
+	require.Equal(t, handler.Success, apstest.Run(t, extended, func(req handler.Request) (handler.ProgressEvent, error) { return Update(req, reordered, extended) }).OperationStatus)
+	assert.Equal(t, 2, client.Calls("UpdateWorkspaceConfiguration"))
+	assert.Zero(t, client.Calls("PutAlertManagerDefinition"))
+	read = &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Equal(t, 90, aws.IntValue(read.WorkspaceConfiguration.RetentionPeriodInDays))
+	assert.Len(t, read.WorkspaceConfiguration.LimitsPerLabelSets, 1)
+
+	// removing the configuration restores the defaults
+	removed := &Model{Arn: model.Arn, AlertManagerDefinition: model.AlertManagerDefinition}
+	require.Equal(t, handler.Success, apstest.Run(t, removed, func(req handler.Request) (handler.ProgressEvent, error) { return Update(req, extended, removed) }).OperationStatus)
+	assert.Equal(t, 3, client.Calls("UpdateWorkspaceConfiguration"))
+	read = &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Nil(t, read.WorkspaceConfiguration)
+}
+
+func TestUpdate_workspaceConfigurationFailed(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	model := &Model{}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) { return Create(req, nil, model) }).OperationStatus)
+
+	client.FailTransitions = true
+	updated := &Model{
+		Arn:                    model.Arn,
+		WorkspaceConfiguration: &WorkspaceConfiguration{RetentionPeriodInDays: aws.Int(7)},
+	}
+	evt := apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotStabilized, evt.HandlerErrorCode)
+	assert.Equal(t, "WorkspaceConfiguration status: UPDATE_FAILED, reason: simulated failure", evt.Message)
+}
+
+const testResourcePolicy = `{"Version": "2012-10-17", "Statement": [{
+  "Effect": "Allow",
+  "Principal": {"AWS": "arn:aws:iam::222222222222:root"},
+  "Action": ["aps:RemoteWrite", "aps:QueryMetrics"],
+  "Resource": "*"
+}]}`
+
+func TestWorkspace_resourcePolicy(t *testing.T) {
+	client := apstest.NewService(2)
+	apstest.UseClient(t, &newClient, client)
+
+	model := &Model{ResourcePolicy: aws.String(testResourcePolicy)}
+	evt := apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, messageCreateComplete, evt.Message)
+	assert.Equal(t, 1, client.Calls("PutResourcePolicy"))
+
+	read := &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Equal(t, testResourcePolicy, aws.StringValue(read.ResourcePolicy))
+
+	// reordering keys and list items is not a change
+	reordered := `{"Statement": {"Resource": "*", "Action": ["aps:QueryMetrics", "aps:RemoteWrite"],
+		"Principal": {"AWS": ["arn:aws:iam::222222222222:root"]}, "Effect": "Allow"}, "Version": "2012-10-17"}`
+	updated := &Model{Arn: model.Arn, ResourcePolicy: aws.String(reordered)}
+	require.Equal(t, handler.Success, apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) { return Update(req, model, updated) }).OperationStatus)
+	assert.Equal(t, 1, client.Calls("PutResourcePolicy"))
+	read = &Model{Arn: model.Arn, ResourcePolicy: aws.String(reordered)}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Equal(t, reordered, aws.StringValue(read.ResourcePolicy))
+
+	changed := strings.Replace(testResourcePolicy, `"aps:RemoteWrite", `, "", 1)
+	changedModel := &Model{Arn: model.Arn, ResourcePolicy: aws.String(changed)}
+	evt = apstest.Run(t, changedModel, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, updated, changedModel)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, messageUpdateComplete, evt.Message)
+	assert.Equal(t, 2, client.Calls("PutResourcePolicy"))
+	read = &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Equal(t, changed, aws.StringValue(read.ResourcePolicy))
+
+	removed := &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, removed, func(req handler.Request) (handler.ProgressEvent, error) { return Update(req, changedModel, removed) }).OperationStatus)
+	assert.Equal(t, 1, client.Calls("DeleteResourcePolicy"))
+	read = &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) { return Read(req, nil, read) }).OperationStatus)
+	assert.Nil(t, read.ResourcePolicy)
+}
+
+func TestHandlers_withInvalidResourcePolicy(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	invalid := strings.Replace(testResourcePolicy, "aps:QueryMetrics", "s3:GetObject", 1)
+	message := `invalid ResourcePolicy: Statement[0]: Action: "s3:GetObject" is not an Amazon Managed Service for Prometheus action`
+
+	rejected := &Model{ResourcePolicy: aws.String(invalid)}
+	evt := apstest.Run(t, rejected, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, rejected)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+	assert.Equal(t, message, evt.Message)
+	assert.Zero(t, client.Calls("CreateWorkspace"))
+
+	model := &Model{}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) { return Create(req, nil, model) }).OperationStatus)
+
+	updated := &Model{Arn: model.Arn, ResourcePolicy: aws.String(invalid)}
+	evt = apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeInvalidRequest, evt.HandlerErrorCode)
+	assert.Equal(t, message, evt.Message)
+	assert.Zero(t, client.Calls("PutResourcePolicy"))
+}
+
+func TestUpdate_resourcePolicyRevisionConflict(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	model := &Model{ResourcePolicy: aws.String(testResourcePolicy)}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	}).OperationStatus)
+
+	// the policy changes between reading its revision and replacing it, so
+	// the update fails instead of overwriting the change
+	client.InjectError("PutResourcePolicy", &prometheusservice.ConflictException{Message_: aws.String("revision mismatch")})
+	changed := strings.Replace(testResourcePolicy, `"aps:RemoteWrite", `, "", 1)
+	updated := &Model{Arn: model.Arn, ResourcePolicy: aws.String(changed)}
+	evt := apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeResourceConflict, evt.HandlerErrorCode)
+	assert.Equal(t, 2, client.Calls("PutResourcePolicy"))
+
+	read := &Model{Arn: model.Arn}
+	require.Equal(t, handler.Success, apstest.Run(t, read, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, read)
+	}).OperationStatus)
+	assert.Equal(t, testResourcePolicy, aws.StringValue(read.ResourcePolicy))
+}
+
+func TestUpdate_resourcePolicyDrift(t *testing.T) {
+	client := apstest.NewService(0)
+	apstest.UseClient(t, &newClient, client)
+
+	model := &Model{ResourcePolicy: aws.String(testResourcePolicy)}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Create(req, nil, model)
+	}).OperationStatus)
+
+	// the policy is replaced outside of CloudFormation
+	outOfBand := strings.Replace(testResourcePolicy, `"aps:QueryMetrics"`, `"aps:GetLabels"`, 1)
+	_, err := client.PutResourcePolicy(&internal.PutResourcePolicyInput{
+		PolicyDocument: aws.String(outOfBand),
+		WorkspaceId:    model.WorkspaceId,
+	})
+	require.NoError(t, err)
+
+	changed := strings.Replace(testResourcePolicy, `"aps:RemoteWrite", `, "", 1)
+	updated := &Model{Arn: model.Arn, ResourcePolicy: aws.String(changed)}
+	evt := apstest.Run(t, updated, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, updated)
+	})
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeResourceConflict, evt.HandlerErrorCode)
+	assert.Equal(t, "ResourcePolicy was changed outside of CloudFormation", evt.Message)
+	assert.Equal(t, 2, client.Calls("PutResourcePolicy"))
+
+	// the policy was removed outside of CloudFormation, as the update asks
+	_, err = client.DeleteResourcePolicy(&internal.DeleteResourcePolicyInput{WorkspaceId: model.WorkspaceId})
+	require.NoError(t, err)
+	removed := &Model{Arn: model.Arn}
+	evt = apstest.Run(t, removed, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Update(req, model, removed)
+	})
+	require.Equal(t, handler.Success, evt.OperationStatus, evt.Message)
+	assert.Equal(t, 1, client.Calls("DeleteResourcePolicy"))
+}
+
+func TestCreate_metrics(t *testing.T) {
+	client := apstest.NewService(2)
+	apstest.UseClient(t, &newClient, client)
+	sink := &internal.MemorySink{}
+	orig := internal.DefaultMetricsSink
+	internal.DefaultMetricsSink = sink
+	t.Cleanup(func() { internal.DefaultMetricsSink = orig })
+
+	model := &Model{}
+	require.Equal(t, handler.Success, apstest.Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) { return Create(req, nil, model) }).OperationStatus)
+	attempts := sink.Values(internal.MetricStabilizationAttempts)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, float64(3), attempts[0].Value)
+	assert.Equal(t, map[string]string{
+		internal.DimensionResourceType: "AWS::APS::Workspace",
+		internal.DimensionAction:       internal.ActionCreate,
+		internal.DimensionPhase:        string(phaseWaitForWorkspace),
+	}, attempts[0].Properties)
+	assert.Len(t, sink.Values(internal.MetricPhaseDuration), 1)
+	assert.Empty(t, sink.Values(internal.MetricHandlerErrors))
+
+	missing := &Model{Arn: aws.String("arn:aws:aps:us-west-2:111111111111:workspace/ws-missing")}
+	evt := apstest.Run(t, missing, func(req handler.Request) (handler.ProgressEvent, error) {
+		return Read(req, nil, missing)
+	})
+	require.Equal(t, handler.Failed, evt.OperationStatus)
+	errors := sink.Values(internal.MetricHandlerErrors)
+	require.Len(t, errors, 1)
+	assert.Equal(t, internal.ActionRead, errors[0].Properties[internal.DimensionAction])
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotFound, errors[0].Properties[internal.DimensionHandlerErrorCode])
+}
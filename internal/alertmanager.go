@@ -0,0 +1,502 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+// alertManagerDefinitionOwnerMarker starts the definitions put by the
+// AWS::APS::AlertManagerDefinition resource, so the workspace resource can
+// tell it doesn't own them. Being a YAML comment, it doesn't change what the
+// definition means.
+const alertManagerDefinitionOwnerMarker = "# managed by AWS::APS::AlertManagerDefinition\n"
+
+// MarkAlertManagerDefinitionOwned returns data marked as owned by the
+// AWS::APS::AlertManagerDefinition resource.
+func MarkAlertManagerDefinitionOwned(data string) string {
+	if AlertManagerDefinitionOwned(data) {
+		return data
+	}
+	return alertManagerDefinitionOwnerMarker + data
+}
+
+// AlertManagerDefinitionOwned reports whether data was put by the
+// AWS::APS::AlertManagerDefinition resource.
+func AlertManagerDefinitionOwned(data string) bool {
+	return strings.HasPrefix(data, alertManagerDefinitionOwnerMarker)
+}
+
+// UnmarkAlertManagerDefinition removes the ownership marker from data.
+func UnmarkAlertManagerDefinition(data string) string {
+	return strings.TrimPrefix(data, alertManagerDefinitionOwnerMarker)
+}
+
+// alertManagerDefinition is the envelope APS expects around an Alertmanager
+// configuration.
+type alertManagerDefinition struct {
+	TemplateFiles      map[string]string `yaml:"template_files,omitempty"`
+	AlertManagerConfig string            `yaml:"alertmanager_config"`
+}
+
+// alertmanagerConfig mirrors the parts of the Alertmanager configuration file
+// that APS accepts.
+type alertmanagerConfig struct {
+	Global            map[string]interface{} `yaml:"global,omitempty"`
+	Route             *alertmanagerRoute     `yaml:"route"`
+	InhibitRules      []inhibitRule          `yaml:"inhibit_rules,omitempty"`
+	Receivers         []receiver             `yaml:"receivers"`
+	Templates         []string               `yaml:"templates,omitempty"`
+	TimeIntervals     []timeInterval         `yaml:"time_intervals,omitempty"`
+	MuteTimeIntervals []timeInterval         `yaml:"mute_time_intervals,omitempty"`
+}
+
+type alertmanagerRoute struct {
+	Receiver            string              `yaml:"receiver,omitempty"`
+	GroupBy             []string            `yaml:"group_by,omitempty"`
+	Match               map[string]string   `yaml:"match,omitempty"`
+	MatchRE             map[string]string   `yaml:"match_re,omitempty"`
+	Matchers            []string            `yaml:"matchers,omitempty"`
+	Continue            bool                `yaml:"continue,omitempty"`
+	Routes              []alertmanagerRoute `yaml:"routes,omitempty"`
+	GroupWait           string              `yaml:"group_wait,omitempty"`
+	GroupInterval       string              `yaml:"group_interval,omitempty"`
+	RepeatInterval      string              `yaml:"repeat_interval,omitempty"`
+	MuteTimeIntervals   []string            `yaml:"mute_time_intervals,omitempty"`
+	ActiveTimeIntervals []string            `yaml:"active_time_intervals,omitempty"`
+}
+
+type inhibitRule struct {
+	SourceMatch    map[string]string `yaml:"source_match,omitempty"`
+	SourceMatchRE  map[string]string `yaml:"source_match_re,omitempty"`
+	SourceMatchers []string          `yaml:"source_matchers,omitempty"`
+	TargetMatch    map[string]string `yaml:"target_match,omitempty"`
+	TargetMatchRE  map[string]string `yaml:"target_match_re,omitempty"`
+	TargetMatchers []string          `yaml:"target_matchers,omitempty"`
+	Equal          []string          `yaml:"equal,omitempty"`
+}
+
+type receiver struct {
+	Name       string      `yaml:"name"`
+	SNSConfigs []snsConfig `yaml:"sns_configs,omitempty"`
+	// Integrations holds every other key so unsupported integrations can be
+	// reported by name rather than as unknown fields.
+	Integrations map[string]interface{} `yaml:",inline"`
+}
+
+type snsConfig struct {
+	SendResolved *bool                  `yaml:"send_resolved,omitempty"`
+	HTTPConfig   map[string]interface{} `yaml:"http_config,omitempty"`
+	APIURL       string                 `yaml:"api_url,omitempty"`
+	SigV4        *sigV4Config           `yaml:"sigv4,omitempty"`
+	TopicARN     string                 `yaml:"topic_arn,omitempty"`
+	PhoneNumber  string                 `yaml:"phone_number,omitempty"`
+	TargetARN    string                 `yaml:"target_arn,omitempty"`
+	Subject      string                 `yaml:"subject,omitempty"`
+	Message      string                 `yaml:"message,omitempty"`
+	Attributes   map[string]string      `yaml:"attributes,omitempty"`
+}
+
+type sigV4Config struct {
+	Region    string `yaml:"region,omitempty"`
+	AccessKey string `yaml:"access_key,omitempty"`
+	SecretKey string `yaml:"secret_key,omitempty"`
+	Profile   string `yaml:"profile,omitempty"`
+	RoleARN   string `yaml:"role_arn,omitempty"`
+}
+
+type timeInterval struct {
+	Name          string                   `yaml:"name"`
+	TimeIntervals []map[string]interface{} `yaml:"time_intervals"`
+}
+
+// alertmanagerIntegrations are the receiver integrations of upstream
+// Alertmanager. APS only delivers notifications through SNS.
+var alertmanagerIntegrations = map[string]struct{}{
+	"discord_configs":    {},
+	"email_configs":      {},
+	"jira_configs":       {},
+	"msteams_configs":    {},
+	"msteamsv2_configs":  {},
+	"opsgenie_configs":   {},
+	"pagerduty_configs":  {},
+	"pushover_configs":   {},
+	"rocketchat_configs": {},
+	"slack_configs":      {},
+	"telegram_configs":   {},
+	"victorops_configs":  {},
+	"webex_configs":      {},
+	"webhook_configs":    {},
+	"wechat_configs":     {},
+}
+
+// matcherRE matches a single label matcher such as severity=~"page|critical".
+var matcherRE = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(=~|=|!=|!~)\s*((?s).*?)\s*$`)
+
+// ValidateAlertManagerDefinition checks that data is an alert manager
+// definition APS can load: the template_files/alertmanager_config envelope
+// around an Alertmanager configuration that only uses supported receivers.
+func ValidateAlertManagerDefinition(data string) error {
+	var definition alertManagerDefinition
+	if err := decodeStrict(data, &definition); err != nil {
+		return err
+	}
+	if strings.TrimSpace(definition.AlertManagerConfig) == "" {
+		return errors.New("alertmanager_config must be set")
+	}
+	for name := range definition.TemplateFiles {
+		if name == "" {
+			return errors.New("template_files: template file names must not be empty")
+		}
+	}
+
+	var config alertmanagerConfig
+	if err := decodeStrict(definition.AlertManagerConfig, &config); err != nil {
+		return fmt.Errorf("alertmanager_config: %w", err)
+	}
+	if err := validateAlertmanagerConfig(config); err != nil {
+		return fmt.Errorf("alertmanager_config: %w", err)
+	}
+	return nil
+}
+
+// AlertManagerDefinitionsEqual reports whether a and b define the same alert
+// manager configuration. Formatting, key order and the YAML style of the
+// embedded alertmanager_config are ignored; template files are compared as
+// text. Definitions that don't parse are only equal if they are identical.
+func AlertManagerDefinitionsEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	canonicalA, err := canonicalAlertManagerDefinition(a)
+	if err != nil {
+		return false
+	}
+	canonicalB, err := canonicalAlertManagerDefinition(b)
+	if err != nil {
+		return false
+	}
+	return yamlValuesEqual(canonicalA, canonicalB)
+}
+
+// canonicalAlertManagerDefinition decodes a definition, including the
+// Alertmanager configuration embedded in it as a string.
+func canonicalAlertManagerDefinition(data string) (interface{}, error) {
+	value, err := yamlValue(data)
+	if err != nil {
+		return nil, err
+	}
+	envelope, ok := value.(map[string]interface{})
+	if !ok {
+		return value, nil
+	}
+	if config, ok := envelope["alertmanager_config"].(string); ok {
+		if envelope["alertmanager_config"], err = yamlValue(config); err != nil {
+			return nil, err
+		}
+	}
+	return envelope, nil
+}
+
+func validateAlertmanagerConfig(config alertmanagerConfig) error {
+	if timeout, ok := config.Global["resolve_timeout"]; ok {
+		value, _ := timeout.(string)
+		if err := validateOptionalDuration("resolve_timeout", value); err != nil || value == "" {
+			return fmt.Errorf("global: invalid 'resolve_timeout': %v", timeout)
+		}
+	}
+
+	receivers := map[string]struct{}{}
+	for i, r := range config.Receivers {
+		if err := validateReceiver(r, receivers); err != nil {
+			return fmt.Errorf("receivers[%d] %q: %w", i, r.Name, err)
+		}
+	}
+
+	intervals := map[string]struct{}{}
+	for _, list := range []struct {
+		field     string
+		intervals []timeInterval
+	}{
+		{"time_intervals", config.TimeIntervals},
+		{"mute_time_intervals", config.MuteTimeIntervals},
+	} {
+		for i, interval := range list.intervals {
+			if interval.Name == "" {
+				return fmt.Errorf("%s[%d]: missing name in time interval", list.field, i)
+			}
+			if _, ok := intervals[interval.Name]; ok {
+				return fmt.Errorf("%s[%d]: time interval %q is not unique", list.field, i, interval.Name)
+			}
+			intervals[interval.Name] = struct{}{}
+		}
+	}
+
+	if config.Route == nil {
+		return errors.New("no route provided in config")
+	}
+	if err := validateRootRoute(*config.Route); err != nil {
+		return fmt.Errorf("route: %w", err)
+	}
+	if err := validateRoute("route", *config.Route, receivers, intervals); err != nil {
+		return err
+	}
+
+	for i, rule := range config.InhibitRules {
+		if err := validateInhibitRule(rule); err != nil {
+			return fmt.Errorf("inhibit_rules[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateReceiver(r receiver, names map[string]struct{}) error {
+	if r.Name == "" {
+		return errors.New("missing name in receiver")
+	}
+	if _, ok := names[r.Name]; ok {
+		return errors.New("receiver name is not unique")
+	}
+	names[r.Name] = struct{}{}
+
+	keys := make([]string, 0, len(r.Integrations))
+	for key := range r.Integrations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := alertmanagerIntegrations[key]; ok {
+			return fmt.Errorf("%s is not supported by Amazon Managed Service for Prometheus, use sns_configs", key)
+		}
+		return fmt.Errorf("field %s not found in receiver", key)
+	}
+
+	for i, c := range r.SNSConfigs {
+		if err := validateSNSConfig(c); err != nil {
+			return fmt.Errorf("sns_configs[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateSNSConfig(c snsConfig) error {
+	targets := 0
+	for _, target := range []string{c.TopicARN, c.TargetARN, c.PhoneNumber} {
+		if target != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return errors.New("must provide exactly one of topic_arn, target_arn or phone_number")
+	}
+
+	if c.TopicARN != "" && !strings.Contains(c.TopicARN, "{{") {
+		parsed, err := arn.Parse(c.TopicARN)
+		if err != nil || parsed.Service != "sns" {
+			return fmt.Errorf("invalid topic_arn %q: must be an SNS topic ARN", c.TopicARN)
+		}
+	}
+	if c.SigV4 != nil && (c.SigV4.AccessKey == "") != (c.SigV4.SecretKey == "") {
+		return errors.New("sigv4: must provide both access_key and secret_key")
+	}
+	return nil
+}
+
+func validateRootRoute(route alertmanagerRoute) error {
+	switch {
+	case route.Receiver == "":
+		return errors.New("root route must specify a default receiver")
+	case len(route.Match) > 0 || len(route.MatchRE) > 0 || len(route.Matchers) > 0:
+		return errors.New("root route must not have any matchers")
+	case len(route.MuteTimeIntervals) > 0:
+		return errors.New("root route must not have any mute time intervals")
+	case len(route.ActiveTimeIntervals) > 0:
+		return errors.New("root route must not have any active time intervals")
+	}
+	return nil
+}
+
+func validateRoute(path string, route alertmanagerRoute, receivers, intervals map[string]struct{}) error {
+	wrap := func(err error) error {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if route.Receiver != "" {
+		if _, ok := receivers[route.Receiver]; !ok {
+			return wrap(fmt.Errorf("undefined receiver %q used in route", route.Receiver))
+		}
+	}
+
+	groupBy := map[string]struct{}{}
+	for _, label := range route.GroupBy {
+		if label == "..." && len(route.GroupBy) > 1 {
+			return wrap(errors.New("cannot have wildcard group_by (`...`) and other labels at the same time"))
+		}
+		if label != "..." && !labelNameRE.MatchString(label) {
+			return wrap(fmt.Errorf("invalid label name %q in group_by", label))
+		}
+		if _, ok := groupBy[label]; ok {
+			return wrap(fmt.Errorf("duplicated label %q in group_by", label))
+		}
+		groupBy[label] = struct{}{}
+	}
+
+	for _, d := range [][2]string{
+		{"group_wait", route.GroupWait},
+		{"group_interval", route.GroupInterval},
+		{"repeat_interval", route.RepeatInterval},
+	} {
+		if err := validateOptionalDuration(d[0], d[1]); err != nil {
+			return wrap(err)
+		}
+	}
+	if route.GroupInterval == "0" || route.GroupInterval == "0s" {
+		return wrap(errors.New("group_interval cannot be zero"))
+	}
+	if route.RepeatInterval == "0" || route.RepeatInterval == "0s" {
+		return wrap(errors.New("repeat_interval cannot be zero"))
+	}
+
+	if err := validateMatchers("match", "match_re", "matchers", route.Match, route.MatchRE, route.Matchers); err != nil {
+		return wrap(err)
+	}
+
+	for _, name := range append(route.MuteTimeIntervals, route.ActiveTimeIntervals...) {
+		if _, ok := intervals[name]; !ok {
+			return wrap(fmt.Errorf("undefined time interval %q used in route", name))
+		}
+	}
+
+	for i, child := range route.Routes {
+		if err := validateRoute(fmt.Sprintf("%s.routes[%d]", path, i), child, receivers, intervals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateInhibitRule(rule inhibitRule) error {
+	if err := validateMatchers("source_match", "source_match_re", "source_matchers", rule.SourceMatch, rule.SourceMatchRE, rule.SourceMatchers); err != nil {
+		return err
+	}
+	if err := validateMatchers("target_match", "target_match_re", "target_matchers", rule.TargetMatch, rule.TargetMatchRE, rule.TargetMatchers); err != nil {
+		return err
+	}
+	for _, label := range rule.Equal {
+		if !labelNameRE.MatchString(label) {
+			return fmt.Errorf("invalid label name %q in equal", label)
+		}
+	}
+	return nil
+}
+
+// validateMatchers checks the three ways Alertmanager lets a route or an
+// inhibit rule match alerts: equality and regex maps, and matcher strings.
+func validateMatchers(matchField, matchREField, matchersField string, match, matchRE map[string]string, matchers []string) error {
+	if err := validateLabelNames("label", match); err != nil {
+		return fmt.Errorf("%s: %w", matchField, err)
+	}
+	if err := validateLabelNames("label", matchRE); err != nil {
+		return fmt.Errorf("%s: %w", matchREField, err)
+	}
+	names := make([]string, 0, len(matchRE))
+	for name := range matchRE {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := matchRE[name]
+		if _, err := regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return fmt.Errorf("%s: invalid regular expression for %q: %v", matchREField, name, err)
+		}
+	}
+	for i, m := range matchers {
+		if err := parseMatchers(m); err != nil {
+			return fmt.Errorf("%s[%d]: %w", matchersField, i, err)
+		}
+	}
+	return nil
+}
+
+// parseMatchers checks a matcher string such as {severity="page",team=~"a|b"}.
+// The braces are optional and a single string may hold several matchers.
+func parseMatchers(s string) error {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") != strings.HasSuffix(s, "}") {
+		return fmt.Errorf("bad matcher format: %s", s)
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+
+	matchers, err := splitMatchers(s)
+	if err != nil {
+		return err
+	}
+	if len(matchers) == 0 {
+		return errors.New("bad matcher format: empty matcher")
+	}
+	for _, m := range matchers {
+		if err := parseMatcher(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitMatchers splits s on the commas outside of quoted values.
+func splitMatchers(s string) ([]string, error) {
+	var matchers []string
+	start, quoted, escaped := 0, false, false
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			matchers = append(matchers, s[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("bad matcher format: unterminated quoted string in %s", s)
+	}
+	if last := s[start:]; strings.TrimSpace(last) != "" || len(matchers) == 0 {
+		matchers = append(matchers, last)
+	}
+
+	nonEmpty := matchers[:0]
+	for _, m := range matchers {
+		if strings.TrimSpace(m) != "" {
+			nonEmpty = append(nonEmpty, m)
+		}
+	}
+	return nonEmpty, nil
+}
+
+func parseMatcher(s string) error {
+	parts := matcherRE.FindStringSubmatch(s)
+	if parts == nil {
+		return fmt.Errorf("bad matcher format: %s", strings.TrimSpace(s))
+	}
+	op, value := parts[2], parts[3]
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return fmt.Errorf("bad matcher format: invalid quoted value in %s", strings.TrimSpace(s))
+		}
+		value = unquoted
+	}
+	if op == "=~" || op == "!~" {
+		if _, err := regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return fmt.Errorf("invalid regular expression in matcher %s: %v", strings.TrimSpace(s), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+)
+
+// alertManagerDefinitionFailedStates are the terminal definition states a
+// handler can't recover from.
+var alertManagerDefinitionFailedStates = map[string]struct{}{
+	prometheusservice.AlertManagerDefinitionStatusCodeCreationFailed: {},
+	prometheusservice.AlertManagerDefinitionStatusCodeUpdateFailed:   {},
+}
+
+// WaitForAlertManagerDefinition describes the AlertManagerDefinition of the
+// workspace workspaceID and returns it once it is ACTIVE. Until then it
+// returns the event to end the invocation with instead: another callback in
+// phase for the resource arn, or a failure once the definition failed or
+// disappeared, along with the error of a failed request as NewFailedEvent
+// returns it. Both the workspace and the AWS::APS::AlertManagerDefinition
+// resource wait for their definitions with it.
+func WaitForAlertManagerDefinition(client APSService, poller *Poller, c *CallbackContext, phase Phase, arn string, workspaceID *string, model interface{}) (*prometheusservice.AlertManagerDefinitionDescription, *handler.ProgressEvent, error) {
+	data, err := client.DescribeAlertManagerDefinition(&prometheusservice.DescribeAlertManagerDefinitionInput{
+		WorkspaceId: workspaceID,
+	})
+	if IsNotFound(err) {
+		evt := NewDeletedOutOfBandEvent("AlertManagerDefinition", model)
+		return nil, &evt, nil
+	}
+	if err != nil {
+		evt, err := NewFailedEvent(err)
+		return nil, &evt, err
+	}
+
+	definition := data.AlertManagerDefinition
+	statusCode := definition.Status.StatusCode
+	if _, ok := alertManagerDefinitionFailedStates[aws.StringValue(statusCode)]; ok {
+		evt := NewStatusFailedEvent("AlertManagerDefinition", statusCode, definition.Status.StatusReason, model)
+		return nil, &evt, nil
+	}
+	if aws.StringValue(statusCode) != prometheusservice.AlertManagerDefinitionStatusCodeActive {
+		evt := poller.Next(c, phase, arn, model)
+		return nil, &evt, nil
+	}
+	return definition, nil, nil
+}
+
+// WaitForAlertManagerDefinitionDeleted describes the AlertManagerDefinition of
+// the workspace workspaceID and returns nil once it is gone. Until then it
+// returns the event to end the invocation with, like
+// WaitForAlertManagerDefinition.
+func WaitForAlertManagerDefinitionDeleted(client APSService, poller *Poller, c *CallbackContext, phase Phase, arn string, workspaceID *string, model interface{}) (*handler.ProgressEvent, error) {
+	_, err := client.DescribeAlertManagerDefinition(&prometheusservice.DescribeAlertManagerDefinitionInput{
+		WorkspaceId: workspaceID,
+	})
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		evt, err := NewFailedEvent(err)
+		return &evt, err
+	}
+
+	evt := poller.Next(c, phase, arn, model)
+	return &evt, nil
+}
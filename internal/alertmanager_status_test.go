@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// definitionClient describes a single AlertManagerDefinition, or fails with
+// err.
+type definitionClient struct {
+	APSService
+	statusCode string
+	err        error
+}
+
+func (c *definitionClient) DescribeAlertManagerDefinition(*prometheusservice.DescribeAlertManagerDefinitionInput) (*prometheusservice.DescribeAlertManagerDefinitionOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &prometheusservice.DescribeAlertManagerDefinitionOutput{
+		AlertManagerDefinition: &prometheusservice.AlertManagerDefinitionDescription{
+			Data: []byte("alertmanager_config: ''"),
+			Status: &prometheusservice.AlertManagerDefinitionStatus{
+				StatusCode:   aws.String(c.statusCode),
+				StatusReason: aws.String("reason"),
+			},
+		},
+	}, nil
+}
+
+func TestWaitForAlertManagerDefinition(t *testing.T) {
+	p := NewPoller(map[Phase]time.Duration{testPhase: time.Minute})
+
+	testCases := []struct {
+		name    string
+		client  *definitionClient
+		status  handler.Status
+		code    string
+		message string
+		// err is whether the failure returns the error of the request
+		err bool
+	}{
+		{
+			name:   "active",
+			client: &definitionClient{statusCode: prometheusservice.AlertManagerDefinitionStatusCodeActive},
+		},
+		{
+			name:   "updating",
+			client: &definitionClient{statusCode: prometheusservice.AlertManagerDefinitionStatusCodeUpdating},
+			status: handler.InProgress,
+		},
+		{
+			name:    "creation failed",
+			client:  &definitionClient{statusCode: prometheusservice.AlertManagerDefinitionStatusCodeCreationFailed},
+			status:  handler.Failed,
+			code:    cloudformation.HandlerErrorCodeNotStabilized,
+			message: "AlertManagerDefinition status: CREATION_FAILED, reason: reason",
+		},
+		{
+			name:    "deleted",
+			client:  &definitionClient{err: &prometheusservice.ResourceNotFoundException{Message_: aws.String("not found")}},
+			status:  handler.Failed,
+			code:    cloudformation.HandlerErrorCodeNotFound,
+			message: "AlertManagerDefinition was deleted out-of-band",
+		},
+		{
+			name:    "throttled",
+			client:  &definitionClient{err: &prometheusservice.ThrottlingException{Message_: aws.String("slow down")}},
+			status:  handler.Failed,
+			code:    cloudformation.HandlerErrorCodeThrottling,
+			message: "ThrottlingException: slow down",
+			err:     true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			definition, evt, err := WaitForAlertManagerDefinition(tc.client, p, nil, testPhase, testArn, aws.String("ws-1"), "model")
+			assert.Equal(t, tc.err, err != nil)
+			if tc.status == "" {
+				require.Nil(t, evt)
+				assert.Equal(t, "alertmanager_config: ''", string(definition.Data))
+				return
+			}
+			require.NotNil(t, evt)
+			assert.Nil(t, definition)
+			assert.Equal(t, tc.status, evt.OperationStatus)
+			assert.Equal(t, tc.code, evt.HandlerErrorCode)
+			if tc.message != "" {
+				assert.Equal(t, tc.message, evt.Message)
+			}
+		})
+	}
+}
+
+func TestWaitForAlertManagerDefinitionDeleted(t *testing.T) {
+	p := NewPoller(map[Phase]time.Duration{testPhase: time.Minute})
+
+	evt, err := WaitForAlertManagerDefinitionDeleted(&definitionClient{
+		err: &prometheusservice.ResourceNotFoundException{Message_: aws.String("not found")},
+	}, p, nil, testPhase, testArn, aws.String("ws-1"), "model")
+	assert.NoError(t, err)
+	assert.Nil(t, evt)
+
+	evt, err = WaitForAlertManagerDefinitionDeleted(&definitionClient{
+		statusCode: prometheusservice.AlertManagerDefinitionStatusCodeDeleting,
+	}, p, nil, testPhase, testArn, aws.String("ws-1"), "model")
+	assert.NoError(t, err)
+	require.NotNil(t, evt)
+	assert.Equal(t, handler.InProgress, evt.OperationStatus)
+
+	throttled := &prometheusservice.ThrottlingException{Message_: aws.String("slow down")}
+	evt, err = WaitForAlertManagerDefinitionDeleted(&definitionClient{err: throttled}, p, nil, testPhase, testArn, aws.String("ws-1"), "model")
+	assert.Equal(t, throttled, err)
+	require.NotNil(t, evt)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeThrottling, evt.HandlerErrorCode)
+}
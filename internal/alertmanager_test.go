@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAlertManagerDefinition = `template_files:
+  default_template: |
+    {{ define "sns.default.message" }}{{ .CommonLabels.alertname }}{{ end }}
+alertmanager_config: |
+  global:
+    resolve_timeout: 5m
+  templates:
+    - 'default_template'
+  route:
+    receiver: default
+    group_by: ['alertname', 'cluster']
+    group_wait: 30s
+    group_interval: 5m
+    repeat_interval: 4h
+    routes:
+      - receiver: pager
+        matchers:
+          - severity="page"
+          - '{team=~"infra|db", env!="dev"}'
+        mute_time_intervals: [weekends]
+      - match_re:
+          service: ^(foo1|foo2|baz)$
+        continue: true
+  inhibit_rules:
+    - source_matchers: [severity="critical"]
+      target_matchers: [severity="warning"]
+      equal: [alertname]
+  time_intervals:
+    - name: weekends
+      time_intervals:
+        - weekdays: ['saturday', 'sunday']
+  receivers:
+    - name: default
+      sns_configs:
+        - topic_arn: arn:aws:sns:us-west-2:111111111111:alerts
+          sigv4:
+            region: us-west-2
+          attributes:
+            key: value
+    - name: pager
+      sns_configs:
+        - topic_arn: arn:aws:sns:us-west-2:111111111111:pager
+          subject: '{{ template "sns.default.message" . }}'
+`
+
+// withAlertmanagerConfig returns a definition wrapping config.
+func withAlertmanagerConfig(config string) string {
+	return "alertmanager_config: |\n  " + strings.ReplaceAll(strings.TrimSpace(config), "\n", "\n  ") + "\n"
+}
+
+func TestValidateAlertManagerDefinition(t *testing.T) {
+	assert.NoError(t, ValidateAlertManagerDefinition(testAlertManagerDefinition))
+	assert.NoError(t, ValidateAlertManagerDefinition(withAlertmanagerConfig(`
+route:
+  receiver: blackhole
+receivers:
+  - name: blackhole
+`)))
+}
+
+func TestValidateAlertManagerDefinition_invalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    string
+		message string
+	}{
+		{
+			"malformed envelope",
+			"alertmanager_config: [",
+			"yaml: line 1: did not find expected node content",
+		},
+		{
+			"unknown envelope field",
+			"alertmanager_config: ''\ntemplates: {}\n",
+			"line 2: field templates not found",
+		},
+		{
+			"missing config",
+			"template_files: {}\n",
+			"alertmanager_config must be set",
+		},
+		{
+			"config is not a mapping",
+			"alertmanager_config: route\n",
+			"alertmanager_config: yaml: unmarshal errors:",
+		},
+		{
+			"missing route",
+			withAlertmanagerConfig("receivers: []"),
+			"alertmanager_config: no route provided in config",
+		},
+		{
+			"root route without receiver",
+			withAlertmanagerConfig("route: {}\nreceivers: []"),
+			"alertmanager_config: route: root route must specify a default receiver",
+		},
+		{
+			"root route with matchers",
+			withAlertmanagerConfig("route:\n  receiver: a\n  matchers: [a=b]\nreceivers: [{name: a}]"),
+			"alertmanager_config: route: root route must not have any matchers",
+		},
+		{
+			"undefined receiver",
+			withAlertmanagerConfig("route:\n  receiver: a\nreceivers: [{name: b}]"),
+			`alertmanager_config: route: undefined receiver "a" used in route`,
+		},
+		{
+			"undefined receiver in child route",
+			withAlertmanagerConfig("route:\n  receiver: a\n  routes:\n    - receiver: a\n    - routes:\n        - receiver: ops\nreceivers: [{name: a}]"),
+			`alertmanager_config: route.routes[1].routes[0]: undefined receiver "ops" used in route`,
+		},
+		{
+			"duplicate receiver",
+			withAlertmanagerConfig("route:\n  receiver: a\nreceivers: [{name: a}, {name: a}]"),
+			`alertmanager_config: receivers[1] "a": receiver name is not unique`,
+		},
+		{
+			"unsupported receiver",
+			withAlertmanagerConfig("route:\n  receiver: a\nreceivers:\n  - name: a\n    slack_configs:\n      - channel: '#alerts'"),
+			`alertmanager_config: receivers[0] "a": slack_configs is not supported by Amazon Managed Service for Prometheus, use sns_configs`,
+		},
+		{
+			"unknown receiver field",
+			withAlertmanagerConfig("route:\n  receiver: a\nreceivers:\n  - name: a\n    sns_config: []"),
+			`alertmanager_config: receivers[0] "a": field sns_config not found in receiver`,
+		},
+		{
+			"unknown sns field",
+			withAlertmanagerConfig("route:\n  receiver: a\nreceivers:\n  - name: a\n    sns_configs:\n      - topic: x"),
+			"field topic not found",
+		},
+		{
+			"sns without target",
+			withAlertmanagerConfig("route:\n  receiver: a\nreceivers:\n  - name: a\n    sns_configs:\n      - subject: x"),
+			`alertmanager_config: receivers[0] "a": sns_configs[0]: must provide exactly one of topic_arn, target_arn or phone_number`,
+		},
+		{
+			"invalid topic arn",
+			withAlertmanagerConfig("route:\n  receiver: a\nreceivers:\n  - name: a\n    sns_configs:\n      - topic_arn: arn:aws:sqs:us-west-2:111111111111:q"),
+			`invalid topic_arn "arn:aws:sqs:us-west-2:111111111111:q": must be an SNS topic ARN`,
+		},
+		{
+			"invalid duration",
+			withAlertmanagerConfig("route:\n  receiver: a\n  group_wait: 30 seconds\nreceivers: [{name: a}]"),
+			`alertmanager_config: route: invalid 'group_wait': not a valid duration string: "30 seconds"`,
+		},
+		{
+			"zero repeat interval",
+			withAlertmanagerConfig("route:\n  receiver: a\n  repeat_interval: 0s\nreceivers: [{name: a}]"),
+			"repeat_interval cannot be zero",
+		},
+		{
+			"invalid resolve timeout",
+			withAlertmanagerConfig("global:\n  resolve_timeout: 5\nroute:\n  receiver: a\nreceivers: [{name: a}]"),
+			"alertmanager_config: global: invalid 'resolve_timeout': 5",
+		},
+		{
+			"bad matcher",
+			withAlertmanagerConfig("route:\n  receiver: a\n  routes:\n    - matchers: ['severity=\"page\"', 'severity~page']\nreceivers: [{name: a}]"),
+			"alertmanager_config: route.routes[0]: matchers[1]: bad matcher format: severity~page",
+		},
+		{
+			"bad matcher regex",
+			withAlertmanagerConfig("route:\n  receiver: a\n  routes:\n    - matchers: ['team=~\"(db\"']\nreceivers: [{name: a}]"),
+			`invalid regular expression in matcher team=~"(db"`,
+		},
+		{
+			"unterminated matcher quote",
+			withAlertmanagerConfig("route:\n  receiver: a\n  routes:\n    - matchers: ['{team=\"db}']\nreceivers: [{name: a}]"),
+			"bad matcher format: unterminated quoted string",
+		},
+		{
+			"bad match_re",
+			withAlertmanagerConfig("route:\n  receiver: a\n  routes:\n    - match_re: {service: '(foo'}\nreceivers: [{name: a}]"),
+			`alertmanager_config: route.routes[0]: match_re: invalid regular expression for "service"`,
+		},
+		{
+			"bad group_by label",
+			withAlertmanagerConfig("route:\n  receiver: a\n  group_by: [alert-name]\nreceivers: [{name: a}]"),
+			`invalid label name "alert-name" in group_by`,
+		},
+		{
+			"undefined time interval",
+			withAlertmanagerConfig("route:\n  receiver: a\n  routes:\n    - mute_time_intervals: [nights]\nreceivers: [{name: a}]"),
+			`alertmanager_config: route.routes[0]: undefined time interval "nights" used in route`,
+		},
+		{
+			"bad inhibit matcher",
+			withAlertmanagerConfig("route:\n  receiver: a\ninhibit_rules:\n  - target_matchers: ['severity']\nreceivers: [{name: a}]"),
+			"alertmanager_config: inhibit_rules[0]: target_matchers[0]: bad matcher format: severity",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateAlertManagerDefinition(tc.data)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.message)
+			}
+		})
+	}
+}
+
+func TestAlertManagerDefinitionsEqual(t *testing.T) {
+	reformatted := `alertmanager_config: "route: {receiver: default, group_by: [alertname]}\nreceivers:\n- {name: default}\n"`
+	original := `alertmanager_config: |
+  receivers:
+    - name: default
+  route:
+    group_by:
+      - alertname
+    receiver: default
+`
+	testCases := []struct {
+		name  string
+		a, b  string
+		equal bool
+	}{
+		{"identical", original, original, true},
+		{"reformatted config", original, reformatted, true},
+		{"envelope key order", "template_files: {a: x}\n" + original, original + "template_files:\n  a: x\n", true},
+		{"empty template files", "template_files: {}\n" + original, original, true},
+		{"changed receiver", original, strings.ReplaceAll(original, "default", "other"), false},
+		{"changed group_by", original, strings.Replace(original, "alertname", "cluster", 1), false},
+		{"template whitespace", "template_files: {a: x}\n" + original, "template_files: {a: 'x '}\n" + original, false},
+		{"unparseable", "alertmanager_config: [", "alertmanager_config:  [", false},
+		{"unparseable config", "alertmanager_config: '['", "alertmanager_config: \"[\"", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.equal, AlertManagerDefinitionsEqual(tc.a, tc.b))
+			assert.Equal(t, tc.equal, AlertManagerDefinitionsEqual(tc.b, tc.a))
+		})
+	}
+}
+
+func TestMarkAlertManagerDefinitionOwned(t *testing.T) {
+	assert.False(t, AlertManagerDefinitionOwned(testAlertManagerDefinition))
+
+	marked := MarkAlertManagerDefinitionOwned(testAlertManagerDefinition)
+	assert.True(t, AlertManagerDefinitionOwned(marked))
+	assert.Equal(t, marked, MarkAlertManagerDefinitionOwned(marked))
+	assert.NoError(t, ValidateAlertManagerDefinition(marked))
+	assert.True(t, AlertManagerDefinitionsEqual(marked, testAlertManagerDefinition))
+	assert.Equal(t, testAlertManagerDefinition, UnmarkAlertManagerDefinition(marked))
+	assert.Equal(t, testAlertManagerDefinition, UnmarkAlertManagerDefinition(testAlertManagerDefinition))
+}
@@ -2,15 +2,13 @@ package internal
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"os"
-	"strings"
 
 	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -20,122 +18,130 @@ import (
 var (
 	requestIDHeader   = "x-amzn-RequestId"
 	xrayTraceIDHeader = "X-Amzn-Trace-Id"
-
-	ErrInvalidResourceType = errors.New("invalid resource type")
-)
-
-// generalFailedEvent prevents us from leaking internal information to
-// customers. there are no none cases where this could be a problem. This is
-// just to be safe.
-var generalFailedEvent = handler.ProgressEvent{
-	OperationStatus:  handler.Failed,
-	Message:          "Internal Failure",
-	HandlerErrorCode: cloudformation.HandlerErrorCodeGeneralServiceException,
-}
-
-var (
-	serviceErrorsToHandleErrors = map[string]string{
-		"BadRequestException":                                  cloudformation.HandlerErrorCodeInvalidRequest,
-		request.InvalidParameterErrCode:                        cloudformation.HandlerErrorCodeInvalidRequest,
-		"InvalidRequest":                                       cloudformation.HandlerErrorCodeInvalidRequest,
-		"TooManyRequestsException":                             cloudformation.HandlerErrorCodeThrottling,
-		prometheusservice.ErrCodeThrottlingException:           cloudformation.HandlerErrorCodeThrottling,
-		"NotFoundException":                                    cloudformation.HandlerErrorCodeNotFound,
-		prometheusservice.ErrCodeResourceNotFoundException:     cloudformation.HandlerErrorCodeNotFound,
-		prometheusservice.ErrCodeAccessDeniedException:         cloudformation.HandlerErrorCodeAccessDenied,
-		prometheusservice.ErrCodeValidationException:           cloudformation.HandlerErrorCodeInvalidRequest,
-		prometheusservice.ErrCodeConflictException:             cloudformation.HandlerErrorCodeResourceConflict,
-		prometheusservice.ErrCodeServiceQuotaExceededException: cloudformation.HandlerErrorCodeServiceLimitExceeded,
-	}
 )
 
+// NewFailedEvent returns the failure for err, classified by ClassifyError.
+// The message carries the ID of the failed APS request, if there was one.
+// err is returned along with the event, so Invoke can retry it; Invoke drops
+// it before the event reaches CloudFormation.
 func NewFailedEvent(err error) (handler.ProgressEvent, error) {
-	// log all errors in test mode
+	classified := ClassifyError(err)
+
+	// log all errors in test mode, otherwise only unhandled errors
 	if os.Getenv("MODE") == "Test" {
 		log.Println(err)
-	} // otherwise, only log unhandled errors
-
-	var awsErr awserr.Error
-	if !errors.As(err, &awsErr) {
-		log.Printf("unhandled non awserr error: %v", err)
-		return generalFailedEvent, nil
-	}
-
-	handlerErr, ok := serviceErrorsToHandleErrors[awsErr.Code()]
-	if !ok {
-		log.Printf("unhandled awserr error: %v", err)
-		return generalFailedEvent, nil
-	}
-
-	message := awsErr.Message()
-	if awsErr.Code() == request.InvalidParameterErrCode {
-		message = awsErr.Error()
-		message = strings.TrimPrefix(message, "InvalidParameter: ")
-		// remove \n so validation errors are seen in Console / API
-		message = strings.Replace(message, "\n", "", -1)
-		// remove list notation
-		message = strings.Replace(message, ".- ", ". ", -1)
-	} else if awsErr.Code() == "TooManyRequestsException" {
-		// TooManyRequestsException doesn't have a message by default
-		// so the customer sees "Internal Failure" when message isn't set.
-		message = "API rate limit exceeded"
+	} else if classified.Code == cloudformation.HandlerErrorCodeGeneralServiceException {
+		log.Printf("unhandled error: %v", err)
 	}
 
-	message = awsErr.Code() + ": " + message
-
 	return handler.ProgressEvent{
 		OperationStatus:  handler.Failed,
-		Message:          message,
-		HandlerErrorCode: handlerErr,
-	}, nil
+		Message:          classified.Error(),
+		HandlerErrorCode: classified.Code,
+	}, err
 }
 
-var (
-	supportedResourceTypes = map[string]struct{}{
-		"workspace":           {},
-		"rulegroupsnamespace": {},
+// NewStatusFailedEvent returns the failure for a resource that settled in a
+// terminal failed status such as CREATION_FAILED. The service's status reason
+// is included when it provides one.
+func NewStatusFailedEvent(resource string, statusCode, statusReason *string, model interface{}) handler.ProgressEvent {
+	message := fmt.Sprintf("%s status: %s", resource, aws.StringValue(statusCode))
+	if reason := aws.StringValue(statusReason); reason != "" {
+		message = fmt.Sprintf("%s, reason: %s", message, reason)
 	}
-)
 
-func ParseARN(value string) (*arn.ARN, string, error) {
-	v, err := arn.Parse(value)
-	if err != nil {
-		return nil, "", err
+	return handler.ProgressEvent{
+		OperationStatus:  handler.Failed,
+		Message:          message,
+		HandlerErrorCode: cloudformation.HandlerErrorCodeNotStabilized,
+		ResourceModel:    model,
 	}
+}
 
-	resourceParts := strings.Split(v.Resource, "/")
-	resourceType, resourceID := resourceParts[0], resourceParts[1]
-	_, ok := supportedResourceTypes[resourceType]
-	if !ok {
-		return nil, "", ErrInvalidResourceType
+// NewDeletedOutOfBandEvent returns the failure for a resource that
+// disappeared while a handler was waiting for it to stabilize.
+func NewDeletedOutOfBandEvent(resource string, model interface{}) handler.ProgressEvent {
+	return handler.ProgressEvent{
+		OperationStatus:  handler.Failed,
+		Message:          fmt.Sprintf("%s was deleted out-of-band", resource),
+		HandlerErrorCode: cloudformation.HandlerErrorCodeNotFound,
+		ResourceModel:    model,
 	}
+}
 
-	return &v, resourceID, nil
+// IsNotFound reports whether err is the service's ResourceNotFoundException.
+func IsNotFound(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == prometheusservice.ErrCodeResourceNotFoundException
 }
 
+// APSService is the subset of the prometheusservice API used by the resource
+// handlers. It is satisfied by *Client.
 type APSService interface {
+	CreateWorkspace(input *prometheusservice.CreateWorkspaceInput) (*prometheusservice.CreateWorkspaceOutput, error)
 	DescribeWorkspace(input *prometheusservice.DescribeWorkspaceInput) (*prometheusservice.DescribeWorkspaceOutput, error)
+	ListWorkspaces(input *prometheusservice.ListWorkspacesInput) (*prometheusservice.ListWorkspacesOutput, error)
+	UpdateWorkspaceAlias(input *prometheusservice.UpdateWorkspaceAliasInput) (*prometheusservice.UpdateWorkspaceAliasOutput, error)
+	DeleteWorkspace(input *prometheusservice.DeleteWorkspaceInput) (*prometheusservice.DeleteWorkspaceOutput, error)
+
 	DescribeAlertManagerDefinition(input *prometheusservice.DescribeAlertManagerDefinitionInput) (*prometheusservice.DescribeAlertManagerDefinitionOutput, error)
 	CreateAlertManagerDefinition(input *prometheusservice.CreateAlertManagerDefinitionInput) (*prometheusservice.CreateAlertManagerDefinitionOutput, error)
 	DeleteAlertManagerDefinition(input *prometheusservice.DeleteAlertManagerDefinitionInput) (*prometheusservice.DeleteAlertManagerDefinitionOutput, error)
 	PutAlertManagerDefinition(input *prometheusservice.PutAlertManagerDefinitionInput) (*prometheusservice.PutAlertManagerDefinitionOutput, error)
+
+	CreateLoggingConfiguration(input *prometheusservice.CreateLoggingConfigurationInput) (*prometheusservice.CreateLoggingConfigurationOutput, error)
+	DescribeLoggingConfiguration(input *prometheusservice.DescribeLoggingConfigurationInput) (*prometheusservice.DescribeLoggingConfigurationOutput, error)
+	UpdateLoggingConfiguration(input *prometheusservice.UpdateLoggingConfigurationInput) (*prometheusservice.UpdateLoggingConfigurationOutput, error)
+	DeleteLoggingConfiguration(input *prometheusservice.DeleteLoggingConfigurationInput) (*prometheusservice.DeleteLoggingConfigurationOutput, error)
+
+	CreateRuleGroupsNamespace(input *prometheusservice.CreateRuleGroupsNamespaceInput) (*prometheusservice.CreateRuleGroupsNamespaceOutput, error)
+	DescribeRuleGroupsNamespace(input *prometheusservice.DescribeRuleGroupsNamespaceInput) (*prometheusservice.DescribeRuleGroupsNamespaceOutput, error)
+	ListRuleGroupsNamespaces(input *prometheusservice.ListRuleGroupsNamespacesInput) (*prometheusservice.ListRuleGroupsNamespacesOutput, error)
+	PutRuleGroupsNamespace(input *prometheusservice.PutRuleGroupsNamespaceInput) (*prometheusservice.PutRuleGroupsNamespaceOutput, error)
+	DeleteRuleGroupsNamespace(input *prometheusservice.DeleteRuleGroupsNamespaceInput) (*prometheusservice.DeleteRuleGroupsNamespaceOutput, error)
+
+	CreateScraper(input *prometheusservice.CreateScraperInput) (*prometheusservice.CreateScraperOutput, error)
+	DescribeScraper(input *prometheusservice.DescribeScraperInput) (*prometheusservice.DescribeScraperOutput, error)
+	ListScrapers(input *prometheusservice.ListScrapersInput) (*prometheusservice.ListScrapersOutput, error)
+	UpdateScraper(input *UpdateScraperInput) (*UpdateScraperOutput, error)
+	DeleteScraper(input *prometheusservice.DeleteScraperInput) (*prometheusservice.DeleteScraperOutput, error)
+
+	ListTagsForResource(input *prometheusservice.ListTagsForResourceInput) (*prometheusservice.ListTagsForResourceOutput, error)
+	TagResource(input *prometheusservice.TagResourceInput) (*prometheusservice.TagResourceOutput, error)
+	UntagResource(input *prometheusservice.UntagResourceInput) (*prometheusservice.UntagResourceOutput, error)
+
+	DescribeWorkspaceConfiguration(input *DescribeWorkspaceConfigurationInput) (*DescribeWorkspaceConfigurationOutput, error)
+	UpdateWorkspaceConfiguration(input *UpdateWorkspaceConfigurationInput) (*UpdateWorkspaceConfigurationOutput, error)
+
+	DescribeResourcePolicy(input *DescribeResourcePolicyInput) (*DescribeResourcePolicyOutput, error)
+	PutResourcePolicy(input *PutResourcePolicyInput) (*PutResourcePolicyOutput, error)
+	DeleteResourcePolicy(input *DeleteResourcePolicyInput) (*DeleteResourcePolicyOutput, error)
 }
 
-func NewAPS(sess *session.Session) *prometheusservice.PrometheusService {
-	sess.Handlers.Complete.PushBack(func(r *request.Request) {
-		// Only consider requests with responses that have 5XX status codes
-		if r.HTTPResponse != nil && r.HTTPResponse.StatusCode < 500 {
-			return
-		}
+// Client adds the operations missing from the SDK to the APS client. They are
+// defined next to their input and output types.
+type Client struct {
+	*prometheusservice.PrometheusService
+}
+
+var _ APSService = (*Client)(nil)
+
+// ClientFactory builds the APSService used to serve a handler request for
+// action, e.g. ActionCreate. Resource packages hold one in a package variable
+// so tests can inject a fake.
+type ClientFactory func(req handler.Request, action string) APSService
+
+// NewClient is the ClientFactory used outside of tests. Its calls are logged
+// with the resource and action they were made for.
+func NewClient(req handler.Request, action string) APSService {
+	return &Client{NewAPS(req.Session, NewCallLogger(req.LogicalResourceID, action))}
+}
 
-		// log operation, requestID, and traceID for debugging.
-		log.Printf("%s:%s failed. requestID: %q, traceID: %q.\n",
-			r.ClientInfo.ServiceName,
-			r.Operation.Name,
-			r.HTTPResponse.Header.Get(requestIDHeader),
-			r.HTTPResponse.Header.Get(xrayTraceIDHeader),
-		)
-	})
+// NewAPS returns an APS client for sess whose calls are logged by logger.
+// sess itself is left unchanged.
+func NewAPS(sess *session.Session, logger *CallLogger) *prometheusservice.PrometheusService {
+	sess = sess.Copy()
+	sess.Handlers.Complete.PushBack(logger.Log)
 	return prometheusservice.New(sess)
 }
 
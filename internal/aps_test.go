@@ -5,28 +5,8 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/google/go-cmp/cmp"
-	"github.com/stretchr/testify/assert"
 )
 
-func TestParseARN(t *testing.T) {
-	testCases := []struct {
-		arn          string
-		resourceType string
-		resourceId   string
-	}{
-		{"arn:aws:aps:us-west-2:933102010132:workspace/ws-5f41d54a-41fc-4783-984f-7facb35c928c", "workspace", "ws-5f41d54a-41fc-4783-984f-7facb35c928c"},
-		{"arn:aws:aps:us-west-2:320989744364:rulegroupsnamespace/ws-5291a005-10a2-4b24-aabc-5ce35174430a/Test2", "rulegroupsnamespace", "ws-5291a005-10a2-4b24-aabc-5ce35174430a"},
-	}
-	for _, testCase := range testCases {
-		t.Run(testCase.arn, func(t *testing.T) {
-			arn, workspaceID, err := ParseARN(testCase.arn)
-			assert.NoError(t, err)
-			assert.Contains(t, arn.Resource, testCase.resourceType)
-			assert.Equal(t, testCase.resourceId, workspaceID)
-		})
-	}
-}
-
 func TestStringDiffers(t *testing.T) {
 	testCases := []struct {
 		name               string
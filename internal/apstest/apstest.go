@@ -0,0 +1,1341 @@
+// Package apstest provides an in-memory implementation of internal.APSService
+// for exercising the resource handlers without calling Amazon Managed Service
+// for Prometheus.
+package apstest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+)
+
+const (
+	defaultRegion    = "us-west-2"
+	defaultAccountID = "111111111111"
+
+	defaultFailureReason = "simulated failure"
+)
+
+var _ internal.APSService = (*Service)(nil)
+
+// resourceState tracks the status of a fake resource while it moves through
+// a transitional status towards its target status. An empty target means the
+// resource is removed once the transition completes.
+type resourceState struct {
+	status    string
+	target    string
+	remaining int
+	deleted   bool
+	reason    string
+}
+
+// observe is called on every Describe. It counts down the remaining
+// transitional Describes and settles the resource once none are left.
+func (s *resourceState) observe() {
+	if s.remaining > 0 {
+		s.remaining--
+		return
+	}
+	if s.target == "" {
+		s.deleted = true
+		return
+	}
+	s.status = s.target
+}
+
+func (s *resourceState) transitioning() bool {
+	return s.status != s.target
+}
+
+type workspace struct {
+	resourceState
+	id        string
+	arn       string
+	alias     *string
+	kmsKeyArn *string
+	createdAt time.Time
+	tags      map[string]*string
+
+	configuration workspaceConfiguration
+	policy        *resourcePolicy
+}
+
+type resourcePolicy struct {
+	resourceState
+	document string
+	revision int
+}
+
+type workspaceConfiguration struct {
+	resourceState
+	retentionPeriodInDays int64
+	limitsPerLabelSet     []*internal.LimitsPerLabelSet
+}
+
+type alertManagerDefinition struct {
+	resourceState
+	data       []byte
+	createdAt  time.Time
+	modifiedAt time.Time
+}
+
+type loggingConfiguration struct {
+	resourceState
+	logGroupArn *string
+	createdAt   time.Time
+	modifiedAt  time.Time
+}
+
+type ruleGroupsNamespace struct {
+	resourceState
+	name       string
+	arn        string
+	data       []byte
+	createdAt  time.Time
+	modifiedAt time.Time
+	tags       map[string]*string
+}
+
+type scraper struct {
+	resourceState
+	id                  string
+	arn                 string
+	alias               *string
+	source              *prometheusservice.Source
+	destination         *prometheusservice.Destination
+	scrapeConfiguration []byte
+	createdAt           time.Time
+	modifiedAt          time.Time
+	tags                map[string]*string
+}
+
+// Service is an in-memory fake of the APS API. Resources it creates, updates
+// or deletes report a transitional status (CREATING, UPDATING, DELETING) for
+// TransitionDescribes Describe calls before settling on ACTIVE, on their
+// *_FAILED status when FailTransitions is set, or disappearing when deleted.
+//
+// The zero value is not usable, use NewService.
+type Service struct {
+	// Region and AccountID are used to build resource ARNs.
+	Region    string
+	AccountID string
+
+	// TransitionDescribes is the number of Describe calls for which a
+	// resource keeps reporting its transitional status.
+	TransitionDescribes int
+
+	// FailTransitions makes creates and updates settle on CREATION_FAILED or
+	// UPDATE_FAILED instead of ACTIVE.
+	FailTransitions bool
+
+	// FailureReason is reported as the StatusReason of failed resources.
+	FailureReason string
+
+	mu                      sync.Mutex
+	nextID                  int
+	workspaces              map[string]*workspace
+	alertManagerDefinitions map[string]*alertManagerDefinition
+	loggingConfigurations   map[string]*loggingConfiguration
+	ruleGroupsNamespaces    map[string]map[string]*ruleGroupsNamespace
+	scrapers                map[string]*scraper
+	errors                  map[string][]error
+	calls                   map[string]int
+}
+
+// NewService returns an empty fake whose resources settle after
+// transitionDescribes Describe calls.
+func NewService(transitionDescribes int) *Service {
+	return &Service{
+		Region:                  defaultRegion,
+		AccountID:               defaultAccountID,
+		TransitionDescribes:     transitionDescribes,
+		FailureReason:           defaultFailureReason,
+		workspaces:              map[string]*workspace{},
+		alertManagerDefinitions: map[string]*alertManagerDefinition{},
+		loggingConfigurations:   map[string]*loggingConfiguration{},
+		ruleGroupsNamespaces:    map[string]map[string]*ruleGroupsNamespace{},
+		scrapers:                map[string]*scraper{},
+		errors:                  map[string][]error{},
+		calls:                   map[string]int{},
+	}
+}
+
+// InjectError queues err to be returned by the next call to operation, e.g.
+// "DescribeWorkspace". Queued errors are returned in order, one per call.
+func (s *Service) InjectError(operation string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[operation] = append(s.errors[operation], err)
+}
+
+// Calls returns how many times operation has been invoked.
+func (s *Service) Calls(operation string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[operation]
+}
+
+// begin records a call to operation and returns any error queued for it.
+// It must be called with s.mu held.
+func (s *Service) begin(operation string, input interface{ Validate() error }) error {
+	s.calls[operation]++
+	if queued := s.errors[operation]; len(queued) > 0 {
+		s.errors[operation] = queued[1:]
+		return queued[0]
+	}
+	if input != nil {
+		if err := input.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transition moves state into its transitional status. It settles on target,
+// or on failed when FailTransitions is set and the transition can fail.
+func (s *Service) transition(state *resourceState, transitional, target, failed string) {
+	state.status = transitional
+	state.target = target
+	state.remaining = s.TransitionDescribes
+	state.reason = ""
+	if s.FailTransitions && failed != "" {
+		state.target = failed
+		state.reason = s.FailureReason
+	}
+}
+
+func (s *Service) workspace(id *string) (*workspace, error) {
+	ws, ok := s.workspaces[aws.StringValue(id)]
+	if !ok || ws.deleted {
+		return nil, notFound(aws.StringValue(id), "workspace")
+	}
+	return ws, nil
+}
+
+func (s *Service) CreateWorkspace(input *prometheusservice.CreateWorkspaceInput) (*prometheusservice.CreateWorkspaceOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("CreateWorkspace", input); err != nil {
+		return nil, err
+	}
+
+	s.nextID++
+	id := fmt.Sprintf("ws-%08d-0000-0000-0000-000000000000", s.nextID)
+	ws := &workspace{
+		id:        id,
+		arn:       fmt.Sprintf("arn:aws:aps:%s:%s:workspace/%s", s.Region, s.AccountID, id),
+		alias:     input.Alias,
+		kmsKeyArn: input.KmsKeyArn,
+		createdAt: time.Now(),
+		tags:      copyTags(input.Tags),
+		configuration: workspaceConfiguration{
+			resourceState: resourceState{
+				status: internal.WorkspaceConfigurationStatusCodeActive,
+				target: internal.WorkspaceConfigurationStatusCodeActive,
+			},
+			retentionPeriodInDays: internal.DefaultRetentionPeriodInDays,
+		},
+	}
+	s.transition(&ws.resourceState,
+		prometheusservice.WorkspaceStatusCodeCreating,
+		prometheusservice.WorkspaceStatusCodeActive,
+		prometheusservice.WorkspaceStatusCodeCreationFailed)
+	s.workspaces[id] = ws
+
+	return &prometheusservice.CreateWorkspaceOutput{
+		Arn:         aws.String(ws.arn),
+		KmsKeyArn:   ws.kmsKeyArn,
+		Status:      &prometheusservice.WorkspaceStatus{StatusCode: aws.String(ws.status)},
+		Tags:        copyTags(ws.tags),
+		WorkspaceId: aws.String(id),
+	}, nil
+}
+
+func (s *Service) DescribeWorkspace(input *prometheusservice.DescribeWorkspaceInput) (*prometheusservice.DescribeWorkspaceOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DescribeWorkspace", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	ws.observe()
+	if ws.deleted {
+		delete(s.workspaces, ws.id)
+		return nil, notFound(ws.id, "workspace")
+	}
+
+	return &prometheusservice.DescribeWorkspaceOutput{
+		Workspace: &prometheusservice.WorkspaceDescription{
+			Alias:              ws.alias,
+			Arn:                aws.String(ws.arn),
+			CreatedAt:          aws.Time(ws.createdAt),
+			KmsKeyArn:          ws.kmsKeyArn,
+			PrometheusEndpoint: aws.String(fmt.Sprintf("https://aps-workspaces.%s.amazonaws.com/workspaces/%s/", s.Region, ws.id)),
+			Status:             &prometheusservice.WorkspaceStatus{StatusCode: aws.String(ws.status)},
+			Tags:               copyTags(ws.tags),
+			WorkspaceId:        aws.String(ws.id),
+		},
+	}, nil
+}
+
+func (s *Service) ListWorkspaces(input *prometheusservice.ListWorkspacesInput) (*prometheusservice.ListWorkspacesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("ListWorkspaces", input); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(s.workspaces))
+	for id, ws := range s.workspaces {
+		if ws.deleted || !strings.HasPrefix(aws.StringValue(ws.alias), aws.StringValue(input.Alias)) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	page, nextToken, err := paginate(ids, input.NextToken, input.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*prometheusservice.WorkspaceSummary, 0, len(page))
+	for _, id := range page {
+		ws := s.workspaces[id]
+		summaries = append(summaries, &prometheusservice.WorkspaceSummary{
+			Alias:       ws.alias,
+			Arn:         aws.String(ws.arn),
+			CreatedAt:   aws.Time(ws.createdAt),
+			Status:      &prometheusservice.WorkspaceStatus{StatusCode: aws.String(ws.status)},
+			Tags:        copyTags(ws.tags),
+			WorkspaceId: aws.String(ws.id),
+		})
+	}
+
+	return &prometheusservice.ListWorkspacesOutput{
+		NextToken:  nextToken,
+		Workspaces: summaries,
+	}, nil
+}
+
+func (s *Service) UpdateWorkspaceAlias(input *prometheusservice.UpdateWorkspaceAliasInput) (*prometheusservice.UpdateWorkspaceAliasOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("UpdateWorkspaceAlias", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	if ws.transitioning() {
+		return nil, conflict(ws.id, "workspace")
+	}
+	ws.alias = input.Alias
+	// a workspace does not have an UPDATE_FAILED state
+	s.transition(&ws.resourceState,
+		prometheusservice.WorkspaceStatusCodeUpdating,
+		prometheusservice.WorkspaceStatusCodeActive,
+		"")
+
+	return &prometheusservice.UpdateWorkspaceAliasOutput{}, nil
+}
+
+func (s *Service) DeleteWorkspace(input *prometheusservice.DeleteWorkspaceInput) (*prometheusservice.DeleteWorkspaceOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DeleteWorkspace", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	s.transition(&ws.resourceState, prometheusservice.WorkspaceStatusCodeDeleting, "", "")
+	// deleting a workspace deletes everything it contains
+	delete(s.alertManagerDefinitions, ws.id)
+	delete(s.loggingConfigurations, ws.id)
+	delete(s.ruleGroupsNamespaces, ws.id)
+
+	return &prometheusservice.DeleteWorkspaceOutput{}, nil
+}
+
+func (s *Service) DescribeWorkspaceConfiguration(input *internal.DescribeWorkspaceConfigurationInput) (*internal.DescribeWorkspaceConfigurationOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DescribeWorkspaceConfiguration", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	config := &ws.configuration
+	config.observe()
+
+	return &internal.DescribeWorkspaceConfigurationOutput{
+		WorkspaceConfiguration: &internal.WorkspaceConfigurationDescription{
+			LimitsPerLabelSet:     copyLimits(config.limitsPerLabelSet),
+			RetentionPeriodInDays: aws.Int64(config.retentionPeriodInDays),
+			Status:                config.statusOutput(),
+		},
+	}, nil
+}
+
+func (s *Service) UpdateWorkspaceConfiguration(input *internal.UpdateWorkspaceConfigurationInput) (*internal.UpdateWorkspaceConfigurationOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("UpdateWorkspaceConfiguration", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	config := &ws.configuration
+	if ws.transitioning() || config.transitioning() {
+		return nil, conflict(ws.id, "workspace")
+	}
+	if input.RetentionPeriodInDays != nil {
+		config.retentionPeriodInDays = *input.RetentionPeriodInDays
+	}
+	if input.LimitsPerLabelSet != nil {
+		config.limitsPerLabelSet = copyLimits(input.LimitsPerLabelSet)
+	}
+	s.transition(&config.resourceState,
+		internal.WorkspaceConfigurationStatusCodeUpdating,
+		internal.WorkspaceConfigurationStatusCodeActive,
+		internal.WorkspaceConfigurationStatusCodeUpdateFailed)
+
+	return &internal.UpdateWorkspaceConfigurationOutput{
+		Status: config.statusOutput(),
+	}, nil
+}
+
+func (c *workspaceConfiguration) statusOutput() *internal.WorkspaceConfigurationStatus {
+	status := &internal.WorkspaceConfigurationStatus{StatusCode: aws.String(c.status)}
+	if c.reason != "" && !c.transitioning() {
+		status.StatusReason = aws.String(c.reason)
+	}
+	return status
+}
+
+// resourcePolicy returns the policy of a workspace and checks that revisionID,
+// when set, is its current revision.
+func (s *Service) resourcePolicy(workspaceID, revisionID *string) (*workspace, *resourcePolicy, error) {
+	ws, err := s.workspace(workspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ws.policy == nil || ws.policy.deleted {
+		return ws, nil, notFound(ws.id, "resourcepolicy")
+	}
+	if revisionID != nil && *revisionID != ws.policy.revisionID() {
+		return nil, nil, conflict(ws.id, "resourcepolicy")
+	}
+	return ws, ws.policy, nil
+}
+
+func (s *Service) DescribeResourcePolicy(input *internal.DescribeResourcePolicyInput) (*internal.DescribeResourcePolicyOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DescribeResourcePolicy", input); err != nil {
+		return nil, err
+	}
+
+	ws, policy, err := s.resourcePolicy(input.WorkspaceId, nil)
+	if err != nil {
+		return nil, err
+	}
+	policy.observe()
+	if policy.deleted {
+		ws.policy = nil
+		return nil, notFound(ws.id, "resourcepolicy")
+	}
+
+	return &internal.DescribeResourcePolicyOutput{
+		PolicyDocument: aws.String(policy.document),
+		PolicyStatus:   aws.String(policy.status),
+		RevisionId:     aws.String(policy.revisionID()),
+	}, nil
+}
+
+func (s *Service) PutResourcePolicy(input *internal.PutResourcePolicyInput) (*internal.PutResourcePolicyOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("PutResourcePolicy", input); err != nil {
+		return nil, err
+	}
+
+	ws, policy, err := s.resourcePolicy(input.WorkspaceId, input.RevisionId)
+	switch {
+	case internal.IsNotFound(err) && ws != nil:
+		if input.RevisionId != nil {
+			return nil, conflict(ws.id, "resourcepolicy")
+		}
+		policy = &resourcePolicy{}
+		ws.policy = policy
+		s.transition(&policy.resourceState,
+			internal.WorkspacePolicyStatusCodeCreating,
+			internal.WorkspacePolicyStatusCodeActive,
+			"")
+	case err != nil:
+		return nil, err
+	case policy.transitioning():
+		return nil, conflict(ws.id, "resourcepolicy")
+	default:
+		s.transition(&policy.resourceState,
+			internal.WorkspacePolicyStatusCodeUpdating,
+			internal.WorkspacePolicyStatusCodeActive,
+			"")
+	}
+	policy.document = aws.StringValue(input.PolicyDocument)
+	policy.revision++
+
+	return &internal.PutResourcePolicyOutput{
+		PolicyStatus: aws.String(policy.status),
+		RevisionId:   aws.String(policy.revisionID()),
+	}, nil
+}
+
+func (s *Service) DeleteResourcePolicy(input *internal.DeleteResourcePolicyInput) (*internal.DeleteResourcePolicyOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DeleteResourcePolicy", input); err != nil {
+		return nil, err
+	}
+
+	_, policy, err := s.resourcePolicy(input.WorkspaceId, input.RevisionId)
+	if err != nil {
+		return nil, err
+	}
+	s.transition(&policy.resourceState, internal.WorkspacePolicyStatusCodeDeleting, "", "")
+
+	return &internal.DeleteResourcePolicyOutput{}, nil
+}
+
+func (p *resourcePolicy) revisionID() string {
+	return strconv.Itoa(p.revision)
+}
+
+func copyLimits(limits []*internal.LimitsPerLabelSet) []*internal.LimitsPerLabelSet {
+	copied := make([]*internal.LimitsPerLabelSet, 0, len(limits))
+	for _, l := range limits {
+		entry := &internal.LimitsPerLabelSetEntry{}
+		if l.Limits != nil && l.Limits.MaxSeries != nil {
+			entry.MaxSeries = aws.Int64(*l.Limits.MaxSeries)
+		}
+		copied = append(copied, &internal.LimitsPerLabelSet{
+			LabelSet: copyTags(l.LabelSet),
+			Limits:   entry,
+		})
+	}
+	return copied
+}
+
+func (s *Service) CreateAlertManagerDefinition(input *prometheusservice.CreateAlertManagerDefinitionInput) (*prometheusservice.CreateAlertManagerDefinitionOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("CreateAlertManagerDefinition", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	if amd, ok := s.alertManagerDefinitions[ws.id]; ok && !amd.deleted {
+		return nil, conflict(ws.id, "alertmanagerdefinition")
+	}
+
+	now := time.Now()
+	amd := &alertManagerDefinition{
+		data:       append([]byte(nil), input.Data...),
+		createdAt:  now,
+		modifiedAt: now,
+	}
+	s.transition(&amd.resourceState,
+		prometheusservice.AlertManagerDefinitionStatusCodeCreating,
+		prometheusservice.AlertManagerDefinitionStatusCodeActive,
+		prometheusservice.AlertManagerDefinitionStatusCodeCreationFailed)
+	s.alertManagerDefinitions[ws.id] = amd
+
+	return &prometheusservice.CreateAlertManagerDefinitionOutput{
+		Status: amd.statusOutput(),
+	}, nil
+}
+
+func (s *Service) DescribeAlertManagerDefinition(input *prometheusservice.DescribeAlertManagerDefinitionInput) (*prometheusservice.DescribeAlertManagerDefinitionOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DescribeAlertManagerDefinition", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	amd, ok := s.alertManagerDefinitions[ws.id]
+	if !ok || amd.deleted {
+		return nil, notFound(ws.id, "alertmanagerdefinition")
+	}
+	amd.observe()
+	if amd.deleted {
+		delete(s.alertManagerDefinitions, ws.id)
+		return nil, notFound(ws.id, "alertmanagerdefinition")
+	}
+
+	return &prometheusservice.DescribeAlertManagerDefinitionOutput{
+		AlertManagerDefinition: &prometheusservice.AlertManagerDefinitionDescription{
+			CreatedAt:  aws.Time(amd.createdAt),
+			Data:       append([]byte(nil), amd.data...),
+			ModifiedAt: aws.Time(amd.modifiedAt),
+			Status:     amd.statusOutput(),
+		},
+	}, nil
+}
+
+func (s *Service) PutAlertManagerDefinition(input *prometheusservice.PutAlertManagerDefinitionInput) (*prometheusservice.PutAlertManagerDefinitionOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("PutAlertManagerDefinition", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	amd, ok := s.alertManagerDefinitions[ws.id]
+	if !ok || amd.deleted {
+		return nil, notFound(ws.id, "alertmanagerdefinition")
+	}
+	if amd.transitioning() {
+		return nil, conflict(ws.id, "alertmanagerdefinition")
+	}
+	amd.data = append([]byte(nil), input.Data...)
+	amd.modifiedAt = time.Now()
+	s.transition(&amd.resourceState,
+		prometheusservice.AlertManagerDefinitionStatusCodeUpdating,
+		prometheusservice.AlertManagerDefinitionStatusCodeActive,
+		prometheusservice.AlertManagerDefinitionStatusCodeUpdateFailed)
+
+	return &prometheusservice.PutAlertManagerDefinitionOutput{
+		Status: amd.statusOutput(),
+	}, nil
+}
+
+func (s *Service) DeleteAlertManagerDefinition(input *prometheusservice.DeleteAlertManagerDefinitionInput) (*prometheusservice.DeleteAlertManagerDefinitionOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DeleteAlertManagerDefinition", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	amd, ok := s.alertManagerDefinitions[ws.id]
+	if !ok || amd.deleted {
+		return nil, notFound(ws.id, "alertmanagerdefinition")
+	}
+	s.transition(&amd.resourceState, prometheusservice.AlertManagerDefinitionStatusCodeDeleting, "", "")
+
+	return &prometheusservice.DeleteAlertManagerDefinitionOutput{}, nil
+}
+
+func (amd *alertManagerDefinition) statusOutput() *prometheusservice.AlertManagerDefinitionStatus {
+	status := &prometheusservice.AlertManagerDefinitionStatus{StatusCode: aws.String(amd.status)}
+	if amd.reason != "" && !amd.transitioning() {
+		status.StatusReason = aws.String(amd.reason)
+	}
+	return status
+}
+
+func (s *Service) loggingConfiguration(workspaceID *string) (*workspace, *loggingConfiguration, error) {
+	ws, err := s.workspace(workspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	lc, ok := s.loggingConfigurations[ws.id]
+	if !ok || lc.deleted {
+		return nil, nil, notFound(ws.id, "loggingconfiguration")
+	}
+	return ws, lc, nil
+}
+
+func (s *Service) CreateLoggingConfiguration(input *prometheusservice.CreateLoggingConfigurationInput) (*prometheusservice.CreateLoggingConfigurationOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("CreateLoggingConfiguration", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	if lc, ok := s.loggingConfigurations[ws.id]; ok && !lc.deleted {
+		return nil, conflict(ws.id, "loggingconfiguration")
+	}
+
+	now := time.Now()
+	lc := &loggingConfiguration{
+		logGroupArn: aws.String(aws.StringValue(input.LogGroupArn)),
+		createdAt:   now,
+		modifiedAt:  now,
+	}
+	s.transition(&lc.resourceState,
+		prometheusservice.LoggingConfigurationStatusCodeCreating,
+		prometheusservice.LoggingConfigurationStatusCodeActive,
+		prometheusservice.LoggingConfigurationStatusCodeCreationFailed)
+	s.loggingConfigurations[ws.id] = lc
+
+	return &prometheusservice.CreateLoggingConfigurationOutput{
+		Status: lc.statusOutput(),
+	}, nil
+}
+
+func (s *Service) DescribeLoggingConfiguration(input *prometheusservice.DescribeLoggingConfigurationInput) (*prometheusservice.DescribeLoggingConfigurationOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DescribeLoggingConfiguration", input); err != nil {
+		return nil, err
+	}
+
+	ws, lc, err := s.loggingConfiguration(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	lc.observe()
+	if lc.deleted {
+		delete(s.loggingConfigurations, ws.id)
+		return nil, notFound(ws.id, "loggingconfiguration")
+	}
+
+	return &prometheusservice.DescribeLoggingConfigurationOutput{
+		LoggingConfiguration: &prometheusservice.LoggingConfigurationMetadata{
+			CreatedAt:   aws.Time(lc.createdAt),
+			LogGroupArn: aws.String(aws.StringValue(lc.logGroupArn)),
+			ModifiedAt:  aws.Time(lc.modifiedAt),
+			Status:      lc.statusOutput(),
+			Workspace:   aws.String(ws.id),
+		},
+	}, nil
+}
+
+func (s *Service) UpdateLoggingConfiguration(input *prometheusservice.UpdateLoggingConfigurationInput) (*prometheusservice.UpdateLoggingConfigurationOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("UpdateLoggingConfiguration", input); err != nil {
+		return nil, err
+	}
+
+	ws, lc, err := s.loggingConfiguration(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	if lc.transitioning() {
+		return nil, conflict(ws.id, "loggingconfiguration")
+	}
+	lc.logGroupArn = aws.String(aws.StringValue(input.LogGroupArn))
+	lc.modifiedAt = time.Now()
+	s.transition(&lc.resourceState,
+		prometheusservice.LoggingConfigurationStatusCodeUpdating,
+		prometheusservice.LoggingConfigurationStatusCodeActive,
+		prometheusservice.LoggingConfigurationStatusCodeUpdateFailed)
+
+	return &prometheusservice.UpdateLoggingConfigurationOutput{
+		Status: lc.statusOutput(),
+	}, nil
+}
+
+func (s *Service) DeleteLoggingConfiguration(input *prometheusservice.DeleteLoggingConfigurationInput) (*prometheusservice.DeleteLoggingConfigurationOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DeleteLoggingConfiguration", input); err != nil {
+		return nil, err
+	}
+
+	_, lc, err := s.loggingConfiguration(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	s.transition(&lc.resourceState, prometheusservice.LoggingConfigurationStatusCodeDeleting, "", "")
+
+	return &prometheusservice.DeleteLoggingConfigurationOutput{}, nil
+}
+
+func (lc *loggingConfiguration) statusOutput() *prometheusservice.LoggingConfigurationStatus {
+	status := &prometheusservice.LoggingConfigurationStatus{StatusCode: aws.String(lc.status)}
+	if lc.reason != "" && !lc.transitioning() {
+		status.StatusReason = aws.String(lc.reason)
+	}
+	return status
+}
+
+func (s *Service) ruleGroupsNamespace(workspaceID, name *string) (*ruleGroupsNamespace, error) {
+	ws, err := s.workspace(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	ns, ok := s.ruleGroupsNamespaces[ws.id][aws.StringValue(name)]
+	if !ok || ns.deleted {
+		return nil, notFound(aws.StringValue(name), "rulegroupsnamespace")
+	}
+	return ns, nil
+}
+
+func (s *Service) CreateRuleGroupsNamespace(input *prometheusservice.CreateRuleGroupsNamespaceInput) (*prometheusservice.CreateRuleGroupsNamespaceOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("CreateRuleGroupsNamespace", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Name)
+	if ns, ok := s.ruleGroupsNamespaces[ws.id][name]; ok && !ns.deleted {
+		return nil, conflict(name, "rulegroupsnamespace")
+	}
+
+	now := time.Now()
+	ns := &ruleGroupsNamespace{
+		name:       name,
+		arn:        fmt.Sprintf("arn:aws:aps:%s:%s:rulegroupsnamespace/%s/%s", s.Region, s.AccountID, ws.id, name),
+		data:       append([]byte(nil), input.Data...),
+		createdAt:  now,
+		modifiedAt: now,
+		tags:       copyTags(input.Tags),
+	}
+	s.transition(&ns.resourceState,
+		prometheusservice.RuleGroupsNamespaceStatusCodeCreating,
+		prometheusservice.RuleGroupsNamespaceStatusCodeActive,
+		prometheusservice.RuleGroupsNamespaceStatusCodeCreationFailed)
+	if s.ruleGroupsNamespaces[ws.id] == nil {
+		s.ruleGroupsNamespaces[ws.id] = map[string]*ruleGroupsNamespace{}
+	}
+	s.ruleGroupsNamespaces[ws.id][name] = ns
+
+	return &prometheusservice.CreateRuleGroupsNamespaceOutput{
+		Arn:    aws.String(ns.arn),
+		Name:   aws.String(ns.name),
+		Status: ns.statusOutput(),
+		Tags:   copyTags(ns.tags),
+	}, nil
+}
+
+func (s *Service) DescribeRuleGroupsNamespace(input *prometheusservice.DescribeRuleGroupsNamespaceInput) (*prometheusservice.DescribeRuleGroupsNamespaceOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DescribeRuleGroupsNamespace", input); err != nil {
+		return nil, err
+	}
+
+	ns, err := s.ruleGroupsNamespace(input.WorkspaceId, input.Name)
+	if err != nil {
+		return nil, err
+	}
+	ns.observe()
+	if ns.deleted {
+		delete(s.ruleGroupsNamespaces[aws.StringValue(input.WorkspaceId)], ns.name)
+		return nil, notFound(ns.name, "rulegroupsnamespace")
+	}
+
+	return &prometheusservice.DescribeRuleGroupsNamespaceOutput{
+		RuleGroupsNamespace: &prometheusservice.RuleGroupsNamespaceDescription{
+			Arn:        aws.String(ns.arn),
+			CreatedAt:  aws.Time(ns.createdAt),
+			Data:       append([]byte(nil), ns.data...),
+			ModifiedAt: aws.Time(ns.modifiedAt),
+			Name:       aws.String(ns.name),
+			Status:     ns.statusOutput(),
+			Tags:       copyTags(ns.tags),
+		},
+	}, nil
+}
+
+func (s *Service) ListRuleGroupsNamespaces(input *prometheusservice.ListRuleGroupsNamespacesInput) (*prometheusservice.ListRuleGroupsNamespacesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("ListRuleGroupsNamespaces", input); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspace(input.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(s.ruleGroupsNamespaces[ws.id]))
+	for name, ns := range s.ruleGroupsNamespaces[ws.id] {
+		if ns.deleted || !strings.HasPrefix(name, aws.StringValue(input.Name)) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	page, nextToken, err := paginate(names, input.NextToken, input.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*prometheusservice.RuleGroupsNamespaceSummary, 0, len(page))
+	for _, name := range page {
+		ns := s.ruleGroupsNamespaces[ws.id][name]
+		summaries = append(summaries, &prometheusservice.RuleGroupsNamespaceSummary{
+			Arn:        aws.String(ns.arn),
+			CreatedAt:  aws.Time(ns.createdAt),
+			ModifiedAt: aws.Time(ns.modifiedAt),
+			Name:       aws.String(ns.name),
+			Status:     ns.statusOutput(),
+			Tags:       copyTags(ns.tags),
+		})
+	}
+
+	return &prometheusservice.ListRuleGroupsNamespacesOutput{
+		NextToken:            nextToken,
+		RuleGroupsNamespaces: summaries,
+	}, nil
+}
+
+func (s *Service) PutRuleGroupsNamespace(input *prometheusservice.PutRuleGroupsNamespaceInput) (*prometheusservice.PutRuleGroupsNamespaceOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("PutRuleGroupsNamespace", input); err != nil {
+		return nil, err
+	}
+
+	ns, err := s.ruleGroupsNamespace(input.WorkspaceId, input.Name)
+	if err != nil {
+		return nil, err
+	}
+	if ns.transitioning() {
+		return nil, conflict(ns.name, "rulegroupsnamespace")
+	}
+	ns.data = append([]byte(nil), input.Data...)
+	ns.modifiedAt = time.Now()
+	s.transition(&ns.resourceState,
+		prometheusservice.RuleGroupsNamespaceStatusCodeUpdating,
+		prometheusservice.RuleGroupsNamespaceStatusCodeActive,
+		prometheusservice.RuleGroupsNamespaceStatusCodeUpdateFailed)
+
+	return &prometheusservice.PutRuleGroupsNamespaceOutput{
+		Arn:    aws.String(ns.arn),
+		Name:   aws.String(ns.name),
+		Status: ns.statusOutput(),
+		Tags:   copyTags(ns.tags),
+	}, nil
+}
+
+func (s *Service) DeleteRuleGroupsNamespace(input *prometheusservice.DeleteRuleGroupsNamespaceInput) (*prometheusservice.DeleteRuleGroupsNamespaceOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DeleteRuleGroupsNamespace", input); err != nil {
+		return nil, err
+	}
+
+	ns, err := s.ruleGroupsNamespace(input.WorkspaceId, input.Name)
+	if err != nil {
+		return nil, err
+	}
+	s.transition(&ns.resourceState, prometheusservice.RuleGroupsNamespaceStatusCodeDeleting, "", "")
+
+	return &prometheusservice.DeleteRuleGroupsNamespaceOutput{}, nil
+}
+
+func (ns *ruleGroupsNamespace) statusOutput() *prometheusservice.RuleGroupsNamespaceStatus {
+	status := &prometheusservice.RuleGroupsNamespaceStatus{StatusCode: aws.String(ns.status)}
+	if ns.reason != "" && !ns.transitioning() {
+		status.StatusReason = aws.String(ns.reason)
+	}
+	return status
+}
+
+func (s *Service) scraper(id *string) (*scraper, error) {
+	sc, ok := s.scrapers[aws.StringValue(id)]
+	if !ok || sc.deleted {
+		return nil, notFound(aws.StringValue(id), "scraper")
+	}
+	return sc, nil
+}
+
+// validateDestination checks that a scraper destination is an existing
+// workspace.
+func (s *Service) validateDestination(destination *prometheusservice.Destination) error {
+	if destination == nil || destination.AmpConfiguration == nil {
+		return &prometheusservice.ValidationException{
+			Message_: aws.String("destination must be an Amazon Managed Service for Prometheus workspace"),
+			Reason:   aws.String(prometheusservice.ValidationExceptionReasonFieldValidationFailed),
+		}
+	}
+	workspaceARN := aws.StringValue(destination.AmpConfiguration.WorkspaceArn)
+	parsed, err := internal.ParseWorkspaceARN(workspaceARN)
+	if err == nil {
+		_, err = s.workspace(aws.String(parsed.WorkspaceID))
+	}
+	if err != nil {
+		return &prometheusservice.ValidationException{
+			Message_: aws.String("Invalid destination."),
+			Reason:   aws.String(prometheusservice.ValidationExceptionReasonFieldValidationFailed),
+			FieldList: []*prometheusservice.ValidationExceptionField{{
+				Name:    aws.String("destination.ampConfiguration.workspaceArn"),
+				Message: aws.String(fmt.Sprintf("workspace %s does not exist", workspaceARN)),
+			}},
+		}
+	}
+	return nil
+}
+
+func (s *Service) CreateScraper(input *prometheusservice.CreateScraperInput) (*prometheusservice.CreateScraperOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("CreateScraper", input); err != nil {
+		return nil, err
+	}
+	if err := s.validateDestination(input.Destination); err != nil {
+		return nil, err
+	}
+
+	s.nextID++
+	id := fmt.Sprintf("s-%08d-0000-0000-0000-000000000000", s.nextID)
+	now := time.Now()
+	sc := &scraper{
+		id:                  id,
+		arn:                 fmt.Sprintf("arn:aws:aps:%s:%s:scraper/%s", s.Region, s.AccountID, id),
+		alias:               input.Alias,
+		source:              input.Source,
+		destination:         input.Destination,
+		scrapeConfiguration: append([]byte(nil), input.ScrapeConfiguration.ConfigurationBlob...),
+		createdAt:           now,
+		modifiedAt:          now,
+		tags:                copyTags(input.Tags),
+	}
+	s.transition(&sc.resourceState,
+		prometheusservice.ScraperStatusCodeCreating,
+		prometheusservice.ScraperStatusCodeActive,
+		prometheusservice.ScraperStatusCodeCreationFailed)
+	s.scrapers[id] = sc
+
+	return &prometheusservice.CreateScraperOutput{
+		Arn:       aws.String(sc.arn),
+		ScraperId: aws.String(id),
+		Status:    &prometheusservice.ScraperStatus{StatusCode: aws.String(sc.status)},
+		Tags:      copyTags(sc.tags),
+	}, nil
+}
+
+func (s *Service) DescribeScraper(input *prometheusservice.DescribeScraperInput) (*prometheusservice.DescribeScraperOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DescribeScraper", input); err != nil {
+		return nil, err
+	}
+
+	sc, err := s.scraper(input.ScraperId)
+	if err != nil {
+		return nil, err
+	}
+	sc.observe()
+	if sc.deleted {
+		delete(s.scrapers, sc.id)
+		return nil, notFound(sc.id, "scraper")
+	}
+
+	description := &prometheusservice.ScraperDescription{
+		Alias:               sc.alias,
+		Arn:                 aws.String(sc.arn),
+		CreatedAt:           aws.Time(sc.createdAt),
+		Destination:         sc.destination,
+		LastModifiedAt:      aws.Time(sc.modifiedAt),
+		RoleArn:             aws.String(fmt.Sprintf("arn:aws:iam::%s:role/aws-service-role/scraper.aps.amazonaws.com/AWSServiceRoleForAmazonPrometheusScraper", s.AccountID)),
+		ScrapeConfiguration: &prometheusservice.ScrapeConfiguration{ConfigurationBlob: append([]byte(nil), sc.scrapeConfiguration...)},
+		ScraperId:           aws.String(sc.id),
+		Source:              sc.source,
+		Status:              &prometheusservice.ScraperStatus{StatusCode: aws.String(sc.status)},
+		Tags:                copyTags(sc.tags),
+	}
+	if sc.reason != "" && !sc.transitioning() {
+		description.StatusReason = aws.String(sc.reason)
+	}
+	return &prometheusservice.DescribeScraperOutput{Scraper: description}, nil
+}
+
+// ListScrapers supports the alias and status filters.
+func (s *Service) ListScrapers(input *prometheusservice.ListScrapersInput) (*prometheusservice.ListScrapersOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("ListScrapers", input); err != nil {
+		return nil, err
+	}
+
+	matches := func(values []*string, value *string) bool {
+		if len(values) == 0 {
+			return true
+		}
+		for _, v := range values {
+			if aws.StringValue(v) == aws.StringValue(value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ids := make([]string, 0, len(s.scrapers))
+	for id, sc := range s.scrapers {
+		if sc.deleted ||
+			!matches(input.Filters["alias"], sc.alias) ||
+			!matches(input.Filters["status"], aws.String(sc.status)) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	page, nextToken, err := paginate(ids, input.NextToken, input.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*prometheusservice.ScraperSummary, 0, len(page))
+	for _, id := range page {
+		sc := s.scrapers[id]
+		summaries = append(summaries, &prometheusservice.ScraperSummary{
+			Alias:          sc.alias,
+			Arn:            aws.String(sc.arn),
+			CreatedAt:      aws.Time(sc.createdAt),
+			Destination:    sc.destination,
+			LastModifiedAt: aws.Time(sc.modifiedAt),
+			ScraperId:      aws.String(sc.id),
+			Source:         sc.source,
+			Status:         &prometheusservice.ScraperStatus{StatusCode: aws.String(sc.status)},
+			Tags:           copyTags(sc.tags),
+		})
+	}
+
+	return &prometheusservice.ListScrapersOutput{
+		NextToken: nextToken,
+		Scrapers:  summaries,
+	}, nil
+}
+
+func (s *Service) UpdateScraper(input *internal.UpdateScraperInput) (*internal.UpdateScraperOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("UpdateScraper", input); err != nil {
+		return nil, err
+	}
+
+	sc, err := s.scraper(input.ScraperId)
+	if err != nil {
+		return nil, err
+	}
+	if sc.transitioning() {
+		return nil, conflict(sc.id, "scraper")
+	}
+	if input.Destination != nil {
+		if err := s.validateDestination(input.Destination); err != nil {
+			return nil, err
+		}
+		sc.destination = input.Destination
+	}
+	if input.Alias != nil {
+		sc.alias = input.Alias
+	}
+	if input.ScrapeConfiguration != nil {
+		sc.scrapeConfiguration = append([]byte(nil), input.ScrapeConfiguration.ConfigurationBlob...)
+	}
+	sc.modifiedAt = time.Now()
+	s.transition(&sc.resourceState,
+		internal.ScraperStatusCodeUpdating,
+		prometheusservice.ScraperStatusCodeActive,
+		internal.ScraperStatusCodeUpdateFailed)
+
+	return &internal.UpdateScraperOutput{
+		Arn:       aws.String(sc.arn),
+		ScraperId: aws.String(sc.id),
+		Status:    &prometheusservice.ScraperStatus{StatusCode: aws.String(sc.status)},
+		Tags:      copyTags(sc.tags),
+	}, nil
+}
+
+func (s *Service) DeleteScraper(input *prometheusservice.DeleteScraperInput) (*prometheusservice.DeleteScraperOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("DeleteScraper", input); err != nil {
+		return nil, err
+	}
+
+	sc, err := s.scraper(input.ScraperId)
+	if err != nil {
+		return nil, err
+	}
+	if sc.transitioning() {
+		return nil, conflict(sc.id, "scraper")
+	}
+	s.transition(&sc.resourceState, prometheusservice.ScraperStatusCodeDeleting, "", "")
+
+	return &prometheusservice.DeleteScraperOutput{
+		ScraperId: aws.String(sc.id),
+		Status:    &prometheusservice.ScraperStatus{StatusCode: aws.String(sc.status)},
+	}, nil
+}
+
+// taggable returns the tags of the resource identified by resourceARN.
+func (s *Service) taggable(resourceARN *string) (map[string]*string, error) {
+	for _, sc := range s.scrapers {
+		if !sc.deleted && sc.arn == aws.StringValue(resourceARN) {
+			if sc.tags == nil {
+				sc.tags = map[string]*string{}
+			}
+			return sc.tags, nil
+		}
+	}
+	for _, ws := range s.workspaces {
+		if ws.deleted {
+			continue
+		}
+		if ws.arn == aws.StringValue(resourceARN) {
+			if ws.tags == nil {
+				ws.tags = map[string]*string{}
+			}
+			return ws.tags, nil
+		}
+		for _, ns := range s.ruleGroupsNamespaces[ws.id] {
+			if !ns.deleted && ns.arn == aws.StringValue(resourceARN) {
+				if ns.tags == nil {
+					ns.tags = map[string]*string{}
+				}
+				return ns.tags, nil
+			}
+		}
+	}
+	return nil, notFound(aws.StringValue(resourceARN), "resource")
+}
+
+func (s *Service) ListTagsForResource(input *prometheusservice.ListTagsForResourceInput) (*prometheusservice.ListTagsForResourceOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("ListTagsForResource", input); err != nil {
+		return nil, err
+	}
+
+	tags, err := s.taggable(input.ResourceArn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &prometheusservice.ListTagsForResourceOutput{
+		Tags: copyTags(tags),
+	}, nil
+}
+
+func (s *Service) TagResource(input *prometheusservice.TagResourceInput) (*prometheusservice.TagResourceOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("TagResource", input); err != nil {
+		return nil, err
+	}
+
+	tags, err := s.taggable(input.ResourceArn)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range input.Tags {
+		tags[k] = aws.String(aws.StringValue(v))
+	}
+
+	return &prometheusservice.TagResourceOutput{}, nil
+}
+
+func (s *Service) UntagResource(input *prometheusservice.UntagResourceInput) (*prometheusservice.UntagResourceOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.begin("UntagResource", input); err != nil {
+		return nil, err
+	}
+
+	tags, err := s.taggable(input.ResourceArn)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range input.TagKeys {
+		delete(tags, aws.StringValue(k))
+	}
+
+	return &prometheusservice.UntagResourceOutput{}, nil
+}
+
+// paginate returns the page of keys starting at the offset encoded in
+// nextToken, and the token of the following page if there is one.
+func paginate(keys []string, nextToken *string, maxResults *int64) ([]string, *string, error) {
+	start := 0
+	if nextToken != nil {
+		var err error
+		start, err = strconv.Atoi(*nextToken)
+		if err != nil || start < 0 || start > len(keys) {
+			return nil, nil, &prometheusservice.ValidationException{
+				Message_: aws.String("invalid nextToken"),
+				Reason:   aws.String(prometheusservice.ValidationExceptionReasonOther),
+			}
+		}
+	}
+
+	end := len(keys)
+	if maxResults != nil && start+int(*maxResults) < end {
+		end = start + int(*maxResults)
+	}
+
+	if end == len(keys) {
+		return keys[start:end], nil, nil
+	}
+	return keys[start:end], aws.String(strconv.Itoa(end)), nil
+}
+
+func copyTags(tags map[string]*string) map[string]*string {
+	if tags == nil {
+		return nil
+	}
+	res := make(map[string]*string, len(tags))
+	for k, v := range tags {
+		res[k] = aws.String(aws.StringValue(v))
+	}
+	return res
+}
+
+func notFound(id, resourceType string) error {
+	return &prometheusservice.ResourceNotFoundException{
+		Message_:     aws.String(fmt.Sprintf("%s %s not found", resourceType, id)),
+		ResourceId:   aws.String(id),
+		ResourceType: aws.String(resourceType),
+	}
+}
+
+func conflict(id, resourceType string) error {
+	return &prometheusservice.ConflictException{
+		Message_:     aws.String(fmt.Sprintf("%s %s is being modified", resourceType, id)),
+		ResourceId:   aws.String(id),
+		ResourceType: aws.String(resourceType),
+	}
+}
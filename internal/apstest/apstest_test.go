@@ -0,0 +1,314 @@
+package apstest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func errorCode(err error) string {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code()
+	}
+	return ""
+}
+
+func TestService_workspaceTransitions(t *testing.T) {
+	svc := NewService(2)
+
+	created, err := svc.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{Alias: aws.String("alias")})
+	require.NoError(t, err)
+	assert.Equal(t, prometheusservice.WorkspaceStatusCodeCreating, aws.StringValue(created.Status.StatusCode))
+
+	describe := func() (*prometheusservice.DescribeWorkspaceOutput, error) {
+		return svc.DescribeWorkspace(&prometheusservice.DescribeWorkspaceInput{WorkspaceId: created.WorkspaceId})
+	}
+
+	for i := 0; i < 2; i++ {
+		out, err := describe()
+		require.NoError(t, err)
+		assert.Equal(t, prometheusservice.WorkspaceStatusCodeCreating, aws.StringValue(out.Workspace.Status.StatusCode))
+	}
+	out, err := describe()
+	require.NoError(t, err)
+	assert.Equal(t, prometheusservice.WorkspaceStatusCodeActive, aws.StringValue(out.Workspace.Status.StatusCode))
+	assert.Equal(t, created.Arn, out.Workspace.Arn)
+
+	_, err = svc.UpdateWorkspaceAlias(&prometheusservice.UpdateWorkspaceAliasInput{
+		WorkspaceId: created.WorkspaceId,
+		Alias:       aws.String("renamed"),
+	})
+	require.NoError(t, err)
+
+	_, err = svc.UpdateWorkspaceAlias(&prometheusservice.UpdateWorkspaceAliasInput{
+		WorkspaceId: created.WorkspaceId,
+		Alias:       aws.String("again"),
+	})
+	assert.Equal(t, prometheusservice.ErrCodeConflictException, errorCode(err))
+
+	_, err = svc.DeleteWorkspace(&prometheusservice.DeleteWorkspaceInput{WorkspaceId: created.WorkspaceId})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		out, err := describe()
+		require.NoError(t, err)
+		assert.Equal(t, prometheusservice.WorkspaceStatusCodeDeleting, aws.StringValue(out.Workspace.Status.StatusCode))
+	}
+	_, err = describe()
+	assert.Equal(t, prometheusservice.ErrCodeResourceNotFoundException, errorCode(err))
+	assert.Equal(t, 6, svc.Calls("DescribeWorkspace"))
+}
+
+func TestService_failedTransitions(t *testing.T) {
+	svc := NewService(0)
+	ws, err := svc.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	svc.FailTransitions = true
+	_, err = svc.CreateRuleGroupsNamespace(&prometheusservice.CreateRuleGroupsNamespaceInput{
+		WorkspaceId: ws.WorkspaceId,
+		Name:        aws.String("rules"),
+		Data:        []byte("groups: []"),
+	})
+	require.NoError(t, err)
+
+	out, err := svc.DescribeRuleGroupsNamespace(&prometheusservice.DescribeRuleGroupsNamespaceInput{
+		WorkspaceId: ws.WorkspaceId,
+		Name:        aws.String("rules"),
+	})
+	require.NoError(t, err)
+	status := out.RuleGroupsNamespace.Status
+	assert.Equal(t, prometheusservice.RuleGroupsNamespaceStatusCodeCreationFailed, aws.StringValue(status.StatusCode))
+	assert.Equal(t, defaultFailureReason, aws.StringValue(status.StatusReason))
+
+	_, err = svc.CreateAlertManagerDefinition(&prometheusservice.CreateAlertManagerDefinitionInput{
+		WorkspaceId: ws.WorkspaceId,
+		Data:        []byte("alertmanager_config: ''"),
+	})
+	require.NoError(t, err)
+	amd, err := svc.DescribeAlertManagerDefinition(&prometheusservice.DescribeAlertManagerDefinitionInput{
+		WorkspaceId: ws.WorkspaceId,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, prometheusservice.AlertManagerDefinitionStatusCodeCreationFailed, aws.StringValue(amd.AlertManagerDefinition.Status.StatusCode))
+
+	_, err = svc.CreateLoggingConfiguration(&prometheusservice.CreateLoggingConfigurationInput{
+		WorkspaceId: ws.WorkspaceId,
+		LogGroupArn: aws.String("arn:aws:logs:us-west-2:111111111111:log-group:/aps:*"),
+	})
+	require.NoError(t, err)
+	logging, err := svc.DescribeLoggingConfiguration(&prometheusservice.DescribeLoggingConfigurationInput{
+		WorkspaceId: ws.WorkspaceId,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, prometheusservice.LoggingConfigurationStatusCodeCreationFailed, aws.StringValue(logging.LoggingConfiguration.Status.StatusCode))
+}
+
+func TestService_resourcePolicyRevisions(t *testing.T) {
+	svc := NewService(0)
+
+	ws, err := svc.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	_, err = svc.PutResourcePolicy(&internal.PutResourcePolicyInput{
+		WorkspaceId:    ws.WorkspaceId,
+		PolicyDocument: aws.String("{}"),
+		RevisionId:     aws.String("1"),
+	})
+	assert.Equal(t, prometheusservice.ErrCodeConflictException, errorCode(err))
+
+	put, err := svc.PutResourcePolicy(&internal.PutResourcePolicyInput{
+		WorkspaceId:    ws.WorkspaceId,
+		PolicyDocument: aws.String("{}"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, internal.WorkspacePolicyStatusCodeCreating, aws.StringValue(put.PolicyStatus))
+
+	policy, err := svc.DescribeResourcePolicy(&internal.DescribeResourcePolicyInput{WorkspaceId: ws.WorkspaceId})
+	require.NoError(t, err)
+	assert.Equal(t, internal.WorkspacePolicyStatusCodeActive, aws.StringValue(policy.PolicyStatus))
+	assert.Equal(t, put.RevisionId, policy.RevisionId)
+
+	_, err = svc.DeleteResourcePolicy(&internal.DeleteResourcePolicyInput{
+		WorkspaceId: ws.WorkspaceId,
+		RevisionId:  aws.String("stale"),
+	})
+	assert.Equal(t, prometheusservice.ErrCodeConflictException, errorCode(err))
+
+	_, err = svc.DeleteResourcePolicy(&internal.DeleteResourcePolicyInput{
+		WorkspaceId: ws.WorkspaceId,
+		RevisionId:  policy.RevisionId,
+	})
+	require.NoError(t, err)
+	_, err = svc.DescribeResourcePolicy(&internal.DescribeResourcePolicyInput{WorkspaceId: ws.WorkspaceId})
+	assert.Equal(t, prometheusservice.ErrCodeResourceNotFoundException, errorCode(err))
+}
+
+func TestService_tagsAndPagination(t *testing.T) {
+	svc := NewService(0)
+	ws, err := svc.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := svc.CreateRuleGroupsNamespace(&prometheusservice.CreateRuleGroupsNamespaceInput{
+			WorkspaceId: ws.WorkspaceId,
+			Name:        aws.String(name),
+			Data:        []byte("groups: []"),
+		})
+		require.NoError(t, err)
+	}
+
+	var names []string
+	var nextToken *string
+	for {
+		page, err := svc.ListRuleGroupsNamespaces(&prometheusservice.ListRuleGroupsNamespacesInput{
+			WorkspaceId: ws.WorkspaceId,
+			MaxResults:  aws.Int64(2),
+			NextToken:   nextToken,
+		})
+		require.NoError(t, err)
+		for _, ns := range page.RuleGroupsNamespaces {
+			names = append(names, aws.StringValue(ns.Name))
+		}
+		if nextToken = page.NextToken; nextToken == nil {
+			break
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	_, err = svc.TagResource(&prometheusservice.TagResourceInput{
+		ResourceArn: ws.Arn,
+		Tags:        map[string]*string{"k": aws.String("v"), "x": aws.String("y")},
+	})
+	require.NoError(t, err)
+	_, err = svc.UntagResource(&prometheusservice.UntagResourceInput{
+		ResourceArn: ws.Arn,
+		TagKeys:     []*string{aws.String("x")},
+	})
+	require.NoError(t, err)
+
+	tags, err := svc.ListTagsForResource(&prometheusservice.ListTagsForResourceInput{ResourceArn: ws.Arn})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*string{"k": aws.String("v")}, tags.Tags)
+}
+
+func TestService_scraperTransitions(t *testing.T) {
+	svc := NewService(1)
+	ws, err := svc.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+
+	input := &prometheusservice.CreateScraperInput{
+		Source: &prometheusservice.Source{EksConfiguration: &prometheusservice.EksConfiguration{
+			ClusterArn: aws.String("arn:aws:eks:us-west-2:111111111111:cluster/demo"),
+			SubnetIds:  []*string{aws.String("subnet-1")},
+		}},
+		Destination: &prometheusservice.Destination{AmpConfiguration: &prometheusservice.AmpConfiguration{
+			WorkspaceArn: aws.String("arn:aws:aps:us-west-2:111111111111:workspace/ws-missing"),
+		}},
+		ScrapeConfiguration: &prometheusservice.ScrapeConfiguration{ConfigurationBlob: []byte("scrape_configs: []")},
+	}
+	_, err = svc.CreateScraper(input)
+	assert.Equal(t, prometheusservice.ErrCodeValidationException, errorCode(err))
+
+	input.Destination.AmpConfiguration.WorkspaceArn = ws.Arn
+	created, err := svc.CreateScraper(input)
+	require.NoError(t, err)
+	assert.Equal(t, prometheusservice.ScraperStatusCodeCreating, aws.StringValue(created.Status.StatusCode))
+
+	describe := func() (*prometheusservice.DescribeScraperOutput, error) {
+		return svc.DescribeScraper(&prometheusservice.DescribeScraperInput{ScraperId: created.ScraperId})
+	}
+	_, err = describe()
+	require.NoError(t, err)
+	out, err := describe()
+	require.NoError(t, err)
+	assert.Equal(t, prometheusservice.ScraperStatusCodeActive, aws.StringValue(out.Scraper.Status.StatusCode))
+
+	svc.FailTransitions = true
+	_, err = svc.UpdateScraper(&internal.UpdateScraperInput{ScraperId: created.ScraperId, Alias: aws.String("renamed")})
+	require.NoError(t, err)
+	_, err = svc.UpdateScraper(&internal.UpdateScraperInput{ScraperId: created.ScraperId, Alias: aws.String("again")})
+	assert.Equal(t, prometheusservice.ErrCodeConflictException, errorCode(err))
+	_, err = describe()
+	require.NoError(t, err)
+	out, err = describe()
+	require.NoError(t, err)
+	assert.Equal(t, internal.ScraperStatusCodeUpdateFailed, aws.StringValue(out.Scraper.Status.StatusCode))
+	assert.Equal(t, defaultFailureReason, aws.StringValue(out.Scraper.StatusReason))
+	assert.Equal(t, "renamed", aws.StringValue(out.Scraper.Alias))
+
+	list, err := svc.ListScrapers(&prometheusservice.ListScrapersInput{
+		Filters: map[string][]*string{"alias": {aws.String("renamed")}},
+	})
+	require.NoError(t, err)
+	assert.Len(t, list.Scrapers, 1)
+
+	_, err = svc.DeleteScraper(&prometheusservice.DeleteScraperInput{ScraperId: created.ScraperId})
+	require.NoError(t, err)
+	_, err = describe()
+	require.NoError(t, err)
+	_, err = describe()
+	assert.Equal(t, prometheusservice.ErrCodeResourceNotFoundException, errorCode(err))
+}
+
+func TestService_InjectError(t *testing.T) {
+	svc := NewService(0)
+	injected := &prometheusservice.ThrottlingException{Message_: aws.String("slow down")}
+	svc.InjectError("CreateWorkspace", injected)
+
+	_, err := svc.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	assert.Equal(t, injected, err)
+
+	_, err = svc.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, svc.Calls("CreateWorkspace"))
+}
+
+func TestRun(t *testing.T) {
+	type testModel struct {
+		Attempt int
+		Name    string
+	}
+	model := &testModel{Name: "test"}
+
+	var contexts []map[string]interface{}
+	var models []testModel
+	evt := Run(t, model, func(req handler.Request) (handler.ProgressEvent, error) {
+		assert.Equal(t, defaultRegion, req.RequestContext.Region)
+		contexts = append(contexts, req.CallbackContext)
+		models = append(models, *model)
+		if len(contexts) < 3 {
+			// callbacks get the model that was returned, not the one the
+			// handler started with
+			return handler.ProgressEvent{
+				OperationStatus: handler.InProgress,
+				CallbackContext: map[string]interface{}{"Attempt": len(contexts)},
+				ResourceModel:   &testModel{Attempt: len(contexts)},
+			}, nil
+		}
+		return handler.ProgressEvent{OperationStatus: handler.Success}, nil
+	})
+	assert.Equal(t, handler.Success, evt.OperationStatus)
+	assert.Equal(t, []map[string]interface{}{nil, {"Attempt": 1}, {"Attempt": 2}}, contexts)
+	assert.Equal(t, []testModel{{Name: "test"}, {Attempt: 1}, {Attempt: 2}}, models)
+}
+
+func TestUseClient(t *testing.T) {
+	var factory internal.ClientFactory = func(handler.Request, string) internal.APSService {
+		return nil
+	}
+	svc := NewService(0)
+	t.Run("fake", func(t *testing.T) {
+		UseClient(t, &factory, svc)
+		assert.Equal(t, svc, factory(handler.Request{}, internal.ActionCreate))
+	})
+	// the factory is restored once the test ends
+	assert.Nil(t, factory(handler.Request{}, internal.ActionCreate))
+}
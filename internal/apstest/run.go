@@ -0,0 +1,73 @@
+package apstest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws-cloudformation/aws-cloudformation-resource-providers-aps/internal"
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+)
+
+// maxCallbacks bounds the callbacks Run follows before it gives up on a
+// handler that never stabilizes.
+const maxCallbacks = 50
+
+// UseClient makes the client factory of a resource package, passed by the
+// address of its package variable, return client until the test ends.
+func UseClient(t testing.TB, factory *internal.ClientFactory, client internal.APSService) {
+	orig := *factory
+	*factory = func(handler.Request, string) internal.APSService {
+		return client
+	}
+	t.Cleanup(func() {
+		*factory = orig
+	})
+}
+
+// Run invokes handle and follows its callbacks until it leaves the
+// IN_PROGRESS state, like CloudFormation does. model points to the resource
+// model handle passes to the handler. CloudFormation calls back with the model
+// the handler returned rather than the one it started with, so before each
+// callback the returned model replaces the contents of model. The request
+// comes from the default region and account of the fake.
+func Run(t testing.TB, model interface{}, handle func(handler.Request) (handler.ProgressEvent, error)) handler.ProgressEvent {
+	t.Helper()
+	target := reflect.ValueOf(model)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		t.Fatalf("model must be a non-nil pointer, got %T", model)
+	}
+
+	req := handler.Request{
+		LogicalResourceID: "foo",
+		RequestContext: handler.RequestContext{
+			Region:    defaultRegion,
+			AccountID: defaultAccountID,
+		},
+	}
+	for i := 0; i < maxCallbacks; i++ {
+		evt, err := handle(req)
+		if err != nil {
+			t.Fatalf("handler failed: %v", err)
+		}
+		if evt.OperationStatus != handler.InProgress {
+			return evt
+		}
+		if reflect.TypeOf(evt.ResourceModel) != target.Type() {
+			t.Fatalf("handler called back with model %T, want %T", evt.ResourceModel, model)
+		}
+		// the model makes a round trip through JSON, so nothing the handler
+		// keeps elsewhere survives the callback
+		data, err := json.Marshal(evt.ResourceModel)
+		if err != nil {
+			t.Fatalf("handler returned a model that can't be encoded: %v", err)
+		}
+		target.Elem().Set(reflect.Zero(target.Elem().Type()))
+		if err := json.Unmarshal(data, model); err != nil {
+			t.Fatalf("handler returned a model that can't be decoded: %v", err)
+		}
+		req.CallbackContext = evt.CallbackContext
+	}
+	t.Fatal("handler did not stabilize")
+	return handler.ProgressEvent{}
+}
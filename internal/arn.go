@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+const (
+	apsService = "aps"
+	kmsService = "kms"
+
+	ResourceTypeWorkspace           = "workspace"
+	ResourceTypeRuleGroupsNamespace = "rulegroupsnamespace"
+	ResourceTypeScraper             = "scraper"
+)
+
+var (
+	ErrInvalidARN          = errors.New("invalid APS ARN")
+	ErrInvalidResourceType = errors.New("invalid resource type")
+
+	accountIDPattern     = regexp.MustCompile(`^[0-9]{12}$`)
+	workspaceIDPattern   = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+	namespaceNamePattern = regexp.MustCompile(`^[0-9A-Za-z][-.0-9A-Z_a-z]*$`)
+	scraperIDPattern     = regexp.MustCompile(`^[0-9A-Za-z][-.0-9A-Z_a-z]*$`)
+)
+
+// APSResourceARN is the parsed ARN of an APS resource. Workspace ARNs have the
+// form arn:<partition>:aps:<region>:<account>:workspace/<workspace id>, rule
+// groups namespace ARNs have the form
+// arn:<partition>:aps:<region>:<account>:rulegroupsnamespace/<workspace id>/<name>
+// and scraper ARNs have the form
+// arn:<partition>:aps:<region>:<account>:scraper/<scraper id>.
+type APSResourceARN struct {
+	Partition    string
+	Region       string
+	AccountID    string
+	ResourceType string
+	// WorkspaceID is not set for scrapers, which don't belong to a workspace.
+	WorkspaceID string
+	// NamespaceName is only set for rule groups namespaces.
+	NamespaceName string
+	// ScraperID is only set for scrapers.
+	ScraperID string
+}
+
+// NewWorkspaceARN returns the ARN of a workspace.
+func NewWorkspaceARN(partition, region, accountID, workspaceID string) *APSResourceARN {
+	return &APSResourceARN{
+		Partition:    partition,
+		Region:       region,
+		AccountID:    accountID,
+		ResourceType: ResourceTypeWorkspace,
+		WorkspaceID:  workspaceID,
+	}
+}
+
+// NewRuleGroupsNamespaceARN returns the ARN of a rule groups namespace.
+func NewRuleGroupsNamespaceARN(partition, region, accountID, workspaceID, name string) *APSResourceARN {
+	return &APSResourceARN{
+		Partition:     partition,
+		Region:        region,
+		AccountID:     accountID,
+		ResourceType:  ResourceTypeRuleGroupsNamespace,
+		WorkspaceID:   workspaceID,
+		NamespaceName: name,
+	}
+}
+
+// NewScraperARN returns the ARN of a scraper.
+func NewScraperARN(partition, region, accountID, scraperID string) *APSResourceARN {
+	return &APSResourceARN{
+		Partition:    partition,
+		Region:       region,
+		AccountID:    accountID,
+		ResourceType: ResourceTypeScraper,
+		ScraperID:    scraperID,
+	}
+}
+
+// ParseAPSResourceARN parses and validates the ARN of a workspace, a rule
+// groups namespace or a scraper.
+func ParseAPSResourceARN(value string) (*APSResourceARN, error) {
+	v, err := arn.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidARN, value, err)
+	}
+
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidARN, value, reason)
+	}
+
+	if v.Service != apsService {
+		return nil, invalid(fmt.Sprintf("service must be %q", apsService))
+	}
+	if v.Partition == "" {
+		return nil, invalid("missing partition")
+	}
+	if v.Region == "" {
+		return nil, invalid("missing region")
+	}
+	if !accountIDPattern.MatchString(v.AccountID) {
+		return nil, invalid("account ID must be 12 digits")
+	}
+
+	res := &APSResourceARN{
+		Partition: v.Partition,
+		Region:    v.Region,
+		AccountID: v.AccountID,
+	}
+
+	parts := strings.Split(v.Resource, "/")
+	res.ResourceType = parts[0]
+	switch res.ResourceType {
+	case ResourceTypeWorkspace:
+		if len(parts) != 2 {
+			return nil, invalid("expected workspace/<workspace id>")
+		}
+	case ResourceTypeRuleGroupsNamespace:
+		if len(parts) != 3 {
+			return nil, invalid("expected rulegroupsnamespace/<workspace id>/<name>")
+		}
+		if !namespaceNamePattern.MatchString(parts[2]) {
+			return nil, invalid("invalid rule groups namespace name")
+		}
+		res.NamespaceName = parts[2]
+	case ResourceTypeScraper:
+		if len(parts) != 2 {
+			return nil, invalid("expected scraper/<scraper id>")
+		}
+		if !scraperIDPattern.MatchString(parts[1]) {
+			return nil, invalid("invalid scraper ID")
+		}
+		res.ScraperID = parts[1]
+		return res, nil
+	default:
+		return nil, fmt.Errorf("%w %q in %q", ErrInvalidResourceType, res.ResourceType, value)
+	}
+
+	if !workspaceIDPattern.MatchString(parts[1]) {
+		return nil, invalid("invalid workspace ID")
+	}
+	res.WorkspaceID = parts[1]
+
+	return res, nil
+}
+
+// ParseWorkspaceARN parses an ARN that must identify a workspace.
+func ParseWorkspaceARN(value string) (*APSResourceARN, error) {
+	return parseARNOfType(value, ResourceTypeWorkspace)
+}
+
+// ParseRuleGroupsNamespaceARN parses an ARN that must identify a rule groups
+// namespace.
+func ParseRuleGroupsNamespaceARN(value string) (*APSResourceARN, error) {
+	return parseARNOfType(value, ResourceTypeRuleGroupsNamespace)
+}
+
+func parseARNOfType(value, resourceType string) (*APSResourceARN, error) {
+	res, err := ParseAPSResourceARN(value)
+	if err != nil {
+		return nil, err
+	}
+	if res.ResourceType != resourceType {
+		return nil, fmt.Errorf("%w %q in %q: expected %s", ErrInvalidResourceType, res.ResourceType, value, resourceType)
+	}
+	return res, nil
+}
+
+// ParseScraperARN parses an ARN that must identify a scraper.
+func ParseScraperARN(value string) (*APSResourceARN, error) {
+	return parseARNOfType(value, ResourceTypeScraper)
+}
+
+// WorkspaceARN returns the ARN of the workspace a resource belongs to.
+func (a *APSResourceARN) WorkspaceARN() *APSResourceARN {
+	return NewWorkspaceARN(a.Partition, a.Region, a.AccountID, a.WorkspaceID)
+}
+
+func (a *APSResourceARN) String() string {
+	resource := a.ResourceType + "/" + a.WorkspaceID
+	switch a.ResourceType {
+	case ResourceTypeRuleGroupsNamespace:
+		resource += "/" + a.NamespaceName
+	case ResourceTypeScraper:
+		resource = a.ResourceType + "/" + a.ScraperID
+	}
+
+	return arn.ARN{
+		Partition: a.Partition,
+		Service:   apsService,
+		Region:    a.Region,
+		AccountID: a.AccountID,
+		Resource:  resource,
+	}.String()
+}
+
+// PartitionForRegion returns the partition region belongs to. Unknown regions
+// are assumed to be in the aws partition.
+func PartitionForRegion(region string) string {
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return p.ID()
+	}
+	return endpoints.AwsPartitionID
+}
+
+// ValidateKMSKeyARN checks that keyARN identifies a KMS key that can encrypt
+// a workspace in partition and region. APS only accepts keys from the
+// workspace's own region. The key may belong to another account.
+func ValidateKMSKeyARN(keyARN, partition, region string) error {
+	v, err := arn.Parse(keyARN)
+	if err != nil {
+		return fmt.Errorf("%q is not a KMS key ARN: %v", keyARN, err)
+	}
+	if v.Service != kmsService || !strings.HasPrefix(v.Resource, "key/") || len(v.Resource) == len("key/") {
+		return fmt.Errorf("%q is not a KMS key ARN: expected arn:<partition>:kms:<region>:<account>:key/<key id>", keyARN)
+	}
+	if !accountIDPattern.MatchString(v.AccountID) {
+		return fmt.Errorf("%q is not a KMS key ARN: account ID must be 12 digits", keyARN)
+	}
+	if v.Partition != partition {
+		return fmt.Errorf("KMS key %q is in partition %q, but the workspace is in partition %q", keyARN, v.Partition, partition)
+	}
+	if v.Region != region {
+		return fmt.Errorf("KMS key %q is in region %q, but the workspace is in region %q", keyARN, v.Region, region)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAPSResourceARN(t *testing.T) {
+	testCases := []struct {
+		arn      string
+		expected APSResourceARN
+	}{
+		{
+			"arn:aws:aps:us-west-2:933102010132:workspace/ws-5f41d54a-41fc-4783-984f-7facb35c928c",
+			APSResourceARN{
+				Partition:    "aws",
+				Region:       "us-west-2",
+				AccountID:    "933102010132",
+				ResourceType: ResourceTypeWorkspace,
+				WorkspaceID:  "ws-5f41d54a-41fc-4783-984f-7facb35c928c",
+			},
+		},
+		{
+			"arn:aws-cn:aps:cn-north-1:320989744364:rulegroupsnamespace/ws-5291a005-10a2-4b24-aabc-5ce35174430a/Test2",
+			APSResourceARN{
+				Partition:     "aws-cn",
+				Region:        "cn-north-1",
+				AccountID:     "320989744364",
+				ResourceType:  ResourceTypeRuleGroupsNamespace,
+				WorkspaceID:   "ws-5291a005-10a2-4b24-aabc-5ce35174430a",
+				NamespaceName: "Test2",
+			},
+		},
+		{
+			"arn:aws:aps:us-west-2:111111111111:scraper/s-0123abcd-56ef-7890-abcd-12345678ef90",
+			APSResourceARN{
+				Partition:    "aws",
+				Region:       "us-west-2",
+				AccountID:    "111111111111",
+				ResourceType: ResourceTypeScraper,
+				ScraperID:    "s-0123abcd-56ef-7890-abcd-12345678ef90",
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.arn, func(t *testing.T) {
+			actual, err := ParseAPSResourceARN(testCase.arn)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, *actual)
+			assert.Equal(t, testCase.arn, actual.String())
+		})
+	}
+}
+
+func TestParseAPSResourceARN_invalid(t *testing.T) {
+	testCases := map[string]struct {
+		arn         string
+		expectedErr error
+	}{
+		"not an ARN":                  {"workspace/ws-1", ErrInvalidARN},
+		"missing workspace ID":        {"arn:aws:aps:us-east-1:111111111111:workspace", ErrInvalidARN},
+		"empty workspace ID":          {"arn:aws:aps:us-east-1:111111111111:workspace/", ErrInvalidARN},
+		"extra workspace parts":       {"arn:aws:aps:us-east-1:111111111111:workspace/ws-1/extra", ErrInvalidARN},
+		"missing namespace name":      {"arn:aws:aps:us-east-1:111111111111:rulegroupsnamespace/ws-1", ErrInvalidARN},
+		"invalid namespace name":      {"arn:aws:aps:us-east-1:111111111111:rulegroupsnamespace/ws-1/-rules", ErrInvalidARN},
+		"wrong service":               {"arn:aws:amp:us-east-1:111111111111:workspace/ws-1", ErrInvalidARN},
+		"missing region":              {"arn:aws:aps::111111111111:workspace/ws-1", ErrInvalidARN},
+		"short account ID":            {"arn:aws:aps:us-east-1:1:workspace/ws-1", ErrInvalidARN},
+		"missing scraper ID":          {"arn:aws:aps:us-east-1:111111111111:scraper", ErrInvalidARN},
+		"invalid scraper ID":          {"arn:aws:aps:us-east-1:111111111111:scraper/s 1", ErrInvalidARN},
+		"unsupported resource type":   {"arn:aws:aps:us-east-1:111111111111:collector/s-1", ErrInvalidResourceType},
+		"invalid workspace ID":        {"arn:aws:aps:us-east-1:111111111111:workspace/ws_1", ErrInvalidARN},
+		"resource without a resource": {"arn:aws:aps:us-east-1:111111111111:", ErrInvalidResourceType},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actual, err := ParseAPSResourceARN(tc.arn)
+			assert.Nil(t, actual)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestParseARNOfType(t *testing.T) {
+	workspace := "arn:aws:aps:us-west-2:111111111111:workspace/ws-1"
+	namespace := "arn:aws:aps:us-west-2:111111111111:rulegroupsnamespace/ws-1/rules"
+
+	_, err := ParseWorkspaceARN(workspace)
+	assert.NoError(t, err)
+	_, err = ParseWorkspaceARN(namespace)
+	assert.True(t, errors.Is(err, ErrInvalidResourceType))
+
+	parsed, err := ParseRuleGroupsNamespaceARN(namespace)
+	require.NoError(t, err)
+	assert.Equal(t, workspace, parsed.WorkspaceARN().String())
+	_, err = ParseRuleGroupsNamespaceARN(workspace)
+	assert.True(t, errors.Is(err, ErrInvalidResourceType))
+
+	_, err = ParseScraperARN("arn:aws:aps:us-west-2:111111111111:scraper/s-1")
+	assert.NoError(t, err)
+	_, err = ParseScraperARN(workspace)
+	assert.True(t, errors.Is(err, ErrInvalidResourceType))
+}
+
+func TestNewARN(t *testing.T) {
+	assert.Equal(t,
+		"arn:aws-us-gov:aps:us-gov-west-1:111111111111:workspace/ws-1",
+		NewWorkspaceARN("aws-us-gov", "us-gov-west-1", "111111111111", "ws-1").String())
+	assert.Equal(t,
+		"arn:aws:aps:us-west-2:111111111111:rulegroupsnamespace/ws-1/rules",
+		NewRuleGroupsNamespaceARN("aws", "us-west-2", "111111111111", "ws-1", "rules").String())
+	assert.Equal(t,
+		"arn:aws:aps:us-west-2:111111111111:scraper/s-1",
+		NewScraperARN("aws", "us-west-2", "111111111111", "s-1").String())
+}
+
+func TestPartitionForRegion(t *testing.T) {
+	assert.Equal(t, "aws", PartitionForRegion("us-west-2"))
+	assert.Equal(t, "aws-cn", PartitionForRegion("cn-north-1"))
+	assert.Equal(t, "aws-us-gov", PartitionForRegion("us-gov-west-1"))
+	assert.Equal(t, "aws", PartitionForRegion("mars-east-1"))
+}
+
+func TestValidateKMSKeyARN(t *testing.T) {
+	key := "arn:aws:kms:us-west-2:222222222222:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	assert.NoError(t, ValidateKMSKeyARN(key, "aws", "us-west-2"))
+	assert.NoError(t, ValidateKMSKeyARN(
+		"arn:aws-cn:kms:cn-north-1:222222222222:key/1234abcd-12ab-34cd-56ef-1234567890ab", "aws-cn", "cn-north-1"))
+
+	testCases := []struct {
+		key, partition, region, message string
+	}{
+		{"1234abcd-12ab-34cd-56ef-1234567890ab", "aws", "us-west-2", "is not a KMS key ARN: arn: invalid prefix"},
+		{"arn:aws:kms:us-west-2:222222222222:alias/my-key", "aws", "us-west-2", "expected arn:<partition>:kms:<region>:<account>:key/<key id>"},
+		{"arn:aws:sns:us-west-2:222222222222:key/1", "aws", "us-west-2", "expected arn:<partition>:kms:<region>:<account>:key/<key id>"},
+		{"arn:aws:kms:us-west-2:222222222222:key/", "aws", "us-west-2", "expected arn:<partition>:kms:<region>:<account>:key/<key id>"},
+		{"arn:aws:kms:us-west-2:2222:key/1", "aws", "us-west-2", "account ID must be 12 digits"},
+		{key, "aws-us-gov", "us-gov-west-1", `is in partition "aws", but the workspace is in partition "aws-us-gov"`},
+		{key, "aws", "us-east-1", `is in region "us-west-2", but the workspace is in region "us-east-1"`},
+	}
+	for _, tc := range testCases {
+		err := ValidateKMSKeyARN(tc.key, tc.partition, tc.region)
+		if assert.Error(t, err, tc.key) {
+			assert.Contains(t, err.Error(), tc.message)
+		}
+	}
+}
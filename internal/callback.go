@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CallbackContextVersion is the schema version of encoded callback contexts.
+// Bump it whenever CallbackContext changes in a way older handlers can't read.
+const CallbackContextVersion = 1
+
+const callbackContextVersionKey = "Version"
+
+// Phase identifies what a handler is waiting for between callbacks. Each
+// resource package defines its own phases.
+type Phase string
+
+// CallbackContext is the stabilization state a handler carries between
+// callbacks.
+type CallbackContext struct {
+	Version int `json:"Version"`
+	// Phase is what the handler is waiting for.
+	Phase Phase `json:"Phase"`
+	// Arn is the ARN of the resource being stabilized.
+	Arn string `json:"TargetArn"`
+	// Attempt counts the callbacks spent in Phase so far.
+	Attempt int `json:"Attempt"`
+	// StartedAt is when Phase was entered.
+	StartedAt time.Time `json:"StartedAt"`
+}
+
+// CallbackContextError is returned when a callback context can't be decoded.
+type CallbackContextError struct {
+	reason string
+}
+
+func (e *CallbackContextError) Error() string {
+	return "invalid callback context: " + e.reason
+}
+
+// Next returns the encoded callback context for the next callback in phase.
+// The attempt count and start time carry over while the phase stays the same
+// and reset when it changes. c may be nil when no phase was in progress.
+func (c *CallbackContext) Next(phase Phase, arn string) map[string]interface{} {
+	next := CallbackContext{
+		Version:   CallbackContextVersion,
+		Phase:     phase,
+		Arn:       arn,
+		Attempt:   1,
+		StartedAt: time.Now().UTC(),
+	}
+	if c != nil && c.Phase == phase {
+		next.Attempt = c.Attempt + 1
+		next.StartedAt = c.StartedAt
+	}
+	return next.encode()
+}
+
+// NewCallbackContext returns the encoded callback context for the first
+// callback in phase.
+func NewCallbackContext(phase Phase, arn string) map[string]interface{} {
+	var c *CallbackContext
+	return c.Next(phase, arn)
+}
+
+func (c CallbackContext) encode() map[string]interface{} {
+	return map[string]interface{}{
+		callbackContextVersionKey: c.Version,
+		"Phase":                   string(c.Phase),
+		"TargetArn":               c.Arn,
+		"Attempt":                 c.Attempt,
+		"StartedAt":               c.StartedAt.Format(time.RFC3339Nano),
+	}
+}
+
+// DecodeCallbackContext reads the callback context of a request. It returns
+// nil when there is no callback context, i.e. on the first invocation.
+//
+// Contexts written before the context was versioned only held the resource
+// ARN under a phase specific key. legacyPhases maps those keys to the phase
+// they stand for so operations in flight during a release can complete.
+func DecodeCallbackContext(raw map[string]interface{}, legacyPhases map[string]Phase) (*CallbackContext, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	// a retried first invocation only carries its retry count
+	if _, ok := raw[retryKey]; ok && len(raw) == 1 {
+		return nil, nil
+	}
+
+	if _, ok := raw[callbackContextVersionKey]; !ok {
+		return decodeLegacyCallbackContext(raw, legacyPhases)
+	}
+
+	// the context is round-tripped through JSON by CloudFormation, so numbers
+	// may arrive as float64. Re-encoding lets encoding/json sort that out.
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, &CallbackContextError{reason: err.Error()}
+	}
+	var c CallbackContext
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, &CallbackContextError{reason: err.Error()}
+	}
+
+	if c.Version < 1 || c.Version > CallbackContextVersion {
+		return nil, &CallbackContextError{reason: fmt.Sprintf("unsupported version %d", c.Version)}
+	}
+	if c.Phase == "" {
+		return nil, &CallbackContextError{reason: "missing phase"}
+	}
+	if c.Arn == "" {
+		return nil, &CallbackContextError{reason: "missing target ARN"}
+	}
+
+	return &c, nil
+}
+
+func decodeLegacyCallbackContext(raw map[string]interface{}, legacyPhases map[string]Phase) (*CallbackContext, error) {
+	for key, phase := range legacyPhases {
+		value, ok := raw[key]
+		if !ok {
+			continue
+		}
+		arn, ok := value.(string)
+		if !ok || arn == "" {
+			return nil, &CallbackContextError{reason: fmt.Sprintf("%q must be a non-empty string", key)}
+		}
+		// the legacy context doesn't know when the phase started, so it
+		// starts over with this callback
+		return &CallbackContext{
+			Version:   CallbackContextVersion,
+			Phase:     phase,
+			Arn:       arn,
+			StartedAt: time.Now().UTC(),
+		}, nil
+	}
+
+	return nil, &CallbackContextError{reason: "unrecognized format"}
+}
+
+// InPhase reports whether c is waiting in phase. c may be nil.
+func (c *CallbackContext) InPhase(phase Phase) bool {
+	return c != nil && c.Phase == phase
+}
+
+// UnexpectedPhaseError is returned by handlers that receive a callback in a
+// phase they don't handle.
+func (c *CallbackContext) UnexpectedPhaseError() error {
+	return &CallbackContextError{reason: fmt.Sprintf("unexpected phase %q", c.Phase)}
+}
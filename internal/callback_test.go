@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testArn                = "arn:aws:aps:us-west-2:111111111111:workspace/ws-11111111-1111-1111-1111-111111111111"
+	testPhase        Phase = "WaitForTest"
+	testPhaseAnother Phase = "WaitForAnotherTest"
+)
+
+var testLegacyPhases = map[string]Phase{
+	"Arn":          testPhase,
+	"waitForOther": testPhaseAnother,
+}
+
+// roundTrip passes an encoded context through JSON like CloudFormation does.
+func roundTrip(t *testing.T, raw map[string]interface{}) map[string]interface{} {
+	data, err := json.Marshal(raw)
+	require.NoError(t, err)
+	var res map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &res))
+	return res
+}
+
+func TestDecodeCallbackContext_empty(t *testing.T) {
+	c, err := DecodeCallbackContext(nil, testLegacyPhases)
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+	assert.False(t, c.InPhase(testPhase))
+}
+
+func TestCallbackContext_Next(t *testing.T) {
+	first, err := DecodeCallbackContext(roundTrip(t, NewCallbackContext(testPhase, testArn)), testLegacyPhases)
+	require.NoError(t, err)
+	assert.Equal(t, CallbackContextVersion, first.Version)
+	assert.True(t, first.InPhase(testPhase))
+	assert.Equal(t, testArn, first.Arn)
+	assert.Equal(t, 1, first.Attempt)
+
+	second, err := DecodeCallbackContext(roundTrip(t, first.Next(testPhase, testArn)), testLegacyPhases)
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Attempt)
+	assert.True(t, first.StartedAt.Equal(second.StartedAt))
+
+	other, err := DecodeCallbackContext(roundTrip(t, second.Next(testPhaseAnother, testArn)), testLegacyPhases)
+	require.NoError(t, err)
+	assert.True(t, other.InPhase(testPhaseAnother))
+	assert.Equal(t, 1, other.Attempt)
+	assert.False(t, other.StartedAt.Before(second.StartedAt))
+}
+
+func TestDecodeCallbackContext_legacy(t *testing.T) {
+	testCases := map[string]struct {
+		raw   map[string]interface{}
+		phase Phase
+	}{
+		"Arn":          {map[string]interface{}{"Arn": testArn}, testPhase},
+		"waitForOther": {map[string]interface{}{"waitForOther": testArn}, testPhaseAnother},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c, err := DecodeCallbackContext(tc.raw, testLegacyPhases)
+			require.NoError(t, err)
+			assert.True(t, c.InPhase(tc.phase))
+			assert.Equal(t, testArn, c.Arn)
+			assert.Equal(t, 0, c.Attempt)
+			assert.False(t, c.StartedAt.IsZero())
+		})
+	}
+}
+
+func TestDecodeCallbackContext_invalid(t *testing.T) {
+	testCases := map[string]map[string]interface{}{
+		"legacy ARN is not a string": {"Arn": 42},
+		"legacy ARN is empty":        {"Arn": ""},
+		"unknown keys":               {"foo": "bar"},
+		"future version":             {"Version": CallbackContextVersion + 1, "Phase": "WaitForTest", "TargetArn": testArn},
+		"missing phase":              {"Version": CallbackContextVersion, "TargetArn": testArn},
+		"missing ARN":                {"Version": CallbackContextVersion, "Phase": "WaitForTest"},
+		"wrong attempt type":         {"Version": CallbackContextVersion, "Phase": "WaitForTest", "TargetArn": testArn, "Attempt": "one"},
+		"wrong start time":           {"Version": CallbackContextVersion, "Phase": "WaitForTest", "TargetArn": testArn, "StartedAt": "yesterday"},
+	}
+
+	for name, raw := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c, err := DecodeCallbackContext(raw, testLegacyPhases)
+			assert.Nil(t, c)
+			var ctxErr *CallbackContextError
+			require.ErrorAs(t, err, &ctxErr)
+
+			evt, cause := NewFailedEvent(err)
+			assert.Equal(t, err, cause)
+			assert.Equal(t, handler.Failed, evt.OperationStatus)
+			assert.Contains(t, evt.Message, "invalid callback context")
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// durationRE matches Prometheus durations such as 1h30m or 500ms. Units must
+// appear in decreasing order and at most once each.
+var durationRE = regexp.MustCompile(`^(([0-9]+)y)?(([0-9]+)w)?(([0-9]+)d)?(([0-9]+)h)?(([0-9]+)m)?(([0-9]+)s)?(([0-9]+)ms)?$`)
+
+var durationUnits = []time.Duration{
+	365 * 24 * time.Hour, // y
+	7 * 24 * time.Hour,   // w
+	24 * time.Hour,       // d
+	time.Hour,            // h
+	time.Minute,          // m
+	time.Second,          // s
+	time.Millisecond,     // ms
+}
+
+// parseDuration parses a duration in the format used by Prometheus and
+// Alertmanager configuration files. Unlike time.ParseDuration it accepts the
+// d, w and y units and rejects fractions.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	matches := durationRE.FindStringSubmatch(s)
+	if s == "" || matches == nil {
+		return 0, fmt.Errorf("not a valid duration string: %q", s)
+	}
+
+	var d time.Duration
+	for i, unit := range durationUnits {
+		value := matches[2*i+2]
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || time.Duration(n) > (1<<63-1)/unit || d+time.Duration(n)*unit < d {
+			return 0, fmt.Errorf("duration out of range: %q", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
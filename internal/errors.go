@@ -0,0 +1,274 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+)
+
+// serviceErrorsToHandleErrors maps the error codes APS and the SDK return to
+// the handler error codes CloudFormation reports.
+var serviceErrorsToHandleErrors = map[string]string{
+	"BadRequestException":                                  cloudformation.HandlerErrorCodeInvalidRequest,
+	request.InvalidParameterErrCode:                        cloudformation.HandlerErrorCodeInvalidRequest,
+	"InvalidRequest":                                       cloudformation.HandlerErrorCodeInvalidRequest,
+	"TooManyRequestsException":                             cloudformation.HandlerErrorCodeThrottling,
+	prometheusservice.ErrCodeThrottlingException:           cloudformation.HandlerErrorCodeThrottling,
+	"NotFoundException":                                    cloudformation.HandlerErrorCodeNotFound,
+	prometheusservice.ErrCodeResourceNotFoundException:     cloudformation.HandlerErrorCodeNotFound,
+	prometheusservice.ErrCodeAccessDeniedException:         cloudformation.HandlerErrorCodeAccessDenied,
+	prometheusservice.ErrCodeValidationException:           cloudformation.HandlerErrorCodeInvalidRequest,
+	prometheusservice.ErrCodeConflictException:             cloudformation.HandlerErrorCodeResourceConflict,
+	prometheusservice.ErrCodeServiceQuotaExceededException: cloudformation.HandlerErrorCodeServiceLimitExceeded,
+	prometheusservice.ErrCodeInternalServerException:       cloudformation.HandlerErrorCodeServiceInternalError,
+	"ServiceUnavailableException":                          cloudformation.HandlerErrorCodeServiceInternalError,
+	// the SDK's codes for requests that never got a response
+	request.ErrCodeRequestError:    cloudformation.HandlerErrorCodeNetworkFailure,
+	request.ErrCodeResponseTimeout: cloudformation.HandlerErrorCodeNetworkFailure,
+	request.CanceledErrorCode:      cloudformation.HandlerErrorCodeNetworkFailure,
+}
+
+// HandlerError is an error classified for CloudFormation: the handler error
+// code to report and the message to show. ClassifyError builds one for any
+// error a handler fails with.
+type HandlerError struct {
+	// Code is the handler error code, e.g. InvalidRequest.
+	Code    string
+	Message string
+	// RequestID is the ID of the failed APS request, if there was one.
+	RequestID string
+	// Retryable is set for errors that are likely to go away when the
+	// request is retried, such as throttling.
+	Retryable bool
+	Err       error
+}
+
+func (e *HandlerError) Error() string {
+	if e.RequestID == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (RequestId: %s)", e.Message, e.RequestID)
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyError returns the HandlerError for err. Errors it doesn't recognize
+// are reported as a GeneralServiceException with a generic message, so
+// internal details don't leak to customers.
+func ClassifyError(err error) *HandlerError {
+	var handlerErr *HandlerError
+	if errors.As(err, &handlerErr) {
+		return handlerErr
+	}
+
+	var ctxErr *CallbackContextError
+	if errors.As(err, &ctxErr) {
+		return &HandlerError{Code: cloudformation.HandlerErrorCodeInternalFailure, Message: ctxErr.Error(), Err: err}
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return &HandlerError{Code: cloudformation.HandlerErrorCodeInvalidRequest, Message: validationErr.Error(), Err: err}
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		var paths PropertyPaths
+		var pathsErr *propertyPathsError
+		if errors.As(err, &pathsErr) {
+			paths = pathsErr.paths
+		}
+		classified := classifyServiceError(awsErr, paths)
+		var conflictErr *conflictError
+		if awsErr.Code() == prometheusservice.ErrCodeConflictException && errors.As(err, &conflictErr) {
+			classified.Code = conflictErr.code
+			classified.Retryable = conflictErr.retryable
+		}
+		return classified
+	}
+
+	if isNetworkError(err) {
+		return &HandlerError{Code: cloudformation.HandlerErrorCodeNetworkFailure, Message: "NetworkFailure: " + err.Error(), Err: err}
+	}
+	return &HandlerError{Code: cloudformation.HandlerErrorCodeGeneralServiceException, Message: "Internal Failure", Err: err}
+}
+
+func classifyServiceError(awsErr awserr.Error, paths PropertyPaths) *HandlerError {
+	classified := &HandlerError{Err: awsErr}
+	var statusCode int
+	if failure, ok := awsErr.(awserr.RequestFailure); ok {
+		classified.RequestID = failure.RequestID()
+		statusCode = failure.StatusCode()
+	}
+
+	_, classified.Retryable = retryableErrors[awsErr.Code()]
+	code, ok := serviceErrorsToHandleErrors[awsErr.Code()]
+	switch {
+	case ok:
+		classified.Code = code
+	case statusCode >= 500:
+		classified.Code = cloudformation.HandlerErrorCodeServiceInternalError
+	case isNetworkError(awsErr.OrigErr()):
+		classified.Code = cloudformation.HandlerErrorCodeNetworkFailure
+	default:
+		classified.Code = cloudformation.HandlerErrorCodeGeneralServiceException
+		classified.Message = "Internal Failure"
+		return classified
+	}
+
+	message := awsErr.Message()
+	switch awsErr.Code() {
+	case request.InvalidParameterErrCode:
+		message = awsErr.Error()
+		message = strings.TrimPrefix(message, "InvalidParameter: ")
+		// remove \n so validation errors are seen in Console / API
+		message = strings.Replace(message, "\n", "", -1)
+		// remove list notation
+		message = strings.Replace(message, ".- ", ". ", -1)
+	case "TooManyRequestsException":
+		// TooManyRequestsException doesn't have a message by default
+		// so the customer sees "Internal Failure" when message isn't set.
+		message = "API rate limit exceeded"
+	}
+	if cause := awsErr.OrigErr(); cause != nil && classified.Code == cloudformation.HandlerErrorCodeNetworkFailure {
+		message = fmt.Sprintf("%s: %v", message, cause)
+	}
+	if validationErr, ok := awsErr.(*prometheusservice.ValidationException); ok && len(validationErr.FieldList) > 0 {
+		message = invalidPropertiesMessage(message, validationErr.FieldList, paths)
+	}
+
+	classified.Message = awsErr.Code() + ": " + message
+	return classified
+}
+
+// isNetworkError reports whether err is a connection failure or timeout.
+func isNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// PropertyPaths maps the field names APS reports in a ValidationException to
+// the CloudFormation property paths they came from, e.g. "workspaceId" to
+// "/properties/Workspace". Fields that aren't listed are assumed to be named
+// after their property.
+type PropertyPaths map[string]string
+
+// WithPropertyPaths annotates the error of an APS request with the property
+// paths of its fields, so that a ValidationException names the properties the
+// template author has to fix.
+func WithPropertyPaths(err error, paths PropertyPaths) error {
+	if err == nil {
+		return nil
+	}
+	return &propertyPathsError{err: err, paths: paths}
+}
+
+type propertyPathsError struct {
+	err   error
+	paths PropertyPaths
+}
+
+func (e *propertyPathsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *propertyPathsError) Unwrap() error {
+	return e.err
+}
+
+// WithCreateConflict annotates the error of a request that creates a resource.
+// A ConflictException then means the resource already exists, which is
+// reported as AlreadyExists and not retried.
+func WithCreateConflict(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &conflictError{err: err, code: cloudformation.HandlerErrorCodeAlreadyExists}
+}
+
+// WithBusyConflict annotates the error of a request that updates or deletes a
+// resource. A ConflictException then means the resource is busy with another
+// change, so the request is retried. Conflicts of other requests, such as a
+// stale RevisionId, fail the handler with ResourceConflict.
+func WithBusyConflict(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &conflictError{err: err, code: cloudformation.HandlerErrorCodeResourceConflict, retryable: true}
+}
+
+type conflictError struct {
+	err       error
+	code      string
+	retryable bool
+}
+
+func (e *conflictError) Error() string {
+	return e.err.Error()
+}
+
+func (e *conflictError) Unwrap() error {
+	return e.err
+}
+
+// Path returns the property path of a field APS reported. Nested fields such
+// as "scrapeConfiguration.configurationBlob" or "limitsPerLabelSet[0].limits"
+// map segment by segment, starting from the longest prefix in p.
+func (p PropertyPaths) Path(field string) string {
+	segments := strings.FieldsFunc(field, func(r rune) bool {
+		return r == '.' || r == '[' || r == ']'
+	})
+	for i := len(segments); i > 0; i-- {
+		prefix, ok := p[strings.Join(segments[:i], ".")]
+		if !ok {
+			continue
+		}
+		return strings.Join(append([]string{prefix}, propertyNames(segments[i:])...), "/")
+	}
+	return strings.Join(append([]string{"/properties"}, propertyNames(segments)...), "/")
+}
+
+// propertyNames converts the lowerCamelCase names APS uses to the
+// UpperCamelCase names of CloudFormation properties.
+func propertyNames(segments []string) []string {
+	names := make([]string, len(segments))
+	for i, segment := range segments {
+		names[i] = strings.ToUpper(segment[:1]) + segment[1:]
+	}
+	return names
+}
+
+// invalidPropertiesMessage appends the properties of the fields that failed
+// validation to message.
+func invalidPropertiesMessage(message string, fields []*prometheusservice.ValidationExceptionField, paths PropertyPaths) string {
+	invalid := make([]string, 0, len(fields))
+	for _, field := range fields {
+		property := paths.Path(aws.StringValue(field.Name))
+		if reason := aws.StringValue(field.Message); reason != "" {
+			property = fmt.Sprintf("%s (%s)", property, reason)
+		}
+		invalid = append(invalid, property)
+	}
+
+	message = strings.TrimSuffix(message, ".")
+	if message != "" {
+		message += ". "
+	}
+	return message + "Invalid properties: " + strings.Join(invalid, ", ")
+}
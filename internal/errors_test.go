@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFailedEvent(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	invalidParams := request.ErrInvalidParams{Context: "CreateWorkspaceInput"}
+	invalidParams.Add(request.NewErrParamMinLen("Alias", 1))
+
+	testCases := []struct {
+		name    string
+		err     error
+		code    string
+		message string
+	}{
+		{
+			"validation error",
+			NewValidationError("Data", errors.New("must be set")),
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			"invalid Data: must be set",
+		},
+		{
+			"wrapped validation error",
+			fmt.Errorf("creating: %w", NewValidationError("Data", errors.New("must be set"))),
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			"invalid Data: must be set",
+		},
+		{
+			"callback context error",
+			&CallbackContextError{reason: "unsupported version 3"},
+			cloudformation.HandlerErrorCodeInternalFailure,
+			"invalid callback context: unsupported version 3",
+		},
+		{
+			"service error with request ID",
+			awserr.NewRequestFailure(awserr.New(prometheusservice.ErrCodeConflictException, "busy", nil), 409, "req-1"),
+			cloudformation.HandlerErrorCodeResourceConflict,
+			"ConflictException: busy (RequestId: req-1)",
+		},
+		{
+			"typed service error",
+			&prometheusservice.InternalServerException{
+				Message_:     aws.String("oops"),
+				RespMetadata: protocol.ResponseMetadata{StatusCode: 500, RequestID: "req-2"},
+			},
+			cloudformation.HandlerErrorCodeServiceInternalError,
+			"InternalServerException: oops (RequestId: req-2)",
+		},
+		{
+			"unmapped 5xx",
+			awserr.NewRequestFailure(awserr.New("BadGateway", "upstream failed", nil), 502, "req-3"),
+			cloudformation.HandlerErrorCodeServiceInternalError,
+			"BadGateway: upstream failed (RequestId: req-3)",
+		},
+		{
+			"unmapped 4xx",
+			awserr.NewRequestFailure(awserr.New("SomethingNew", "details", nil), 400, "req-4"),
+			cloudformation.HandlerErrorCodeGeneralServiceException,
+			"Internal Failure (RequestId: req-4)",
+		},
+		{
+			"throttled",
+			awserr.NewRequestFailure(awserr.New("TooManyRequestsException", "", nil), 429, "req-5"),
+			cloudformation.HandlerErrorCodeThrottling,
+			"TooManyRequestsException: API rate limit exceeded (RequestId: req-5)",
+		},
+		{
+			"validation field list",
+			WithPropertyPaths(&prometheusservice.ValidationException{
+				Message_: aws.String("Invalid request."),
+				FieldList: []*prometheusservice.ValidationExceptionField{
+					{Name: aws.String("data"), Message: aws.String("rule groups are not valid YAML")},
+					{Name: aws.String("workspaceId"), Message: aws.String("workspace is not active")},
+				},
+				RespMetadata: protocol.ResponseMetadata{StatusCode: 400, RequestID: "req-6"},
+			}, PropertyPaths{"workspaceId": "/properties/Workspace"}),
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			"ValidationException: Invalid request. Invalid properties: /properties/Data (rule groups are not valid YAML), /properties/Workspace (workspace is not active) (RequestId: req-6)",
+		},
+		{
+			"validation field list without paths",
+			&prometheusservice.ValidationException{
+				FieldList: []*prometheusservice.ValidationExceptionField{
+					{Name: aws.String("scrapeConfiguration.configurationBlob"), Message: aws.String("invalid")},
+				},
+			},
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			"ValidationException: Invalid properties: /properties/ScrapeConfiguration/ConfigurationBlob (invalid)",
+		},
+		{
+			"invalid parameters",
+			invalidParams,
+			cloudformation.HandlerErrorCodeInvalidRequest,
+			"InvalidParameter: 1 validation error(s) found. minimum field size of 1, CreateWorkspaceInput.Alias.",
+		},
+		{
+			"connection failure",
+			awserr.New(request.ErrCodeRequestError, "send request failed", dialErr),
+			cloudformation.HandlerErrorCodeNetworkFailure,
+			"RequestError: send request failed: dial tcp: connection refused",
+		},
+		{
+			"response timeout",
+			awserr.New(request.ErrCodeResponseTimeout, "read on body has reached the timeout limit", nil),
+			cloudformation.HandlerErrorCodeNetworkFailure,
+			"ResponseTimeout: read on body has reached the timeout limit",
+		},
+		{
+			"request canceled",
+			awserr.New(request.CanceledErrorCode, "request context canceled", context.Canceled),
+			cloudformation.HandlerErrorCodeNetworkFailure,
+			"RequestCanceled: request context canceled: context canceled",
+		},
+		{
+			"unmapped code caused by a timeout",
+			awserr.New("SerializationError", "failed to read response", context.DeadlineExceeded),
+			cloudformation.HandlerErrorCodeNetworkFailure,
+			"SerializationError: failed to read response: context deadline exceeded",
+		},
+		{
+			"plain timeout",
+			context.DeadlineExceeded,
+			cloudformation.HandlerErrorCodeNetworkFailure,
+			"NetworkFailure: context deadline exceeded",
+		},
+		{
+			"plain error",
+			errors.New("something internal"),
+			cloudformation.HandlerErrorCodeGeneralServiceException,
+			"Internal Failure",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			evt, err := NewFailedEvent(tc.err)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, handler.Failed, evt.OperationStatus)
+			assert.Equal(t, tc.code, evt.HandlerErrorCode)
+			assert.Equal(t, tc.message, evt.Message)
+			assert.Nil(t, evt.CallbackContext)
+		})
+	}
+}
+
+func TestClassifyError_conflicts(t *testing.T) {
+	conflict := &prometheusservice.ConflictException{Message_: aws.String("conflict")}
+	throttled := &prometheusservice.ThrottlingException{Message_: aws.String("slow down")}
+
+	testCases := []struct {
+		name      string
+		err       error
+		code      string
+		retryable bool
+	}{
+		{"plain conflict", conflict, cloudformation.HandlerErrorCodeResourceConflict, false},
+		{"create conflict", WithCreateConflict(conflict), cloudformation.HandlerErrorCodeAlreadyExists, false},
+		{"busy conflict", WithBusyConflict(conflict), cloudformation.HandlerErrorCodeResourceConflict, true},
+		{"busy conflict with paths", WithBusyConflict(WithPropertyPaths(conflict, nil)), cloudformation.HandlerErrorCodeResourceConflict, true},
+		{"throttled create", WithCreateConflict(throttled), cloudformation.HandlerErrorCodeThrottling, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			classified := ClassifyError(tc.err)
+			assert.Equal(t, tc.code, classified.Code)
+			assert.Equal(t, tc.retryable, classified.Retryable)
+		})
+	}
+	assert.Nil(t, WithCreateConflict(nil))
+	assert.Nil(t, WithBusyConflict(nil))
+}
+
+func TestClassifyError_keepsClassification(t *testing.T) {
+	classified := &HandlerError{Code: cloudformation.HandlerErrorCodeNotFound, Message: "gone", RequestID: "req-1"}
+	assert.Same(t, classified, ClassifyError(fmt.Errorf("reading: %w", classified)))
+	assert.Equal(t, "gone (RequestId: req-1)", classified.Error())
+}
+
+func TestPropertyPaths_Path(t *testing.T) {
+	paths := PropertyPaths{
+		"data":              "/properties/AlertManagerDefinition",
+		"limitsPerLabelSet": "/properties/WorkspaceConfiguration/LimitsPerLabelSets",
+	}
+	testCases := map[string]string{
+		"alias": "/properties/Alias",
+		"data":  "/properties/AlertManagerDefinition",
+		"destination.ampConfiguration.workspaceArn": "/properties/Destination/AmpConfiguration/WorkspaceArn",
+		"limitsPerLabelSet[1].limits.maxSeries":     "/properties/WorkspaceConfiguration/LimitsPerLabelSets/1/Limits/MaxSeries",
+	}
+	for field, path := range testCases {
+		assert.Equal(t, path, paths.Path(field), field)
+	}
+}
@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+)
+
+// DefaultRetrier retries the Create, Update and Delete invocations served by
+// Invoke when APS throttles them or reports a transient conflict.
+var DefaultRetrier = NewRetrier()
+
+// DefaultMetricsSink receives the metrics of every invocation served by
+// Invoke. Tests replace it with a MemorySink.
+var DefaultMetricsSink MetricsSink = NewEMFSink(MetricsNamespace)
+
+// Invoke serves req for action, e.g. ActionCreate, on a resource of
+// resourceType with fn and records the metrics of the invocation. Failures of
+// Create, Update and Delete are retried by DefaultRetrier, calling back with
+// model; Read and List must not return InProgress. The error returned along
+// with a failed event only informs the retry, and is dropped.
+func Invoke(resourceType, action string, req handler.Request, model interface{}, fn func(handler.Request) (handler.ProgressEvent, error)) (handler.ProgressEvent, error) {
+	metrics := NewMetrics(resourceType, action, DefaultMetricsSink)
+	req = metrics.Instrument(req)
+	evt, err := fn(req)
+	if action != ActionRead && action != ActionList {
+		evt, err = DefaultRetrier.Retry(req, model, evt, err)
+	}
+	if evt.OperationStatus == handler.Failed {
+		err = nil
+	}
+	metrics.Record(req, evt, err)
+	return evt, err
+}
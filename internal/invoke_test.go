@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvoke(t *testing.T) {
+	sink := &MemorySink{}
+	orig := DefaultMetricsSink
+	DefaultMetricsSink = sink
+	t.Cleanup(func() { DefaultMetricsSink = orig })
+
+	throttled := func(handler.Request) (handler.ProgressEvent, error) {
+		return NewFailedEvent(&prometheusservice.ThrottlingException{Message_: aws.String("slow down")})
+	}
+
+	evt, err := Invoke(testResourceType, ActionUpdate, handler.Request{}, "model", throttled)
+	require.NoError(t, err)
+	assert.Equal(t, handler.InProgress, evt.OperationStatus)
+	assert.Equal(t, "model", evt.ResourceModel)
+	assert.Empty(t, sink.Values(MetricHandlerErrors))
+
+	// Read can't call back, so the failure is returned as it is
+	evt, err = Invoke(testResourceType, ActionRead, handler.Request{}, "model", throttled)
+	require.NoError(t, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Nil(t, evt.CallbackContext)
+	errors := sink.Values(MetricHandlerErrors)
+	require.Len(t, errors, 1)
+	assert.Equal(t, map[string]string{
+		DimensionResourceType:     testResourceType,
+		DimensionAction:           ActionRead,
+		DimensionHandlerErrorCode: cloudformation.HandlerErrorCodeThrottling,
+	}, errors[0].Properties)
+}
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// The handler actions, as CloudFormation names them.
+const (
+	ActionCreate = "CREATE"
+	ActionRead   = "READ"
+	ActionUpdate = "UPDATE"
+	ActionDelete = "DELETE"
+	ActionList   = "LIST"
+)
+
+// LogLevel is the severity of a log record.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+// LogLevelFromEnv returns the level below which records are dropped. Like
+// the rest of the handlers, it logs more in MODE=Test: debug records include
+// the parameters of every APS call.
+func LogLevelFromEnv() LogLevel {
+	if os.Getenv("MODE") == "Test" {
+		return LevelDebug
+	}
+	return LevelInfo
+}
+
+// redactedFields are the request parameters that are never logged, because
+// they hold customer configuration such as alert manager definitions, rule
+// groups, scrape configurations, resource policies and the label sets of
+// series limits.
+var redactedFields = map[string]struct{}{
+	"Data":              {},
+	"ConfigurationBlob": {},
+	"PolicyDocument":    {},
+	"LabelSet":          {},
+}
+
+const redacted = "REDACTED"
+
+// apiCallRecord is the JSON line logged for an APS call.
+type apiCallRecord struct {
+	Level             string      `json:"level"`
+	Time              string      `json:"time"`
+	Operation         string      `json:"operation"`
+	WorkspaceID       string      `json:"workspaceId,omitempty"`
+	StatusCode        int         `json:"statusCode,omitempty"`
+	LatencyMillis     int64       `json:"latencyMs"`
+	RetryCount        int         `json:"retryCount"`
+	RequestID         string      `json:"requestId,omitempty"`
+	TraceID           string      `json:"traceId,omitempty"`
+	LogicalResourceID string      `json:"logicalResourceId,omitempty"`
+	Action            string      `json:"action,omitempty"`
+	ErrorCode         string      `json:"errorCode,omitempty"`
+	Error             string      `json:"error,omitempty"`
+	Params            interface{} `json:"params,omitempty"`
+}
+
+// CallLogger logs every APS call made while serving a handler request as one
+// JSON line. Calls that succeed are logged at info level, client errors at
+// warn level and server errors or calls without a response at error level.
+type CallLogger struct {
+	LogicalResourceID string
+	Action            string
+	Level             LogLevel
+
+	logger *log.Logger
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// NewCallLogger returns a CallLogger for the resource logicalResourceID
+// writing to the standard logger's output at the level set by MODE.
+func NewCallLogger(logicalResourceID, action string) *CallLogger {
+	return &CallLogger{
+		LogicalResourceID: logicalResourceID,
+		Action:            action,
+		Level:             LogLevelFromEnv(),
+		logger:            log.New(log.Writer(), "", 0),
+		now:               time.Now,
+	}
+}
+
+// Log logs a completed APS request. It is registered as a Complete handler
+// of the APS client.
+func (l *CallLogger) Log(r *request.Request) {
+	level := LevelInfo
+	if r.Error != nil {
+		level = LevelError
+		if r.HTTPResponse != nil && r.HTTPResponse.StatusCode < 500 {
+			level = LevelWarn
+		}
+	}
+	if level < l.Level {
+		return
+	}
+
+	now := l.now()
+	record := apiCallRecord{
+		Level:             level.String(),
+		Time:              now.UTC().Format(time.RFC3339Nano),
+		Operation:         r.Operation.Name,
+		WorkspaceID:       stringField(r.Params, "WorkspaceId"),
+		LatencyMillis:     now.Sub(r.Time).Milliseconds(),
+		RetryCount:        r.RetryCount,
+		RequestID:         r.RequestID,
+		LogicalResourceID: l.LogicalResourceID,
+		Action:            l.Action,
+	}
+	if record.WorkspaceID == "" {
+		// CreateWorkspace only learns the ID from its response
+		record.WorkspaceID = stringField(r.Data, "WorkspaceId")
+	}
+	if r.HTTPResponse != nil {
+		record.StatusCode = r.HTTPResponse.StatusCode
+		record.TraceID = r.HTTPResponse.Header.Get(xrayTraceIDHeader)
+		if record.RequestID == "" {
+			record.RequestID = r.HTTPResponse.Header.Get(requestIDHeader)
+		}
+	}
+	if r.Error != nil {
+		record.Error = r.Error.Error()
+		if awsErr, ok := r.Error.(awserr.Error); ok {
+			record.ErrorCode = awsErr.Code()
+		}
+	}
+	if l.Level == LevelDebug {
+		record.Params = redactParams(r.Params)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		l.logger.Printf("%s: logging failed: %v", r.Operation.Name, err)
+		return
+	}
+	l.logger.Println(string(line))
+}
+
+// stringField returns the string field name of the struct v points to, or ""
+// if it has none.
+func stringField(v interface{}, name string) string {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	field := value.Elem().FieldByName(name)
+	if !field.IsValid() {
+		return ""
+	}
+	switch field.Kind() {
+	case reflect.String:
+		return field.String()
+	case reflect.Ptr:
+		if !field.IsNil() && field.Elem().Kind() == reflect.String {
+			return field.Elem().String()
+		}
+	}
+	return ""
+}
+
+// redactParams returns the request parameters params as generic JSON values,
+// with redactedFields replaced at any depth.
+func redactParams(params interface{}) interface{} {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil
+	}
+	return redactValue(generic)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if _, ok := redactedFields[key]; ok && value != nil {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
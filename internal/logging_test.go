@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLoggedClient returns a client for a server answering with handler whose
+// calls are logged at level into the returned buffer.
+func testLoggedClient(t *testing.T, level LogLevel, handler http.HandlerFunc) (*prometheusservice.PrometheusService, *bytes.Buffer) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		MaxRetries:  aws.Int(0),
+		Region:      aws.String("us-west-2"),
+	}))
+
+	var buf bytes.Buffer
+	logger := NewCallLogger("MyWorkspace", ActionUpdate)
+	logger.Level = level
+	logger.logger.SetOutput(&buf)
+	return NewAPS(sess, logger), &buf
+}
+
+// logRecords decodes the JSON lines in buf.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestCallLogger(t *testing.T) {
+	client, buf := testLoggedClient(t, LevelDebug, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(requestIDHeader, "req-1")
+		w.Header().Set(xrayTraceIDHeader, "Root=1-abc")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status": {"statusCode": "UPDATING"}}`))
+	})
+
+	_, err := client.PutAlertManagerDefinition(&prometheusservice.PutAlertManagerDefinitionInput{
+		WorkspaceId: aws.String("ws-1"),
+		Data:        []byte("alertmanager_config: secret"),
+	})
+	require.NoError(t, err)
+
+	records := logRecords(t, buf)
+	require.Len(t, records, 1)
+	record := records[0]
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "PutAlertManagerDefinition", record["operation"])
+	assert.Equal(t, "ws-1", record["workspaceId"])
+	assert.EqualValues(t, http.StatusAccepted, record["statusCode"])
+	assert.EqualValues(t, 0, record["retryCount"])
+	assert.Contains(t, record, "latencyMs")
+	assert.Equal(t, "req-1", record["requestId"])
+	assert.Equal(t, "Root=1-abc", record["traceId"])
+	assert.Equal(t, "MyWorkspace", record["logicalResourceId"])
+	assert.Equal(t, ActionUpdate, record["action"])
+
+	params := record["params"].(map[string]interface{})
+	assert.Equal(t, "ws-1", params["WorkspaceId"])
+	assert.Equal(t, redacted, params["Data"])
+	assert.NotContains(t, buf.String(), "secret")
+}
+
+func TestCallLogger_failure(t *testing.T) {
+	client, buf := testLoggedClient(t, LevelInfo, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(requestIDHeader, "req-2")
+		w.Header().Set("X-Amzn-Errortype", "ResourceNotFoundException")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "workspace not found"}`))
+	})
+
+	_, err := client.DescribeRuleGroupsNamespace(&prometheusservice.DescribeRuleGroupsNamespaceInput{
+		WorkspaceId: aws.String("ws-1"),
+		Name:        aws.String("rules"),
+	})
+	require.Error(t, err)
+
+	records := logRecords(t, buf)
+	require.Len(t, records, 1)
+	record := records[0]
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "DescribeRuleGroupsNamespace", record["operation"])
+	assert.EqualValues(t, http.StatusNotFound, record["statusCode"])
+	assert.Equal(t, "req-2", record["requestId"])
+	assert.Equal(t, prometheusservice.ErrCodeResourceNotFoundException, record["errorCode"])
+	// parameters are only logged at debug level
+	assert.NotContains(t, record, "params")
+}
+
+func TestCallLogger_level(t *testing.T) {
+	client, buf := testLoggedClient(t, LevelWarn, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"workspaceId": "ws-2", "arn": "arn", "status": {"statusCode": "CREATING"}}`))
+	})
+
+	_, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+}
+
+func TestCallLogger_workspaceIDFromResponse(t *testing.T) {
+	client, buf := testLoggedClient(t, LevelInfo, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"workspaceId": "ws-2", "arn": "arn", "status": {"statusCode": "CREATING"}}`))
+	})
+
+	_, err := client.CreateWorkspace(&prometheusservice.CreateWorkspaceInput{})
+	require.NoError(t, err)
+	records := logRecords(t, buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "ws-2", records[0]["workspaceId"])
+}
+
+func TestRedactParams(t *testing.T) {
+	params := redactParams(&prometheusservice.CreateScraperInput{
+		Alias: aws.String("scraper"),
+		ScrapeConfiguration: &prometheusservice.ScrapeConfiguration{
+			ConfigurationBlob: []byte("scrape_configs: []"),
+		},
+	})
+	assert.Equal(t, "scraper", params.(map[string]interface{})["Alias"])
+	assert.Equal(t, map[string]interface{}{"ConfigurationBlob": redacted}, params.(map[string]interface{})["ScrapeConfiguration"])
+
+	params = redactParams(&PutResourcePolicyInput{
+		PolicyDocument: aws.String(`{"Version": "2012-10-17"}`),
+		WorkspaceId:    aws.String("ws-1"),
+	})
+	assert.Equal(t, redacted, params.(map[string]interface{})["PolicyDocument"])
+	assert.Equal(t, "ws-1", params.(map[string]interface{})["WorkspaceId"])
+
+	params = redactParams(&UpdateWorkspaceConfigurationInput{
+		LimitsPerLabelSet: []*LimitsPerLabelSet{{
+			LabelSet: map[string]*string{"team": aws.String("a")},
+			Limits:   &LimitsPerLabelSetEntry{MaxSeries: aws.Int64(1000)},
+		}},
+	})
+	limits := params.(map[string]interface{})["LimitsPerLabelSet"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, redacted, limits["LabelSet"])
+	assert.Equal(t, map[string]interface{}{"MaxSeries": float64(1000)}, limits["Limits"])
+}
+
+func TestCallLogger_latency(t *testing.T) {
+	logger := NewCallLogger("MyWorkspace", ActionCreate)
+	var buf bytes.Buffer
+	logger.logger.SetOutput(&buf)
+	start := time.Unix(100, 0)
+	logger.now = func() time.Time { return start.Add(1500 * time.Millisecond) }
+
+	// a request that never got a response
+	logger.Log(&request.Request{
+		Operation:  &request.Operation{Name: "DescribeWorkspace"},
+		Params:     &prometheusservice.DescribeWorkspaceInput{WorkspaceId: aws.String("ws-1")},
+		Time:       start,
+		RetryCount: 2,
+		Error:      errors.New("connection reset"),
+	})
+	records := logRecords(t, &buf)
+	require.Len(t, records, 1)
+	assert.EqualValues(t, 1500, records[0]["latencyMs"])
+	assert.EqualValues(t, 2, records[0]["retryCount"])
+	assert.Equal(t, "ERROR", records[0]["level"])
+}
@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// MetricsNamespace is the CloudWatch namespace of the handler metrics.
+const MetricsNamespace = "APS/ResourceProviders"
+
+// The names of the handler metrics.
+const (
+	// MetricAPILatency is the time an APS call took, retries included.
+	MetricAPILatency = "ApiLatency"
+	// MetricAPIErrors counts the APS calls that failed, by error code.
+	MetricAPIErrors = "ApiErrors"
+	// MetricHandlerErrors counts the invocations that failed, by handler
+	// error code.
+	MetricHandlerErrors = "HandlerErrors"
+	// MetricStabilizationAttempts is the number of callbacks a phase took.
+	MetricStabilizationAttempts = "StabilizationAttempts"
+	// MetricPhaseDuration is the time from entering a phase to leaving it.
+	MetricPhaseDuration = "PhaseDuration"
+)
+
+// The units of the handler metrics.
+const (
+	UnitCount        = "Count"
+	UnitMilliseconds = "Milliseconds"
+)
+
+// The dimensions of the handler metrics.
+const (
+	DimensionResourceType     = "ResourceType"
+	DimensionAction           = "Action"
+	DimensionOperation        = "Operation"
+	DimensionErrorCode        = "ErrorCode"
+	DimensionHandlerErrorCode = "HandlerErrorCode"
+	DimensionPhase            = "Phase"
+)
+
+// MetricValue is a single value of a metric.
+type MetricValue struct {
+	Name  string
+	Unit  string
+	Value float64
+}
+
+// MetricRecord is a group of metric values that share their dimensions, like
+// a CloudWatch embedded metric format (EMF) record.
+type MetricRecord struct {
+	Timestamp time.Time
+	// Dimensions lists the dimension sets the values are aggregated by.
+	Dimensions [][]string
+	// Properties holds the value of every dimension.
+	Properties map[string]string
+	Values     []MetricValue
+}
+
+// MetricsSink receives metric records. Sinks must be safe for concurrent use,
+// as the calls of a hydrated List are recorded from several goroutines.
+type MetricsSink interface {
+	Emit(record MetricRecord)
+}
+
+// EMFSink writes metric records as CloudWatch EMF log lines, which CloudWatch
+// Logs extracts the metrics from. Nothing is sent to CloudWatch directly, so
+// it works without network access.
+type EMFSink struct {
+	Namespace string
+
+	logger *log.Logger
+}
+
+// NewEMFSink returns an EMFSink writing to the standard logger's output.
+func NewEMFSink(namespace string) *EMFSink {
+	return &EMFSink{Namespace: namespace, logger: log.New(log.Writer(), "", 0)}
+}
+
+// emfMetadata is the "_aws" member of an EMF record.
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDirective struct {
+	Namespace  string          `json:"Namespace"`
+	Dimensions [][]string      `json:"Dimensions"`
+	Metrics    []emfDefinition `json:"Metrics"`
+}
+
+type emfDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// Emit writes record as one EMF line.
+func (s *EMFSink) Emit(record MetricRecord) {
+	directive := emfDirective{Namespace: s.Namespace, Dimensions: record.Dimensions}
+	line := map[string]interface{}{}
+	for name, value := range record.Properties {
+		line[name] = value
+	}
+	for _, value := range record.Values {
+		directive.Metrics = append(directive.Metrics, emfDefinition{Name: value.Name, Unit: value.Unit})
+		line[value.Name] = value.Value
+	}
+	line["_aws"] = emfMetadata{
+		Timestamp:         record.Timestamp.UnixNano() / int64(time.Millisecond),
+		CloudWatchMetrics: []emfDirective{directive},
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		s.logger.Printf("emitting metrics failed: %v", err)
+		return
+	}
+	s.logger.Println(string(data))
+}
+
+// MemorySink keeps metric records in memory, for tests.
+type MemorySink struct {
+	mu      sync.Mutex
+	records []MetricRecord
+}
+
+// Emit stores record.
+func (s *MemorySink) Emit(record MetricRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+}
+
+// Records returns the records emitted so far.
+func (s *MemorySink) Records() []MetricRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]MetricRecord(nil), s.records...)
+}
+
+// Values returns the values emitted for the metric name, with the properties
+// of their records.
+func (s *MemorySink) Values(name string) []RecordedValue {
+	var values []RecordedValue
+	for _, record := range s.Records() {
+		for _, value := range record.Values {
+			if value.Name == name {
+				values = append(values, RecordedValue{Value: value.Value, Properties: record.Properties})
+			}
+		}
+	}
+	return values
+}
+
+// RecordedValue is a metric value kept by MemorySink.
+type RecordedValue struct {
+	Value      float64
+	Properties map[string]string
+}
+
+// Metrics records the metrics of one handler invocation. Every record has
+// the resource type and handler action as dimensions.
+type Metrics struct {
+	ResourceType string
+	Action       string
+	Sink         MetricsSink
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// NewMetrics returns the recorder of an invocation of action, e.g.
+// ActionCreate, for resourceType, e.g. "AWS::APS::Workspace".
+func NewMetrics(resourceType, action string, sink MetricsSink) *Metrics {
+	return &Metrics{
+		ResourceType: resourceType,
+		Action:       action,
+		Sink:         sink,
+		now:          time.Now,
+	}
+}
+
+// Instrument returns req with a session that records the latency and errors
+// of every APS call made with it. The session of req is left unchanged.
+func (m *Metrics) Instrument(req handler.Request) handler.Request {
+	if req.Session == nil {
+		return req
+	}
+	req.Session = req.Session.Copy()
+	req.Session.Handlers.Complete.PushBack(m.RecordAPICall)
+	return req
+}
+
+// RecordAPICall records a completed APS request. It is registered as a
+// Complete handler by Instrument.
+func (m *Metrics) RecordAPICall(r *request.Request) {
+	properties := m.properties(DimensionOperation, r.Operation.Name)
+	m.emit(properties, [][]string{m.dimensions(), m.dimensions(DimensionOperation)},
+		MetricValue{Name: MetricAPILatency, Unit: UnitMilliseconds, Value: float64(m.now().Sub(r.Time).Milliseconds())})
+
+	if r.Error == nil {
+		return
+	}
+	errorCode := "Unknown"
+	if awsErr, ok := r.Error.(awserr.Error); ok {
+		errorCode = awsErr.Code()
+	}
+	properties[DimensionErrorCode] = errorCode
+	m.emit(properties, [][]string{m.dimensions(DimensionErrorCode), m.dimensions(DimensionOperation, DimensionErrorCode)},
+		MetricValue{Name: MetricAPIErrors, Unit: UnitCount, Value: 1})
+}
+
+// Record records the outcome of the invocation serving req: whether it
+// failed, and the attempts and duration of the phase it was waiting in if
+// that phase is over.
+func (m *Metrics) Record(req handler.Request, evt handler.ProgressEvent, err error) {
+	if err != nil || evt.OperationStatus == handler.Failed {
+		code := evt.HandlerErrorCode
+		if err != nil || code == "" {
+			code = cloudformation.HandlerErrorCodeInternalFailure
+		}
+		m.emit(m.properties(DimensionHandlerErrorCode, code), [][]string{m.dimensions(), m.dimensions(DimensionHandlerErrorCode)},
+			MetricValue{Name: MetricHandlerErrors, Unit: UnitCount, Value: 1})
+	}
+
+	// contexts that can't be decoded have already failed the invocation
+	c, decodeErr := DecodeCallbackContext(req.CallbackContext, nil)
+	if decodeErr != nil || c == nil {
+		return
+	}
+	// the phase goes on while the handler keeps calling back in it, retries
+	// included
+	if err == nil && evt.OperationStatus == handler.InProgress && evt.CallbackContext["Phase"] == string(c.Phase) {
+		return
+	}
+	m.emit(m.properties(DimensionPhase, string(c.Phase)), [][]string{m.dimensions(), m.dimensions(DimensionPhase)},
+		MetricValue{Name: MetricStabilizationAttempts, Unit: UnitCount, Value: float64(c.Attempt)},
+		MetricValue{Name: MetricPhaseDuration, Unit: UnitMilliseconds, Value: float64(m.now().Sub(c.StartedAt).Milliseconds())})
+}
+
+// dimensions returns the dimension set of the resource type, the action and
+// extra.
+func (m *Metrics) dimensions(extra ...string) []string {
+	return append([]string{DimensionResourceType, DimensionAction}, extra...)
+}
+
+// properties returns the dimension values of the resource type and the
+// action, plus the name-value pairs in extra.
+func (m *Metrics) properties(extra ...string) map[string]string {
+	properties := map[string]string{
+		DimensionResourceType: m.ResourceType,
+		DimensionAction:       m.Action,
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		properties[extra[i]] = extra[i+1]
+	}
+	return properties
+}
+
+func (m *Metrics) emit(properties map[string]string, dimensions [][]string, values ...MetricValue) {
+	if m.Sink == nil {
+		return
+	}
+	copied := make(map[string]string, len(properties))
+	for name, value := range properties {
+		copied[name] = value
+	}
+	m.Sink.Emit(MetricRecord{
+		Timestamp:  m.now(),
+		Dimensions: dimensions,
+		Properties: copied,
+		Values:     values,
+	})
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testResourceType = "AWS::APS::Workspace"
+
+func TestEMFSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewEMFSink(MetricsNamespace)
+	sink.logger = log.New(&buf, "", 0)
+
+	sink.Emit(MetricRecord{
+		Timestamp:  time.Unix(1700000000, 5e8),
+		Dimensions: [][]string{{DimensionResourceType, DimensionAction}},
+		Properties: map[string]string{DimensionResourceType: testResourceType, DimensionAction: ActionCreate},
+		Values:     []MetricValue{{Name: MetricHandlerErrors, Unit: UnitCount, Value: 1}},
+	})
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": float64(1700000000500),
+			"CloudWatchMetrics": []interface{}{map[string]interface{}{
+				"Namespace":  MetricsNamespace,
+				"Dimensions": []interface{}{[]interface{}{DimensionResourceType, DimensionAction}},
+				"Metrics":    []interface{}{map[string]interface{}{"Name": MetricHandlerErrors, "Unit": UnitCount}},
+			}},
+		},
+		DimensionResourceType: testResourceType,
+		DimensionAction:       ActionCreate,
+		MetricHandlerErrors:   float64(1),
+	}, line)
+}
+
+func TestMetrics_Record(t *testing.T) {
+	sink := &MemorySink{}
+	m := NewMetrics(testResourceType, ActionCreate, sink)
+	started := time.Unix(1000, 0)
+	m.now = func() time.Time { return started.Add(90 * time.Second) }
+
+	waiting := CallbackContext{Version: CallbackContextVersion, Phase: testPhase, Arn: testArn, Attempt: 3, StartedAt: started}
+	req := handler.Request{CallbackContext: roundTrip(t, waiting.encode())}
+
+	// still waiting in the phase
+	m.Record(req, handler.ProgressEvent{OperationStatus: handler.InProgress, CallbackContext: waiting.Next(testPhase, testArn)}, nil)
+	assert.Empty(t, sink.Records())
+
+	// moving on to the next phase ends the phase
+	m.Record(req, handler.ProgressEvent{OperationStatus: handler.InProgress, CallbackContext: waiting.Next(testPhaseAnother, testArn)}, nil)
+	attempts := sink.Values(MetricStabilizationAttempts)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, float64(3), attempts[0].Value)
+	assert.Equal(t, map[string]string{
+		DimensionResourceType: testResourceType,
+		DimensionAction:       ActionCreate,
+		DimensionPhase:        string(testPhase),
+	}, attempts[0].Properties)
+	duration := sink.Values(MetricPhaseDuration)
+	require.Len(t, duration, 1)
+	assert.Equal(t, float64(90000), duration[0].Value)
+	assert.Empty(t, sink.Values(MetricHandlerErrors))
+
+	// so does failing
+	m.Record(req, handler.ProgressEvent{OperationStatus: handler.Failed, HandlerErrorCode: cloudformation.HandlerErrorCodeNotStabilized}, nil)
+	assert.Len(t, sink.Values(MetricStabilizationAttempts), 2)
+	errors := sink.Values(MetricHandlerErrors)
+	require.Len(t, errors, 1)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotStabilized, errors[0].Properties[DimensionHandlerErrorCode])
+
+	// a first invocation has no phase to end
+	m.Record(handler.Request{}, handler.ProgressEvent{OperationStatus: handler.Success}, nil)
+	assert.Len(t, sink.Records(), 3)
+}
+
+func TestMetrics_RecordAPICall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.Header().Set("X-Amzn-Errortype", "ThrottlingException")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message": "slow down"}`))
+			return
+		}
+		w.Write([]byte(`{"workspaceId": "ws-1", "arn": "arn", "status": {"statusCode": "ACTIVE"}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		MaxRetries:  aws.Int(0),
+		Region:      aws.String("us-west-2"),
+	}))
+	sink := &MemorySink{}
+	m := NewMetrics(testResourceType, ActionDelete, sink)
+	req := m.Instrument(handler.Request{Session: sess})
+	assert.NotSame(t, sess, req.Session)
+
+	client := prometheusservice.New(req.Session)
+	_, err := client.DescribeWorkspace(&prometheusservice.DescribeWorkspaceInput{WorkspaceId: aws.String("ws-1")})
+	require.NoError(t, err)
+	_, err = client.DeleteWorkspace(&prometheusservice.DeleteWorkspaceInput{WorkspaceId: aws.String("ws-1")})
+	require.Error(t, err)
+
+	latency := sink.Values(MetricAPILatency)
+	require.Len(t, latency, 2)
+	assert.Equal(t, "DescribeWorkspace", latency[0].Properties[DimensionOperation])
+	assert.Equal(t, ActionDelete, latency[0].Properties[DimensionAction])
+	assert.Equal(t, "DeleteWorkspace", latency[1].Properties[DimensionOperation])
+
+	errors := sink.Values(MetricAPIErrors)
+	require.Len(t, errors, 1)
+	assert.Equal(t, map[string]string{
+		DimensionResourceType: testResourceType,
+		DimensionAction:       ActionDelete,
+		DimensionOperation:    "DeleteWorkspace",
+		DimensionErrorCode:    prometheusservice.ErrCodeThrottlingException,
+	}, errors[0].Properties)
+
+	// the original session isn't instrumented
+	_, err = prometheusservice.New(sess).DescribeWorkspace(&prometheusservice.DescribeWorkspaceInput{WorkspaceId: aws.String("ws-1")})
+	require.NoError(t, err)
+	assert.Len(t, sink.Values(MetricAPILatency), 2)
+}
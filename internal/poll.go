@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const (
+	defaultBaseCallbackDelay = 2 * time.Second
+	defaultMaxCallbackDelay  = 60 * time.Second
+	defaultPhaseTimeout      = 30 * time.Minute
+
+	messageInProgress = "In Progress"
+)
+
+var (
+	jitterMu sync.Mutex
+	jitter   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Poller schedules the callbacks a handler uses to wait for a resource to
+// stabilize. The delay between callbacks grows exponentially with jitter, and
+// every phase has a deadline after which the handler fails.
+type Poller struct {
+	// BaseDelay is the delay before the first callback of a phase.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between callbacks.
+	MaxDelay time.Duration
+	// Timeouts holds the deadline of each phase. Phases without one use
+	// DefaultTimeout.
+	Timeouts       map[Phase]time.Duration
+	DefaultTimeout time.Duration
+}
+
+// NewPoller returns a Poller with the default delays and the given per-phase
+// timeouts.
+func NewPoller(timeouts map[Phase]time.Duration) *Poller {
+	return &Poller{
+		BaseDelay:      defaultBaseCallbackDelay,
+		MaxDelay:       defaultMaxCallbackDelay,
+		Timeouts:       timeouts,
+		DefaultTimeout: defaultPhaseTimeout,
+	}
+}
+
+// Next returns the InProgress event scheduling another callback in phase for
+// the resource arn. c is the callback context of the current invocation and
+// may be nil. Once c has been waiting in phase for longer than the phase
+// timeout, Next returns a NotStabilized failure instead.
+func (p *Poller) Next(c *CallbackContext, phase Phase, arn string, model interface{}) handler.ProgressEvent {
+	if c.InPhase(phase) {
+		timeout := p.timeout(phase)
+		if elapsed := time.Since(c.StartedAt); elapsed > timeout {
+			return handler.ProgressEvent{
+				OperationStatus: handler.Failed,
+				Message: fmt.Sprintf("%s timed out: resource did not stabilize within %s (waited %s)",
+					phase, timeout, elapsed.Round(time.Second)),
+				HandlerErrorCode: cloudformation.HandlerErrorCodeNotStabilized,
+				ResourceModel:    model,
+			}
+		}
+	}
+
+	callbackContext := c.Next(phase, arn)
+	attempt := 1
+	if c.InPhase(phase) {
+		attempt = c.Attempt + 1
+	}
+
+	return handler.ProgressEvent{
+		OperationStatus:      handler.InProgress,
+		Message:              messageInProgress,
+		ResourceModel:        model,
+		CallbackDelaySeconds: p.delaySeconds(attempt),
+		CallbackContext:      callbackContext,
+	}
+}
+
+func (p *Poller) timeout(phase Phase) time.Duration {
+	if timeout, ok := p.Timeouts[phase]; ok {
+		return timeout
+	}
+	return p.DefaultTimeout
+}
+
+// delaySeconds returns the delay before callback number attempt.
+func (p *Poller) delaySeconds(attempt int) int64 {
+	return backoffSeconds(p.BaseDelay, p.MaxDelay, attempt)
+}
+
+// backoffSeconds returns the delay before callback number attempt. The delay
+// starts at base and doubles with every attempt up to max, and a random half
+// of it is dropped so handlers calling back at the same time spread out.
+func backoffSeconds(base, max time.Duration, attempt int) int64 {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	half := int64(delay / 2)
+	jitterMu.Lock()
+	delay = time.Duration(half + jitter.Int63n(half+1))
+	jitterMu.Unlock()
+
+	seconds := int64(delay.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
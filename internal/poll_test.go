@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoller_delaySeconds(t *testing.T) {
+	p := &Poller{
+		BaseDelay: 2 * time.Second,
+		MaxDelay:  60 * time.Second,
+	}
+
+	testCases := []struct {
+		attempt  int
+		min, max int64
+	}{
+		{1, 1, 2},
+		{2, 2, 4},
+		{3, 4, 8},
+		{5, 16, 32},
+		{6, 30, 60},
+		{50, 30, 60},
+	}
+	for _, tc := range testCases {
+		for i := 0; i < 20; i++ {
+			delay := p.delaySeconds(tc.attempt)
+			if delay < tc.min || delay > tc.max {
+				t.Fatalf("attempt %d: expected delay in [%d, %d], got %d", tc.attempt, tc.min, tc.max, delay)
+			}
+		}
+	}
+}
+
+func TestPoller_Next(t *testing.T) {
+	p := NewPoller(map[Phase]time.Duration{testPhase: time.Minute})
+
+	evt := p.Next(nil, testPhase, testArn, "model")
+	assert.Equal(t, handler.InProgress, evt.OperationStatus)
+	assert.Equal(t, "model", evt.ResourceModel)
+	assert.True(t, evt.CallbackDelaySeconds >= 1)
+
+	c, err := DecodeCallbackContext(evt.CallbackContext, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.Attempt)
+
+	evt = p.Next(c, testPhase, testArn, "model")
+	assert.Equal(t, handler.InProgress, evt.OperationStatus)
+	c, err = DecodeCallbackContext(evt.CallbackContext, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, c.Attempt)
+}
+
+func TestPoller_Next_timeout(t *testing.T) {
+	p := NewPoller(map[Phase]time.Duration{testPhase: time.Minute})
+	started := &CallbackContext{
+		Version:   CallbackContextVersion,
+		Phase:     testPhase,
+		Arn:       testArn,
+		Attempt:   10,
+		StartedAt: time.Now().Add(-2 * time.Minute),
+	}
+
+	evt := p.Next(started, testPhase, testArn, nil)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeNotStabilized, evt.HandlerErrorCode)
+	assert.Contains(t, evt.Message, string(testPhase))
+	assert.Contains(t, evt.Message, "1m0s")
+
+	// the deadline only applies to the phase it was started for
+	evt = p.Next(started, testPhaseAnother, testArn, nil)
+	assert.Equal(t, handler.InProgress, evt.OperationStatus)
+
+	// phases without an explicit timeout use the default
+	started.Phase = testPhaseAnother
+	evt = p.Next(started, testPhaseAnother, testArn, nil)
+	assert.Equal(t, handler.InProgress, evt.OperationStatus)
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out calls made from several goroutines, so that together
+// they stay under a request rate.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+
+	// now and sleep are replaced in tests.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter returns a RateLimiter allowing perSecond calls a second. A
+// limit of zero or less doesn't limit calls.
+func NewRateLimiter(perSecond int) *RateLimiter {
+	l := &RateLimiter{now: time.Now, sleep: time.Sleep}
+	if perSecond > 0 {
+		l.interval = time.Second / time.Duration(perSecond)
+	}
+	return l
+}
+
+// Wait blocks until the caller may make its call.
+func (l *RateLimiter) Wait() {
+	if l.interval == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay > 0 {
+		l.sleep(delay)
+	}
+}
+
+// RunBounded calls fn for every index in [0, n) from at most workers
+// goroutines, waiting on limiter before each call. It returns the errors by
+// index; a failed call doesn't stop the others.
+func RunBounded(n, workers int, limiter *RateLimiter, fn func(i int) error) []error {
+	errs := make([]error, n)
+	if workers < 1 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				limiter.Wait()
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	var slept []time.Duration
+	l := NewRateLimiter(4)
+	l.now = func() time.Time { return now }
+	l.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	for i := 0; i < 3; i++ {
+		l.Wait()
+	}
+	assert.Equal(t, []time.Duration{250 * time.Millisecond, 500 * time.Millisecond}, slept)
+
+	// time spent elsewhere counts towards the interval
+	now = now.Add(time.Second)
+	l.Wait()
+	assert.Len(t, slept, 2)
+}
+
+func TestRateLimiter_unlimited(t *testing.T) {
+	l := NewRateLimiter(0)
+	l.sleep = func(time.Duration) { t.Fatal("unlimited rate limiter slept") }
+	l.Wait()
+	l.Wait()
+}
+
+func TestRunBounded(t *testing.T) {
+	var mu sync.Mutex
+	var running, maxRunning int32
+	var calls int32
+	errs := RunBounded(10, 3, NewRateLimiter(0), func(i int) error {
+		atomic.AddInt32(&calls, 1)
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if i%4 == 0 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	assert.EqualValues(t, 10, calls)
+	assert.LessOrEqual(t, maxRunning, int32(3))
+	for i, err := range errs {
+		assert.Equal(t, i%4 == 0, err != nil, "error for index %d", i)
+	}
+	assert.Empty(t, RunBounded(0, 3, NewRateLimiter(0), func(int) error { return nil }))
+}
@@ -0,0 +1,911 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// This file holds a syntax checker for PromQL, the expression language of
+// Prometheus rules. It follows the grammar and the static type checks of the
+// upstream parser closely enough to catch mistakes before a rule file is sent
+// to APS, but it doesn't build an AST: the service does the evaluation.
+
+// promqlType is the type an expression evaluates to.
+type promqlType string
+
+const (
+	promqlScalar      promqlType = "scalar"
+	promqlVector      promqlType = "instant vector"
+	promqlMatrix      promqlType = "range vector"
+	promqlStringValue promqlType = "string"
+)
+
+type promqlFunction struct {
+	args []promqlType
+	// variadic is the number of trailing arguments that may be omitted, or -1
+	// when the last argument is optional and may be repeated.
+	variadic   int
+	returnType promqlType
+}
+
+var promqlFunctions = map[string]promqlFunction{
+	"abs":                          {[]promqlType{promqlVector}, 0, promqlVector},
+	"absent":                       {[]promqlType{promqlVector}, 0, promqlVector},
+	"absent_over_time":             {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"acos":                         {[]promqlType{promqlVector}, 0, promqlVector},
+	"acosh":                        {[]promqlType{promqlVector}, 0, promqlVector},
+	"asin":                         {[]promqlType{promqlVector}, 0, promqlVector},
+	"asinh":                        {[]promqlType{promqlVector}, 0, promqlVector},
+	"atan":                         {[]promqlType{promqlVector}, 0, promqlVector},
+	"atanh":                        {[]promqlType{promqlVector}, 0, promqlVector},
+	"avg_over_time":                {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"ceil":                         {[]promqlType{promqlVector}, 0, promqlVector},
+	"changes":                      {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"clamp":                        {[]promqlType{promqlVector, promqlScalar, promqlScalar}, 0, promqlVector},
+	"clamp_max":                    {[]promqlType{promqlVector, promqlScalar}, 0, promqlVector},
+	"clamp_min":                    {[]promqlType{promqlVector, promqlScalar}, 0, promqlVector},
+	"cos":                          {[]promqlType{promqlVector}, 0, promqlVector},
+	"cosh":                         {[]promqlType{promqlVector}, 0, promqlVector},
+	"count_over_time":              {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"day_of_month":                 {[]promqlType{promqlVector}, 1, promqlVector},
+	"day_of_week":                  {[]promqlType{promqlVector}, 1, promqlVector},
+	"day_of_year":                  {[]promqlType{promqlVector}, 1, promqlVector},
+	"days_in_month":                {[]promqlType{promqlVector}, 1, promqlVector},
+	"deg":                          {[]promqlType{promqlVector}, 0, promqlVector},
+	"delta":                        {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"deriv":                        {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"double_exponential_smoothing": {[]promqlType{promqlMatrix, promqlScalar, promqlScalar}, 0, promqlVector},
+	"exp":                          {[]promqlType{promqlVector}, 0, promqlVector},
+	"floor":                        {[]promqlType{promqlVector}, 0, promqlVector},
+	"histogram_avg":                {[]promqlType{promqlVector}, 0, promqlVector},
+	"histogram_count":              {[]promqlType{promqlVector}, 0, promqlVector},
+	"histogram_fraction":           {[]promqlType{promqlScalar, promqlScalar, promqlVector}, 0, promqlVector},
+	"histogram_quantile":           {[]promqlType{promqlScalar, promqlVector}, 0, promqlVector},
+	"histogram_stddev":             {[]promqlType{promqlVector}, 0, promqlVector},
+	"histogram_stdvar":             {[]promqlType{promqlVector}, 0, promqlVector},
+	"histogram_sum":                {[]promqlType{promqlVector}, 0, promqlVector},
+	"holt_winters":                 {[]promqlType{promqlMatrix, promqlScalar, promqlScalar}, 0, promqlVector},
+	"hour":                         {[]promqlType{promqlVector}, 1, promqlVector},
+	"idelta":                       {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"increase":                     {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"irate":                        {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"label_join":                   {[]promqlType{promqlVector, promqlStringValue, promqlStringValue, promqlStringValue}, -1, promqlVector},
+	"label_replace":                {[]promqlType{promqlVector, promqlStringValue, promqlStringValue, promqlStringValue, promqlStringValue}, 0, promqlVector},
+	"last_over_time":               {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"ln":                           {[]promqlType{promqlVector}, 0, promqlVector},
+	"log10":                        {[]promqlType{promqlVector}, 0, promqlVector},
+	"log2":                         {[]promqlType{promqlVector}, 0, promqlVector},
+	"mad_over_time":                {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"max_over_time":                {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"min_over_time":                {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"minute":                       {[]promqlType{promqlVector}, 1, promqlVector},
+	"month":                        {[]promqlType{promqlVector}, 1, promqlVector},
+	"pi":                           {[]promqlType{}, 0, promqlScalar},
+	"predict_linear":               {[]promqlType{promqlMatrix, promqlScalar}, 0, promqlVector},
+	"present_over_time":            {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"quantile_over_time":           {[]promqlType{promqlScalar, promqlMatrix}, 0, promqlVector},
+	"rad":                          {[]promqlType{promqlVector}, 0, promqlVector},
+	"rate":                         {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"resets":                       {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"round":                        {[]promqlType{promqlVector, promqlScalar}, 1, promqlVector},
+	"scalar":                       {[]promqlType{promqlVector}, 0, promqlScalar},
+	"sgn":                          {[]promqlType{promqlVector}, 0, promqlVector},
+	"sin":                          {[]promqlType{promqlVector}, 0, promqlVector},
+	"sinh":                         {[]promqlType{promqlVector}, 0, promqlVector},
+	"sort":                         {[]promqlType{promqlVector}, 0, promqlVector},
+	"sort_by_label":                {[]promqlType{promqlVector, promqlStringValue}, -1, promqlVector},
+	"sort_by_label_desc":           {[]promqlType{promqlVector, promqlStringValue}, -1, promqlVector},
+	"sort_desc":                    {[]promqlType{promqlVector}, 0, promqlVector},
+	"sqrt":                         {[]promqlType{promqlVector}, 0, promqlVector},
+	"stddev_over_time":             {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"stdvar_over_time":             {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"sum_over_time":                {[]promqlType{promqlMatrix}, 0, promqlVector},
+	"tan":                          {[]promqlType{promqlVector}, 0, promqlVector},
+	"tanh":                         {[]promqlType{promqlVector}, 0, promqlVector},
+	"time":                         {[]promqlType{}, 0, promqlScalar},
+	"timestamp":                    {[]promqlType{promqlVector}, 0, promqlVector},
+	"vector":                       {[]promqlType{promqlScalar}, 0, promqlVector},
+	"year":                         {[]promqlType{promqlVector}, 1, promqlVector},
+}
+
+// promqlAggregators maps each aggregation operator to the type of its
+// parameter, or "" when it takes none.
+var promqlAggregators = map[string]promqlType{
+	"avg":          "",
+	"bottomk":      promqlScalar,
+	"count":        "",
+	"count_values": promqlStringValue,
+	"group":        "",
+	"limit_ratio":  promqlScalar,
+	"limitk":       promqlScalar,
+	"max":          "",
+	"min":          "",
+	"quantile":     promqlScalar,
+	"stddev":       "",
+	"stdvar":       "",
+	"sum":          "",
+	"topk":         promqlScalar,
+}
+
+// binary operator precedences, lowest first
+var promqlBinaryOperators = map[string]int{
+	"or":     1,
+	"and":    2,
+	"unless": 2,
+	"==":     3,
+	"!=":     3,
+	"<=":     3,
+	"<":      3,
+	">=":     3,
+	">":      3,
+	"+":      4,
+	"-":      4,
+	"*":      5,
+	"/":      5,
+	"%":      5,
+	"atan2":  5,
+	"^":      6,
+}
+
+const promqlPowerPrecedence = 6
+
+var (
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+)
+
+func isComparisonOperator(op string) bool {
+	return promqlBinaryOperators[op] == 3
+}
+
+func isSetOperator(op string) bool {
+	return op == "and" || op == "or" || op == "unless"
+}
+
+type promqlTokenType int
+
+const (
+	tokenEOF promqlTokenType = iota
+	tokenIdentifier
+	tokenNumber
+	tokenDuration
+	tokenString
+	tokenOperator
+	tokenPunctuation
+)
+
+type promqlToken struct {
+	typ promqlTokenType
+	val string
+	pos int
+}
+
+func (t promqlToken) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of input"
+	case tokenNumber:
+		return "number " + strconv.Quote(t.val)
+	case tokenDuration:
+		return "duration " + strconv.Quote(t.val)
+	case tokenString:
+		return "string " + t.val
+	}
+	return strconv.Quote(t.val)
+}
+
+// promqlError is a syntax or type error at a byte offset of the expression.
+type promqlError struct {
+	pos int
+	msg string
+}
+
+type promqlLexer struct {
+	input    string
+	pos      int
+	brackets int
+}
+
+func (l *promqlLexer) errorf(pos int, format string, args ...interface{}) {
+	panic(&promqlError{pos: pos, msg: fmt.Sprintf(format, args...)})
+}
+
+func (l *promqlLexer) peekRune(offset int) rune {
+	if l.pos+offset >= len(l.input) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(l.input[l.pos+offset:])
+	return r
+}
+
+func (l *promqlLexer) next() promqlToken {
+	l.skipSpaceAndComments()
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return promqlToken{typ: tokenEOF, pos: start}
+	}
+
+	c := l.input[l.pos]
+	switch {
+	case c == '"' || c == '\'' || c == '`':
+		return l.lexString()
+	case isDigit(c) || (c == '.' && isDigit(byte(l.peekRune(1)))):
+		return l.lexNumberOrDuration()
+	case isIdentifierStart(c) || (c == ':' && l.brackets == 0):
+		for l.pos < len(l.input) && isIdentifierChar(l.input[l.pos]) {
+			l.pos++
+		}
+		return promqlToken{typ: tokenIdentifier, val: l.input[start:l.pos], pos: start}
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "=~", "!~"} {
+		if strings.HasPrefix(l.input[l.pos:], op) {
+			l.pos += len(op)
+			return promqlToken{typ: tokenOperator, val: op, pos: start}
+		}
+	}
+	l.pos++
+	switch c {
+	case '+', '-', '*', '/', '%', '^', '<', '>', '=':
+		return promqlToken{typ: tokenOperator, val: string(c), pos: start}
+	case '[':
+		l.brackets++
+	case ']':
+		l.brackets--
+	case '(', ')', '{', '}', ',', ':', '@':
+	default:
+		r, _ := utf8.DecodeRuneInString(l.input[start:])
+		l.errorf(start, "unexpected character: %q", r)
+	}
+	return promqlToken{typ: tokenPunctuation, val: string(c), pos: start}
+}
+
+func (l *promqlLexer) skipSpaceAndComments() {
+	for l.pos < len(l.input) {
+		switch c := l.input[l.pos]; {
+		case c == '#':
+			for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+				l.pos++
+			}
+		case unicode.IsSpace(rune(c)):
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (l *promqlLexer) lexString() promqlToken {
+	start := l.pos
+	quote := l.input[l.pos]
+	l.pos++
+	for {
+		if l.pos >= len(l.input) {
+			l.errorf(start, "unterminated quoted string")
+		}
+		c := l.input[l.pos]
+		l.pos++
+		if c == quote {
+			break
+		}
+		if c == '\\' && quote != '`' {
+			l.pos++
+		} else if c == '\n' && quote != '`' {
+			l.errorf(start, "unterminated quoted string")
+		}
+	}
+	return promqlToken{typ: tokenString, val: l.input[start:l.pos], pos: start}
+}
+
+func (l *promqlLexer) lexNumberOrDuration() promqlToken {
+	start := l.pos
+	if strings.HasPrefix(l.input[l.pos:], "0x") || strings.HasPrefix(l.input[l.pos:], "0X") {
+		l.pos += 2
+	}
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		if isDigit(c) || c == '.' || isLetter(c) || c == '_' {
+			l.pos++
+			continue
+		}
+		// exponent sign, e.g. 1e-3
+		if (c == '+' || c == '-') && (l.input[l.pos-1] == 'e' || l.input[l.pos-1] == 'E') && !strings.HasPrefix(l.input[start:], "0x") {
+			l.pos++
+			continue
+		}
+		break
+	}
+
+	val := l.input[start:l.pos]
+	if _, err := strconv.ParseFloat(val, 64); err == nil && !strings.Contains(val, "_") {
+		return promqlToken{typ: tokenNumber, val: val, pos: start}
+	}
+	if _, err := strconv.ParseInt(val, 0, 64); err == nil && !strings.Contains(val, "_") {
+		return promqlToken{typ: tokenNumber, val: val, pos: start}
+	}
+	if _, err := parseDuration(val); err == nil {
+		return promqlToken{typ: tokenDuration, val: val, pos: start}
+	}
+	l.errorf(start, "bad number or duration syntax: %q", val)
+	return promqlToken{}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierStart(c byte) bool {
+	return isLetter(c) || c == '_'
+}
+
+func isIdentifierChar(c byte) bool {
+	return isIdentifierStart(c) || isDigit(c) || c == ':'
+}
+
+// promqlNodeKind tells the parser which postfix modifiers an expression
+// accepts.
+type promqlNodeKind int
+
+const (
+	nodeOther promqlNodeKind = iota
+	nodeVectorSelector
+	nodeMatrixSelector
+	nodeSubquery
+)
+
+type promqlNode struct {
+	typ  promqlType
+	kind promqlNodeKind
+	// offset and at record the modifiers already applied to a selector or
+	// subquery
+	offset, at bool
+}
+
+type promqlParser struct {
+	lexer  promqlLexer
+	tokens []promqlToken
+}
+
+// checkPromQL parses expr and returns the first syntax or type error in it.
+// Errors are reported in the same line:column format as Prometheus.
+func checkPromQL(expr string) (typ promqlType, err error) {
+	p := &promqlParser{lexer: promqlLexer{input: expr}}
+	defer func() {
+		if r := recover(); r != nil {
+			perr, ok := r.(*promqlError)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("%s: parse error: %s", positionOf(expr, perr.pos), perr.msg)
+		}
+	}()
+
+	node := p.parseExpr(0)
+	if t := p.peek(); t.typ != tokenEOF {
+		p.unexpected(t, "")
+	}
+	return node.typ, nil
+}
+
+// positionOf returns the 1-based line:column of a byte offset in input.
+func positionOf(input string, pos int) string {
+	if pos > len(input) {
+		pos = len(input)
+	}
+	line := 1 + strings.Count(input[:pos], "\n")
+	column := 1 + utf8.RuneCountInString(input[strings.LastIndex(input[:pos], "\n")+1:pos])
+	return fmt.Sprintf("%d:%d", line, column)
+}
+
+func (p *promqlParser) errorf(pos int, format string, args ...interface{}) {
+	p.lexer.errorf(pos, format, args...)
+}
+
+func (p *promqlParser) unexpected(t promqlToken, context string) {
+	if context != "" {
+		p.errorf(t.pos, "unexpected %s in %s", t, context)
+	}
+	p.errorf(t.pos, "unexpected %s", t)
+}
+
+func (p *promqlParser) peek() promqlToken {
+	if len(p.tokens) == 0 {
+		p.tokens = append(p.tokens, p.lexer.next())
+	}
+	return p.tokens[0]
+}
+
+func (p *promqlParser) next() promqlToken {
+	t := p.peek()
+	p.tokens = p.tokens[1:]
+	return t
+}
+
+// is reports whether t is the punctuation, operator or keyword val. Keywords
+// are case insensitive.
+func (t promqlToken) is(val string) bool {
+	if t.typ == tokenIdentifier {
+		return strings.EqualFold(t.val, val)
+	}
+	return (t.typ == tokenPunctuation || t.typ == tokenOperator) && t.val == val
+}
+
+func (p *promqlParser) expect(val, context string) promqlToken {
+	t := p.next()
+	if !t.is(val) {
+		p.unexpected(t, context)
+	}
+	return t
+}
+
+// binaryOperator returns the binary operator t stands for, if any.
+func binaryOperator(t promqlToken) (string, bool) {
+	switch t.typ {
+	case tokenOperator:
+		if t.val == "=" || t.val == "=~" || t.val == "!~" {
+			return "", false
+		}
+		return t.val, true
+	case tokenIdentifier:
+		op := strings.ToLower(t.val)
+		_, ok := promqlBinaryOperators[op]
+		return op, ok
+	}
+	return "", false
+}
+
+func (p *promqlParser) parseExpr(minPrecedence int) promqlNode {
+	lhs := p.parseUnary()
+	for {
+		t := p.peek()
+		op, ok := binaryOperator(t)
+		if !ok || promqlBinaryOperators[op] < minPrecedence {
+			return lhs
+		}
+		p.next()
+
+		returnBool, matching := p.parseBinaryModifiers(op)
+		next := promqlBinaryOperators[op] + 1
+		if op == "^" {
+			// right associative
+			next = promqlBinaryOperators[op]
+		}
+		rhs := p.parseExpr(next)
+		lhs = p.checkBinary(t.pos, op, lhs, rhs, returnBool, matching)
+	}
+}
+
+func (p *promqlParser) parseBinaryModifiers(op string) (returnBool, matching bool) {
+	if t := p.peek(); t.is("bool") {
+		p.next()
+		if !isComparisonOperator(op) {
+			p.errorf(t.pos, "bool modifier can only be used on comparison operators")
+		}
+		returnBool = true
+	}
+
+	if t := p.peek(); t.is("on") || t.is("ignoring") {
+		p.next()
+		p.parseLabelList(strings.ToLower(t.val))
+		matching = true
+
+		if t := p.peek(); t.is("group_left") || t.is("group_right") {
+			p.next()
+			if isSetOperator(op) {
+				p.errorf(t.pos, "no grouping allowed for %q operation", op)
+			}
+			if p.peek().is("(") {
+				p.parseLabelList(strings.ToLower(t.val))
+			}
+		}
+	}
+	return returnBool, matching
+}
+
+func (p *promqlParser) checkBinary(pos int, op string, lhs, rhs promqlNode, returnBool, matching bool) promqlNode {
+	for _, operand := range []promqlNode{lhs, rhs} {
+		if operand.typ != promqlScalar && operand.typ != promqlVector {
+			p.errorf(pos, "binary expression must contain only scalar and instant vector types")
+		}
+	}
+	scalars := lhs.typ == promqlScalar && rhs.typ == promqlScalar
+	if isSetOperator(op) && (lhs.typ == promqlScalar || rhs.typ == promqlScalar) {
+		p.errorf(pos, "set operator %q not allowed in binary scalar expression", op)
+	}
+	if isComparisonOperator(op) && scalars && !returnBool {
+		p.errorf(pos, "comparisons between scalars must use BOOL modifier")
+	}
+	if matching && (lhs.typ != promqlVector || rhs.typ != promqlVector) {
+		p.errorf(pos, "vector matching only allowed between instant vectors")
+	}
+	if scalars {
+		return promqlNode{typ: promqlScalar}
+	}
+	return promqlNode{typ: promqlVector}
+}
+
+func (p *promqlParser) parseUnary() promqlNode {
+	if t := p.peek(); t.is("+") || t.is("-") {
+		p.next()
+		// unary operators bind weaker than ^, so -2^2 is -(2^2)
+		operand := p.parseExpr(promqlPowerPrecedence)
+		if operand.typ != promqlScalar && operand.typ != promqlVector {
+			p.errorf(t.pos, "unary expression only allowed on expressions of type scalar or instant vector, got %q", operand.typ)
+		}
+		return promqlNode{typ: operand.typ}
+	}
+	return p.parsePostfix(p.parsePrimary())
+}
+
+func (p *promqlParser) parsePrimary() promqlNode {
+	t := p.next()
+	switch t.typ {
+	case tokenNumber:
+		return promqlNode{typ: promqlScalar}
+	case tokenString:
+		p.unquote(t)
+		return promqlNode{typ: promqlStringValue}
+	case tokenIdentifier:
+		return p.parseIdentifier(t)
+	}
+
+	switch {
+	case t.is("("):
+		inner := p.parseExpr(0)
+		p.expect(")", "parenthesized expression")
+		return promqlNode{typ: inner.typ}
+	case t.is("{"):
+		p.parseMatchers(t, false)
+		return promqlNode{typ: promqlVector, kind: nodeVectorSelector}
+	}
+	p.unexpected(t, "")
+	return promqlNode{}
+}
+
+func (p *promqlParser) parseIdentifier(t promqlToken) promqlNode {
+	lower := strings.ToLower(t.val)
+	if lower == "inf" || lower == "nan" {
+		return promqlNode{typ: promqlScalar}
+	}
+	if param, ok := promqlAggregators[lower]; ok {
+		return p.parseAggregation(t, param)
+	}
+	if _, ok := promqlBinaryOperators[lower]; ok {
+		p.unexpected(t, "")
+	}
+	switch lower {
+	case "by", "without", "on", "ignoring", "group_left", "group_right", "bool", "offset":
+		p.unexpected(t, "")
+	}
+
+	if p.peek().is("(") {
+		return p.parseCall(t)
+	}
+
+	if p.peek().is("{") {
+		p.parseMatchers(p.next(), true)
+	}
+	return promqlNode{typ: promqlVector, kind: nodeVectorSelector}
+}
+
+// parseCall parses a function call. Prometheus keeps adding functions that
+// APS may support before this checker knows them, so the calls of unknown
+// functions are opaque: their arguments must parse, but their number and types
+// aren't checked, and the call is assumed to return an instant vector.
+func (p *promqlParser) parseCall(name promqlToken) promqlNode {
+	fn, known := promqlFunctions[name.val]
+
+	p.expect("(", "function call")
+	var args []promqlNode
+	var positions []int
+	for !p.peek().is(")") {
+		positions = append(positions, p.peek().pos)
+		args = append(args, p.parseExpr(0))
+		if !p.peek().is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect(")", "function call")
+	if !known {
+		return promqlNode{typ: promqlVector}
+	}
+
+	min, max := len(fn.args), len(fn.args)
+	switch {
+	case fn.variadic < 0:
+		min, max = min-1, -1
+	case fn.variadic > 0:
+		min -= fn.variadic
+	}
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		expected := strconv.Itoa(min)
+		if max < 0 {
+			expected = "at least " + expected
+		} else if max != min {
+			expected = fmt.Sprintf("%d to %d", min, max)
+		}
+		p.errorf(name.pos, "expected %s argument(s) in call to %q, got %d", expected, name.val, len(args))
+	}
+
+	for i, arg := range args {
+		want := fn.args[len(fn.args)-1]
+		if i < len(fn.args) {
+			want = fn.args[i]
+		}
+		if arg.typ != want {
+			p.errorf(positions[i], "expected type %s in call to function %q, got %s", want, name.val, arg.typ)
+		}
+	}
+	return promqlNode{typ: fn.returnType}
+}
+
+func (p *promqlParser) parseAggregation(name promqlToken, param promqlType) promqlNode {
+	grouped := false
+	if t := p.peek(); t.is("by") || t.is("without") {
+		p.next()
+		p.parseLabelList(strings.ToLower(t.val))
+		grouped = true
+	}
+
+	p.expect("(", "aggregation")
+	var args []promqlNode
+	var positions []int
+	for !p.peek().is(")") {
+		positions = append(positions, p.peek().pos)
+		args = append(args, p.parseExpr(0))
+		if !p.peek().is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect(")", "aggregation")
+
+	if t := p.peek(); t.is("by") || t.is("without") {
+		if grouped {
+			p.errorf(t.pos, "aggregation must only contain one grouping clause")
+		}
+		p.next()
+		p.parseLabelList(strings.ToLower(t.val))
+	}
+
+	want := 1
+	if param != "" {
+		want = 2
+	}
+	if len(args) != want {
+		p.errorf(name.pos, "wrong number of arguments for aggregate expression provided, expected %d, got %d", want, len(args))
+	}
+	if param != "" && args[0].typ != param {
+		p.errorf(positions[0], "expected type %s in aggregation parameter, got %s", param, args[0].typ)
+	}
+	if expr := args[len(args)-1]; expr.typ != promqlVector {
+		p.errorf(positions[len(args)-1], "expected type %s in aggregation expression, got %s", promqlVector, expr.typ)
+	}
+	return promqlNode{typ: promqlVector}
+}
+
+// parseLabelList parses the label list of a grouping or vector matching
+// clause, e.g. by (job, instance).
+func (p *promqlParser) parseLabelList(clause string) {
+	context := fmt.Sprintf("%s clause", clause)
+	p.expect("(", context)
+	for !p.peek().is(")") {
+		t := p.next()
+		switch t.typ {
+		case tokenIdentifier:
+			if !labelNameRE.MatchString(t.val) {
+				p.errorf(t.pos, "invalid label name %q in %s", t.val, context)
+			}
+		case tokenString:
+			p.unquote(t)
+		default:
+			p.unexpected(t, context)
+		}
+		if !p.peek().is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect(")", context)
+}
+
+// parseMatchers parses the label matchers of a vector selector after the
+// opening brace. hasName is set when the selector starts with a metric name.
+func (p *promqlParser) parseMatchers(open promqlToken, hasName bool) {
+	nonEmpty := hasName
+	for !p.peek().is("}") {
+		t := p.next()
+		var label string
+		switch t.typ {
+		case tokenIdentifier:
+			if !labelNameRE.MatchString(t.val) {
+				p.errorf(t.pos, "invalid label name %q in label matching", t.val)
+			}
+			label = t.val
+		case tokenString:
+			label = p.unquote(t)
+			if next := p.peek(); next.is(",") || next.is("}") {
+				// a lone quoted string is the metric name
+				if hasName {
+					p.errorf(t.pos, "metric name must not be set twice: %s", t.val)
+				}
+				hasName, nonEmpty = true, true
+				if next.is(",") {
+					p.next()
+				}
+				continue
+			}
+		default:
+			p.unexpected(t, "label matching")
+		}
+
+		op := p.next()
+		if op.typ != tokenOperator || (op.val != "=" && op.val != "!=" && op.val != "=~" && op.val != "!~") {
+			p.unexpected(op, "label matching, expected one of \"=\", \"!=\", \"=~\" or \"!~\"")
+		}
+		value := p.next()
+		if value.typ != tokenString {
+			p.unexpected(value, "label matching, expected string")
+		}
+		v := p.unquote(value)
+
+		matchesEmpty := false
+		switch op.val {
+		case "=":
+			matchesEmpty = v == ""
+		case "!=":
+			matchesEmpty = v != ""
+		case "=~", "!~":
+			re, err := regexp.Compile("^(?:" + v + ")$")
+			if err != nil {
+				p.errorf(value.pos, "invalid regular expression in label matcher: %v", err)
+			}
+			matchesEmpty = re.MatchString("") == (op.val == "=~")
+		}
+		if label == "__name__" {
+			if hasName {
+				p.errorf(t.pos, "metric name must not be set twice")
+			}
+		}
+		if !matchesEmpty {
+			nonEmpty = true
+		}
+
+		if !p.peek().is(",") {
+			break
+		}
+		p.next()
+	}
+	p.expect("}", "label matching")
+
+	if !nonEmpty {
+		p.errorf(open.pos, "vector selector must contain at least one non-empty matcher")
+	}
+}
+
+func (p *promqlParser) parsePostfix(node promqlNode) promqlNode {
+	for {
+		t := p.peek()
+		switch {
+		case t.is("["):
+			node = p.parseRange(node)
+		case t.is("offset"):
+			p.next()
+			p.checkModifierTarget(t, node, "offset")
+			if node.offset {
+				p.errorf(t.pos, "offset may not be set multiple times")
+			}
+			if p.peek().is("-") || p.peek().is("+") {
+				p.next()
+			}
+			if d := p.next(); d.typ != tokenDuration && d.typ != tokenNumber {
+				p.unexpected(d, "offset, expected duration")
+			}
+			node.offset = true
+		case t.is("@"):
+			p.next()
+			p.checkModifierTarget(t, node, "@")
+			if node.at {
+				p.errorf(t.pos, "@ <timestamp> may not be set multiple times")
+			}
+			p.parseAtTimestamp()
+			node.at = true
+		default:
+			return node
+		}
+	}
+}
+
+func (p *promqlParser) checkModifierTarget(t promqlToken, node promqlNode, modifier string) {
+	if node.kind == nodeOther {
+		p.errorf(t.pos, "%s modifier must be preceded by an instant vector selector or range vector selector or a subquery", modifier)
+	}
+}
+
+func (p *promqlParser) parseAtTimestamp() {
+	t := p.next()
+	if t.is("start") || t.is("end") {
+		p.expect("(", "@ modifier")
+		p.expect(")", "@ modifier")
+		return
+	}
+	if t.is("-") || t.is("+") {
+		t = p.next()
+	}
+	if t.typ != tokenNumber {
+		p.unexpected(t, "@ modifier, expected timestamp")
+	}
+}
+
+func (p *promqlParser) parseRange(node promqlNode) promqlNode {
+	open := p.next()
+	if d := p.next(); d.typ != tokenDuration && d.typ != tokenNumber {
+		p.unexpected(d, "range, expected duration")
+	}
+
+	if p.peek().is("]") {
+		p.next()
+		if node.kind != nodeVectorSelector {
+			p.errorf(open.pos, "ranges only allowed for vector selectors")
+		}
+		if node.offset || node.at {
+			p.errorf(open.pos, "no offset or @ modifiers allowed before range")
+		}
+		return promqlNode{typ: promqlMatrix, kind: nodeMatrixSelector}
+	}
+
+	p.expect(":", "subquery or range")
+	if t := p.peek(); !t.is("]") {
+		if d := p.next(); d.typ != tokenDuration && d.typ != tokenNumber {
+			p.unexpected(d, "subquery, expected duration")
+		}
+	}
+	p.expect("]", "subquery")
+	if node.typ != promqlVector {
+		p.errorf(open.pos, "subquery is only allowed on instant vector, got %s", node.typ)
+	}
+	return promqlNode{typ: promqlMatrix, kind: nodeSubquery}
+}
+
+// unquote returns the value of a string token.
+func (p *promqlParser) unquote(t promqlToken) string {
+	s := t.val
+	switch s[0] {
+	case '`':
+		return s[1 : len(s)-1]
+	case '\'':
+		// requote as a double quoted string so strconv can unquote it
+		var b strings.Builder
+		b.WriteByte('"')
+		for i := 1; i < len(s)-1; i++ {
+			switch {
+			case s[i] == '\\' && s[i+1] == '\'':
+				b.WriteByte('\'')
+				i++
+			case s[i] == '\\':
+				b.WriteString(s[i : i+2])
+				i++
+			case s[i] == '"':
+				b.WriteString(`\"`)
+			default:
+				b.WriteByte(s[i])
+			}
+		}
+		b.WriteByte('"')
+		s = b.String()
+	}
+	v, err := strconv.Unquote(s)
+	if err != nil {
+		p.errorf(t.pos, "invalid string %s: %v", t.val, err)
+	}
+	return v
+}
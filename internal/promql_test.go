@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPromQL_valid(t *testing.T) {
+	testCases := []struct {
+		expr string
+		typ  promqlType
+	}{
+		{`up`, promqlVector},
+		{`1`, promqlScalar},
+		{`-1.5e3`, promqlScalar},
+		{`0x1F`, promqlScalar},
+		{`Inf`, promqlScalar},
+		{`"text"`, promqlStringValue},
+		{`http_requests_total{job="api", code=~"5.."}`, promqlVector},
+		{`{__name__=~"job:.*", job!=""}`, promqlVector},
+		{`{"metric.with.dots", env='prod'}`, promqlVector},
+		{`job:request_latency_seconds:mean5m{job="myjob"} > 0.5`, promqlVector},
+		{`rate(http_requests_total[5m])`, promqlVector},
+		{`rate(http_requests_total[5m] offset -1h @ start())`, promqlVector},
+		{`http_requests_total offset 5m @ 1609746000`, promqlVector},
+		{`max_over_time(deriv(rate(distance_covered_total[5s])[30s:5s])[10m:])`, promqlVector},
+		{`sum by (job) (rate(http_requests_total[5m]))`, promqlVector},
+		{`sum(rate(http_requests_total[5m])) without (instance,)`, promqlVector},
+		{`topk(3, sum by (app) (rate(cpu[5m])))`, promqlVector},
+		{`count_values("version", build_version)`, promqlVector},
+		{`histogram_quantile(0.9, sum by (le) (rate(request_duration_seconds_bucket[10m])))`, promqlVector},
+		{`method_code:errors:rate5m / ignoring(code) group_left method:requests:rate5m`, promqlVector},
+		{`a * on(instance) group_right(job) b`, promqlVector},
+		{`up == bool 1`, promqlVector},
+		{`1 < bool 2`, promqlScalar},
+		{`a and b or c unless d`, promqlVector},
+		{`2 ^ 3 ^ 2 - 1`, promqlScalar},
+		{`-up`, promqlVector},
+		{`label_replace(up, "foo", "$1", "job", "(.*)")`, promqlVector},
+		{`label_join(up, "foo", ",", "a", "b", "c")`, promqlVector},
+		{`round(up)`, promqlVector},
+		{`round(up, 0.5)`, promqlVector},
+		{`hour()`, promqlVector},
+		{`time() - scalar(up)`, promqlScalar},
+		{"# a comment\nabsent(up{job=`raw`})", promqlVector},
+		{`SUM(up) BY (job)`, promqlVector},
+		{`info(rate(http_server_requests_total[2m]), {k8s_cluster_name=~".+"})`, promqlVector},
+		{`sum by (job) (ts_of_max_over_time(up[1h]))`, promqlVector},
+		{`up{quote='it\'s "here"'}`, promqlVector},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			typ, err := checkPromQL(tc.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.typ, typ)
+		})
+	}
+}
+
+func TestCheckPromQL_invalid(t *testing.T) {
+	testCases := []struct {
+		expr    string
+		message string
+	}{
+		{``, `1:1: parse error: unexpected end of input`},
+		{`sum(rate(x[5m])`, `1:16: parse error: unexpected end of input in aggregation`},
+		{`up{job="api"`, `1:13: parse error: unexpected end of input in label matching`},
+		{`up{job=api}`, `1:8: parse error: unexpected "api" in label matching, expected string`},
+		{`up{job~"api"}`, `1:7: parse error: unexpected character: '~'`},
+		{`up{job=~"("}`, `1:9: parse error: invalid regular expression in label matcher`},
+		{`{job=""}`, `1:1: parse error: vector selector must contain at least one non-empty matcher`},
+		{`up{__name__="up"}`, `metric name must not be set twice`},
+		{`rate(up)`, `1:6: parse error: expected type range vector in call to function "rate", got instant vector`},
+		{`rate(up[5m], 1)`, `expected 1 argument(s) in call to "rate", got 2`},
+		{`label_join(up, "a")`, `expected at least 3 argument(s) in call to "label_join", got 2`},
+		{`round()`, `expected 1 to 2 argument(s) in call to "round", got 0`},
+		{`info(up{job=api})`, `1:13: parse error: unexpected "api" in label matching, expected string`},
+		{`info(up[5m]`, `1:12: parse error: unexpected end of input in function call`},
+		{`topk(up)`, `wrong number of arguments for aggregate expression provided, expected 2, got 1`},
+		{`topk("3", up)`, `expected type scalar in aggregation parameter, got string`},
+		{`sum by (job) (up) by (job)`, `aggregation must only contain one grouping clause`},
+		{`sum(up[5m])`, `expected type instant vector in aggregation expression, got range vector`},
+		{`sum by (a:b) (up)`, `invalid label name "a:b" in by clause`},
+		{`up[5m] + 1`, `binary expression must contain only scalar and instant vector types`},
+		{`1 and up`, `set operator "and" not allowed in binary scalar expression`},
+		{`1 > 2`, `comparisons between scalars must use BOOL modifier`},
+		{`up + bool up`, `bool modifier can only be used on comparison operators`},
+		{`a and on(x) group_left b`, `no grouping allowed for "and" operation`},
+		{`1 + on(x) up`, `vector matching only allowed between instant vectors`},
+		{`rate(up[5m])[5m]`, `ranges only allowed for vector selectors`},
+		{`up offset 5m [5m]`, `no offset or @ modifiers allowed before range`},
+		{`rate(up[5m])[1h:1m:]`, `unexpected ":" in subquery`},
+		{`up[5m][1h:]`, `subquery is only allowed on instant vector, got range vector`},
+		{`sum(up) offset 5m`, `offset modifier must be preceded by an instant vector selector`},
+		{`up offset 5m offset 1m`, `offset may not be set multiple times`},
+		{`up @ 1 @ 2`, `@ <timestamp> may not be set multiple times`},
+		{`up[5x]`, `bad number or duration syntax: "5x"`},
+		{`up[1.5m]`, `bad number or duration syntax: "1.5m"`},
+		{`-rate(up[5m])[5m:]`, `unary expression only allowed on expressions of type scalar or instant vector`},
+		{`up{job="a"} 1`, `unexpected number "1"`},
+		{"up\n  and\n  on", `3:5: parse error: unexpected end of input in on clause`},
+		{`up{job="unterminated}`, `unterminated quoted string`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := checkPromQL(tc.expr)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.message)
+			}
+		})
+	}
+}
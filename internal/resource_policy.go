@@ -0,0 +1,362 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Like the workspace configuration, workspace resource policies are newer
+// than the aws-sdk-go v1 prometheusservice client.
+
+const (
+	WorkspacePolicyStatusCodeCreating = "CREATING"
+	WorkspacePolicyStatusCodeActive   = "ACTIVE"
+	WorkspacePolicyStatusCodeUpdating = "UPDATING"
+	WorkspacePolicyStatusCodeDeleting = "DELETING"
+)
+
+type DescribeResourcePolicyInput struct {
+	_ struct{} `type:"structure" nopayload:"true"`
+
+	WorkspaceId *string `location:"uri" locationName:"workspaceId" min:"1" type:"string" required:"true"`
+}
+
+// Validate checks the required parameters of the request.
+func (s *DescribeResourcePolicyInput) Validate() error {
+	return validateWorkspaceID("DescribeResourcePolicyInput", s.WorkspaceId)
+}
+
+type DescribeResourcePolicyOutput struct {
+	_ struct{} `type:"structure"`
+
+	PolicyDocument *string `locationName:"policyDocument" min:"1" type:"string" required:"true"`
+	PolicyStatus   *string `locationName:"policyStatus" type:"string" required:"true"`
+	RevisionId     *string `locationName:"revisionId" type:"string" required:"true"`
+}
+
+// PutResourcePolicyInput creates or replaces the resource policy of a
+// workspace. When RevisionId is set the call fails with a ConflictException
+// unless it matches the revision of the current policy.
+type PutResourcePolicyInput struct {
+	_ struct{} `type:"structure"`
+
+	ClientToken    *string `locationName:"clientToken" min:"1" type:"string" idempotencyToken:"true"`
+	PolicyDocument *string `locationName:"policyDocument" min:"1" type:"string" required:"true"`
+	RevisionId     *string `locationName:"revisionId" type:"string"`
+	WorkspaceId    *string `location:"uri" locationName:"workspaceId" min:"1" type:"string" required:"true"`
+}
+
+// Validate checks the required parameters of the request.
+func (s *PutResourcePolicyInput) Validate() error {
+	if err := validateWorkspaceID("PutResourcePolicyInput", s.WorkspaceId); err != nil {
+		return err
+	}
+	invalidParams := request.ErrInvalidParams{Context: "PutResourcePolicyInput"}
+	if s.PolicyDocument == nil {
+		invalidParams.Add(request.NewErrParamRequired("PolicyDocument"))
+	} else if len(*s.PolicyDocument) < 1 {
+		invalidParams.Add(request.NewErrParamMinLen("PolicyDocument", 1))
+	}
+	if invalidParams.Len() > 0 {
+		return invalidParams
+	}
+	return nil
+}
+
+type PutResourcePolicyOutput struct {
+	_ struct{} `type:"structure"`
+
+	PolicyStatus *string `locationName:"policyStatus" type:"string" required:"true"`
+	RevisionId   *string `locationName:"revisionId" type:"string" required:"true"`
+}
+
+// DeleteResourcePolicyInput deletes the resource policy of a workspace. Like
+// PutResourcePolicyInput, a RevisionId must match the current policy.
+type DeleteResourcePolicyInput struct {
+	_ struct{} `type:"structure" nopayload:"true"`
+
+	ClientToken *string `location:"querystring" locationName:"clientToken" min:"1" type:"string" idempotencyToken:"true"`
+	RevisionId  *string `location:"querystring" locationName:"revisionId" type:"string"`
+	WorkspaceId *string `location:"uri" locationName:"workspaceId" min:"1" type:"string" required:"true"`
+}
+
+// Validate checks the required parameters of the request.
+func (s *DeleteResourcePolicyInput) Validate() error {
+	return validateWorkspaceID("DeleteResourcePolicyInput", s.WorkspaceId)
+}
+
+type DeleteResourcePolicyOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+// DescribeResourcePolicy returns the resource policy of a workspace and its
+// revision.
+func (c *Client) DescribeResourcePolicy(input *DescribeResourcePolicyInput) (*DescribeResourcePolicyOutput, error) {
+	op := &request.Operation{
+		Name:       "DescribeResourcePolicy",
+		HTTPMethod: "GET",
+		HTTPPath:   "/workspaces/{workspaceId}/policy",
+	}
+	if input == nil {
+		input = &DescribeResourcePolicyInput{}
+	}
+
+	output := &DescribeResourcePolicyOutput{}
+	return output, c.NewRequest(op, input, output).Send()
+}
+
+// PutResourcePolicy creates or replaces the resource policy of a workspace.
+// The policy is applied asynchronously.
+func (c *Client) PutResourcePolicy(input *PutResourcePolicyInput) (*PutResourcePolicyOutput, error) {
+	op := &request.Operation{
+		Name:       "PutResourcePolicy",
+		HTTPMethod: "PUT",
+		HTTPPath:   "/workspaces/{workspaceId}/policy",
+	}
+	if input == nil {
+		input = &PutResourcePolicyInput{}
+	}
+
+	output := &PutResourcePolicyOutput{}
+	return output, c.NewRequest(op, input, output).Send()
+}
+
+// DeleteResourcePolicy deletes the resource policy of a workspace. The policy
+// is removed asynchronously.
+func (c *Client) DeleteResourcePolicy(input *DeleteResourcePolicyInput) (*DeleteResourcePolicyOutput, error) {
+	op := &request.Operation{
+		Name:       "DeleteResourcePolicy",
+		HTTPMethod: "DELETE",
+		HTTPPath:   "/workspaces/{workspaceId}/policy",
+	}
+	if input == nil {
+		input = &DeleteResourcePolicyInput{}
+	}
+
+	output := &DeleteResourcePolicyOutput{}
+	return output, c.NewRequest(op, input, output).Send()
+}
+
+var (
+	policyElements    = []string{"Version", "Id", "Statement"}
+	statementElements = []string{"Sid", "Effect", "Principal", "NotPrincipal", "Action", "NotAction", "Resource", "NotResource", "Condition"}
+)
+
+// ValidateResourcePolicy checks that policy is a JSON policy document that
+// grants or denies access to Amazon Managed Service for Prometheus actions.
+func ValidateResourcePolicy(policy string) error {
+	var value interface{}
+	if err := json.Unmarshal([]byte(policy), &value); err != nil {
+		return fmt.Errorf("policy is not valid JSON: %w", err)
+	}
+	document, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("policy must be a JSON object")
+	}
+	if err := validateElements(document, policyElements); err != nil {
+		return err
+	}
+
+	if version, ok := document["Version"]; ok && version != "2012-10-17" && version != "2008-10-17" {
+		return fmt.Errorf("invalid Version %v, must be 2012-10-17 or 2008-10-17", version)
+	}
+
+	var statements []interface{}
+	switch s := document["Statement"].(type) {
+	case nil:
+		return errors.New("missing required element Statement")
+	case map[string]interface{}:
+		statements = []interface{}{s}
+	case []interface{}:
+		statements = s
+	default:
+		return errors.New("Statement must be an object or a list of objects")
+	}
+	if len(statements) == 0 {
+		return errors.New("Statement must not be empty")
+	}
+
+	for i, s := range statements {
+		statement, ok := s.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Statement[%d]: must be an object", i)
+		}
+		if err := validateStatement(statement); err != nil {
+			return fmt.Errorf("Statement[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateStatement(statement map[string]interface{}) error {
+	if err := validateElements(statement, statementElements); err != nil {
+		return err
+	}
+
+	if effect := statement["Effect"]; effect != "Allow" && effect != "Deny" {
+		return fmt.Errorf("invalid Effect %v, must be Allow or Deny", effect)
+	}
+	if _, ok := statement["Sid"].(string); !ok && statement["Sid"] != nil {
+		return errors.New("Sid must be a string")
+	}
+
+	if err := exactlyOneOf(statement, "Principal", "NotPrincipal"); err != nil {
+		return err
+	}
+	for _, element := range []string{"Principal", "NotPrincipal"} {
+		switch p := statement[element].(type) {
+		case nil:
+		case string:
+			if p != "*" {
+				return fmt.Errorf("%s must be \"*\" or an object", element)
+			}
+		case map[string]interface{}:
+			for principalType, principals := range p {
+				if _, err := stringList(principals); err != nil {
+					return fmt.Errorf("%s.%s: %w", element, principalType, err)
+				}
+			}
+		default:
+			return fmt.Errorf("%s must be \"*\" or an object", element)
+		}
+	}
+
+	if err := exactlyOneOf(statement, "Action", "NotAction"); err != nil {
+		return err
+	}
+	for _, element := range []string{"Action", "NotAction"} {
+		actions, err := stringList(statement[element])
+		if err != nil {
+			return fmt.Errorf("%s: %w", element, err)
+		}
+		for _, action := range actions {
+			if action != "*" && !strings.HasPrefix(strings.ToLower(action), "aps:") {
+				return fmt.Errorf("%s: %q is not an Amazon Managed Service for Prometheus action", element, action)
+			}
+		}
+	}
+
+	if _, ok := statement["Resource"]; ok {
+		if _, ok := statement["NotResource"]; ok {
+			return errors.New("only one of Resource and NotResource may be set")
+		}
+	}
+	for _, element := range []string{"Resource", "NotResource"} {
+		if _, err := stringList(statement[element]); err != nil {
+			return fmt.Errorf("%s: %w", element, err)
+		}
+	}
+
+	if condition, ok := statement["Condition"]; ok {
+		if _, ok := condition.(map[string]interface{}); !ok {
+			return errors.New("Condition must be an object")
+		}
+	}
+	return nil
+}
+
+func validateElements(object map[string]interface{}, allowed []string) error {
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		known := false
+		for _, element := range allowed {
+			known = known || name == element
+		}
+		if !known {
+			return fmt.Errorf("unknown element %s", name)
+		}
+	}
+	return nil
+}
+
+func exactlyOneOf(statement map[string]interface{}, a, b string) error {
+	_, hasA := statement[a]
+	_, hasB := statement[b]
+	if hasA == hasB {
+		return fmt.Errorf("exactly one of %s and %s must be set", a, b)
+	}
+	return nil
+}
+
+// stringList checks that value is a string or a non-empty list of strings.
+// A missing value is an empty list.
+func stringList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, errors.New("must not be empty")
+		}
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.New("must be a string or a list of strings")
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, errors.New("must be a string or a list of strings")
+}
+
+// PolicyDocumentsEqual reports whether a and b are the same policy. Key order
+// and formatting are ignored, as are the order of string lists and whether a
+// single value is written as a one-element list. Documents that don't parse
+// are only equal if they are identical.
+func PolicyDocumentsEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var valueA, valueB interface{}
+	if err := json.Unmarshal([]byte(a), &valueA); err != nil {
+		return false
+	}
+	if err := json.Unmarshal([]byte(b), &valueB); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(canonicalPolicyValue(valueA), canonicalPolicyValue(valueB))
+}
+
+func canonicalPolicyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		canonical := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			canonical[key] = canonicalPolicyValue(item)
+		}
+		return canonical
+	case []interface{}:
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			items = append(items, canonicalPolicyValue(item))
+		}
+		if values, err := stringList(items); err == nil && len(values) > 0 {
+			sort.Strings(values)
+			items = items[:0]
+			for i, s := range values {
+				if i == 0 || s != values[i-1] {
+					items = append(items, s)
+				}
+			}
+		}
+		if len(items) == 1 {
+			return items[0]
+		}
+		return items
+	}
+	return value
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testResourcePolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "AllowRemoteWrite",
+      "Effect": "Allow",
+      "Principal": {"AWS": ["arn:aws:iam::123456789012:root", "arn:aws:iam::210987654321:root"]},
+      "Action": ["aps:RemoteWrite", "aps:QueryMetrics"],
+      "Resource": "arn:aws:aps:us-west-2:111122223333:workspace/ws-1",
+      "Condition": {"StringEquals": {"aws:SourceVpce": "vpce-1a2b3c4d"}}
+    }
+  ]
+}`
+
+func TestClient_PutResourcePolicy(t *testing.T) {
+	var body map[string]interface{}
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/workspaces/ws-1/policy", r.URL.Path)
+		data, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &body))
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"policyStatus": "UPDATING", "revisionId": "2"}`))
+	})
+
+	out, err := client.PutResourcePolicy(&PutResourcePolicyInput{
+		WorkspaceId:    aws.String("ws-1"),
+		PolicyDocument: aws.String(testResourcePolicy),
+		RevisionId:     aws.String("1"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, WorkspacePolicyStatusCodeUpdating, aws.StringValue(out.PolicyStatus))
+	assert.Equal(t, "2", aws.StringValue(out.RevisionId))
+
+	assert.NotEmpty(t, body["clientToken"])
+	assert.Equal(t, testResourcePolicy, body["policyDocument"])
+	assert.Equal(t, "1", body["revisionId"])
+}
+
+func TestClient_DeleteResourcePolicy(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, "/workspaces/ws-1/policy", r.URL.Path)
+		assert.Equal(t, "3", r.URL.Query().Get("revisionId"))
+
+		w.Header().Set("X-Amzn-Errortype", "ConflictException")
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"message": "revision mismatch"}`))
+	})
+
+	_, err := client.DeleteResourcePolicy(&DeleteResourcePolicyInput{
+		WorkspaceId: aws.String("ws-1"),
+		RevisionId:  aws.String("3"),
+	})
+	if assert.Error(t, err) {
+		assert.Equal(t, "ConflictException", err.(awserr.Error).Code())
+	}
+}
+
+func TestValidateResourcePolicy(t *testing.T) {
+	assert.NoError(t, ValidateResourcePolicy(testResourcePolicy))
+	assert.NoError(t, ValidateResourcePolicy(`{"Statement": {"Effect": "Deny", "NotPrincipal": "*", "NotAction": "aps:DeleteWorkspace"}}`))
+}
+
+func TestValidateResourcePolicy_invalid(t *testing.T) {
+	statement := func(s string) string {
+		return `{"Version": "2012-10-17", "Statement": [` + s + `]}`
+	}
+
+	testCases := []struct {
+		name    string
+		policy  string
+		message string
+	}{
+		{"malformed json", `{"Statement": [`, "policy is not valid JSON: unexpected end of JSON input"},
+		{"not an object", `[]`, "policy must be a JSON object"},
+		{"unknown element", `{"Statements": []}`, "unknown element Statements"},
+		{"bad version", `{"Version": "2020-01-01", "Statement": []}`, "invalid Version 2020-01-01, must be 2012-10-17 or 2008-10-17"},
+		{"missing statement", `{"Version": "2012-10-17"}`, "missing required element Statement"},
+		{"empty statement", statement(``), "Statement must not be empty"},
+		{"statement not an object", statement(`"Allow"`), "Statement[0]: must be an object"},
+		{"bad effect", statement(`{"Effect": "allow", "Principal": "*", "Action": "aps:*"}`),
+			"Statement[0]: invalid Effect allow, must be Allow or Deny"},
+		{"missing principal", statement(`{"Effect": "Allow", "Action": "aps:*"}`),
+			"Statement[0]: exactly one of Principal and NotPrincipal must be set"},
+		{"bad principal", statement(`{"Effect": "Allow", "Principal": "123456789012", "Action": "aps:*"}`),
+			`Statement[0]: Principal must be "*" or an object`},
+		{"empty principal list", statement(`{"Effect": "Allow", "Principal": {"AWS": []}, "Action": "aps:*"}`),
+			"Statement[0]: Principal.AWS: must not be empty"},
+		{"action and not action", statement(`{"Effect": "Allow", "Principal": "*", "Action": "aps:*", "NotAction": "aps:DeleteWorkspace"}`),
+			"Statement[0]: exactly one of Action and NotAction must be set"},
+		{"foreign action", `{"Statement": [{"Effect": "Allow", "Principal": "*", "Action": "aps:*"}, {"Effect": "Allow", "Principal": "*", "Action": ["aps:*", "s3:GetObject"]}]}`,
+			`Statement[1]: Action: "s3:GetObject" is not an Amazon Managed Service for Prometheus action`},
+		{"resource and not resource", statement(`{"Effect": "Allow", "Principal": "*", "Action": "aps:*", "Resource": "*", "NotResource": "*"}`),
+			"Statement[0]: only one of Resource and NotResource may be set"},
+		{"bad condition", statement(`{"Effect": "Allow", "Principal": "*", "Action": "aps:*", "Condition": []}`),
+			"Statement[0]: Condition must be an object"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.EqualError(t, ValidateResourcePolicy(tc.policy), tc.message)
+		})
+	}
+}
+
+func TestPolicyDocumentsEqual(t *testing.T) {
+	reformatted := `{"Statement": {"Action": ["aps:QueryMetrics", "aps:RemoteWrite", "aps:RemoteWrite"],
+		"Condition": {"StringEquals": {"aws:SourceVpce": ["vpce-1a2b3c4d"]}},
+		"Effect": "Allow",
+		"Principal": {"AWS": ["arn:aws:iam::210987654321:root", "arn:aws:iam::123456789012:root"]},
+		"Resource": ["arn:aws:aps:us-west-2:111122223333:workspace/ws-1"],
+		"Sid": "AllowRemoteWrite"}, "Version": "2012-10-17"}`
+
+	testCases := []struct {
+		name  string
+		a, b  string
+		equal bool
+	}{
+		{"identical", testResourcePolicy, testResourcePolicy, true},
+		{"reformatted", testResourcePolicy, reformatted, true},
+		{"changed action", testResourcePolicy, strings.Replace(testResourcePolicy, "aps:QueryMetrics", "aps:GetSeries", 1), false},
+		{"changed effect", testResourcePolicy, strings.Replace(testResourcePolicy, `"Allow"`, `"Deny"`, 1), false},
+		{"reordered statements",
+			`{"Statement": [{"Sid": "a", "Effect": "Allow"}, {"Sid": "b", "Effect": "Allow"}]}`,
+			`{"Statement": [{"Sid": "b", "Effect": "Allow"}, {"Sid": "a", "Effect": "Allow"}]}`, false},
+		{"unparseable", `{"Statement": [`, `{"Statement":  [`, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.equal, PolicyDocumentsEqual(tc.a, tc.b))
+			assert.Equal(t, tc.equal, PolicyDocumentsEqual(tc.b, tc.a))
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+)
+
+const (
+	// DefaultMaxRetries is the retry budget used when MAX_RETRIES isn't set.
+	// With the default delays it covers a few minutes of throttling, or of a
+	// workspace that is busy updating.
+	DefaultMaxRetries = 8
+
+	defaultBaseRetryDelay = 2 * time.Second
+	defaultMaxRetryDelay  = 60 * time.Second
+
+	// retryKey holds the number of retries spent in a callback context.
+	retryKey = "Retry"
+)
+
+// retryableErrors are the service errors that are likely to go away when the
+// request is retried a little later. A ConflictException is only retried when
+// it was annotated by WithBusyConflict.
+var retryableErrors = map[string]struct{}{
+	prometheusservice.ErrCodeThrottlingException: {},
+	"TooManyRequestsException":                   {},
+}
+
+// Retrier turns the failures of throttled requests and transient conflicts
+// into callbacks that retry the handler invocation. The delay between retries
+// grows exponentially with jitter, like the delay between polls.
+type Retrier struct {
+	// MaxRetries is the retry budget of an operation. Once it is spent, the
+	// failure is returned as it is. Zero or less disables retries.
+	MaxRetries int
+	// BaseDelay is the delay before the first retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries.
+	MaxDelay time.Duration
+}
+
+// NewRetrier returns a Retrier with the default delays and the retry budget
+// set by MAX_RETRIES in the environment, or DefaultMaxRetries.
+func NewRetrier() *Retrier {
+	maxRetries := DefaultMaxRetries
+	if value, ok := os.LookupEnv("MAX_RETRIES"); ok {
+		if n, err := strconv.Atoi(value); err == nil {
+			maxRetries = n
+		}
+	}
+	return &Retrier{
+		MaxRetries: maxRetries,
+		BaseDelay:  defaultBaseRetryDelay,
+		MaxDelay:   defaultMaxRetryDelay,
+	}
+}
+
+// Retry returns the result of a handler invoked for req. If the handler
+// failed with an error that ClassifyError deems retryable, as returned by
+// NewFailedEvent, and the retry budget isn't spent, Retry returns an
+// InProgress event instead, whose callback repeats the invocation with the
+// same callback context. model is the model to call back with.
+//
+// A successful retry moves on with a new callback context, which resets the
+// budget for the next failure.
+func (r *Retrier) Retry(req handler.Request, model interface{}, evt handler.ProgressEvent, err error) (handler.ProgressEvent, error) {
+	if evt.OperationStatus != handler.Failed || err == nil || !ClassifyError(err).Retryable {
+		return evt, err
+	}
+
+	retry := retries(req.CallbackContext) + 1
+	if retry > r.MaxRetries {
+		if r.MaxRetries > 0 {
+			evt.Message = fmt.Sprintf("%s (gave up after %d retries)", evt.Message, r.MaxRetries)
+		}
+		return evt, err
+	}
+
+	callbackContext := map[string]interface{}{}
+	for key, value := range req.CallbackContext {
+		callbackContext[key] = value
+	}
+	callbackContext[retryKey] = retry
+
+	return handler.ProgressEvent{
+		OperationStatus:      handler.InProgress,
+		Message:              fmt.Sprintf("Retrying after %s (retry %d of %d)", evt.Message, retry, r.MaxRetries),
+		ResourceModel:        model,
+		CallbackDelaySeconds: backoffSeconds(r.BaseDelay, r.MaxDelay, retry),
+		CallbackContext:      callbackContext,
+	}, nil
+}
+
+// retries returns the number of retries spent in a callback context.
+func retries(raw map[string]interface{}) int {
+	// CloudFormation round-trips the context through JSON, so the count may
+	// arrive as float64
+	switch n := raw[retryKey].(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws-cloudformation/cloudformation-cli-go-plugin/cfn/handler"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrier_Retry(t *testing.T) {
+	r := &Retrier{MaxRetries: 2, BaseDelay: 2 * time.Second, MaxDelay: time.Minute}
+	throttled, throttledErr := NewFailedEvent(&prometheusservice.ThrottlingException{Message_: aws.String("slow down")})
+
+	// a retried first invocation starts over without a callback context
+	req := handler.Request{}
+	evt, err := r.Retry(req, "model", throttled, throttledErr)
+	require.NoError(t, err)
+	assert.Equal(t, handler.InProgress, evt.OperationStatus)
+	assert.Equal(t, "Retrying after ThrottlingException: slow down (retry 1 of 2)", evt.Message)
+	assert.Equal(t, "model", evt.ResourceModel)
+	assert.True(t, evt.CallbackDelaySeconds >= 1 && evt.CallbackDelaySeconds <= 2)
+	c, err := DecodeCallbackContext(roundTrip(t, evt.CallbackContext), nil)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	req.CallbackContext = roundTrip(t, evt.CallbackContext)
+	evt, err = r.Retry(req, "model", throttled, throttledErr)
+	require.NoError(t, err)
+	assert.Equal(t, handler.InProgress, evt.OperationStatus)
+	assert.Equal(t, "Retrying after ThrottlingException: slow down (retry 2 of 2)", evt.Message)
+
+	req.CallbackContext = roundTrip(t, evt.CallbackContext)
+	evt, err = r.Retry(req, "model", throttled, throttledErr)
+	assert.Equal(t, throttledErr, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, cloudformation.HandlerErrorCodeThrottling, evt.HandlerErrorCode)
+	assert.Equal(t, "ThrottlingException: slow down (gave up after 2 retries)", evt.Message)
+	assert.Nil(t, evt.CallbackContext)
+}
+
+func TestRetrier_Retry_keepsPhase(t *testing.T) {
+	r := &Retrier{MaxRetries: 2, BaseDelay: 2 * time.Second, MaxDelay: time.Minute}
+	conflict, conflictErr := NewFailedEvent(WithBusyConflict(&prometheusservice.ConflictException{Message_: aws.String("busy")}))
+
+	waiting := roundTrip(t, NewCallbackContext(testPhase, testArn))
+	evt, err := r.Retry(handler.Request{CallbackContext: waiting}, nil, conflict, conflictErr)
+	require.NoError(t, err)
+	assert.Equal(t, handler.InProgress, evt.OperationStatus)
+
+	c, err := DecodeCallbackContext(roundTrip(t, evt.CallbackContext), nil)
+	require.NoError(t, err)
+	assert.True(t, c.InPhase(testPhase))
+	assert.Equal(t, testArn, c.Arn)
+	assert.Equal(t, 1, c.Attempt)
+}
+
+func TestRetrier_Retry_notRetryable(t *testing.T) {
+	r := &Retrier{MaxRetries: 2, BaseDelay: 2 * time.Second, MaxDelay: time.Minute}
+
+	notFound, notFoundErr := NewFailedEvent(&prometheusservice.ResourceNotFoundException{Message_: aws.String("gone")})
+	evt, err := r.Retry(handler.Request{}, nil, notFound, notFoundErr)
+	assert.Equal(t, notFoundErr, err)
+	assert.Equal(t, notFound, evt)
+
+	inProgress := handler.ProgressEvent{OperationStatus: handler.InProgress, CallbackContext: NewCallbackContext(testPhase, testArn)}
+	evt, err = r.Retry(handler.Request{}, nil, inProgress, nil)
+	require.NoError(t, err)
+	assert.Equal(t, inProgress, evt)
+
+	handlerErr := errors.New("handler failed")
+	_, err = r.Retry(handler.Request{}, nil, handler.ProgressEvent{}, handlerErr)
+	assert.Equal(t, handlerErr, err)
+
+	// without a budget retryable errors fail right away
+	throttled, throttledErr := NewFailedEvent(&prometheusservice.ThrottlingException{Message_: aws.String("slow down")})
+	evt, err = (&Retrier{}).Retry(handler.Request{}, nil, throttled, throttledErr)
+	assert.Equal(t, throttledErr, err)
+	assert.Equal(t, handler.Failed, evt.OperationStatus)
+	assert.Equal(t, "ThrottlingException: slow down", evt.Message)
+}
+
+func TestNewRetrier_maxRetries(t *testing.T) {
+	assert.Equal(t, DefaultMaxRetries, NewRetrier().MaxRetries)
+
+	require.NoError(t, os.Setenv("MAX_RETRIES", "3"))
+	defer os.Unsetenv("MAX_RETRIES")
+	assert.Equal(t, 3, NewRetrier().MaxRetries)
+}
@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ruleGroups mirrors the Prometheus rules file format accepted by
+// PutRuleGroupsNamespace.
+type ruleGroups struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name        string            `yaml:"name"`
+	Interval    string            `yaml:"interval,omitempty"`
+	QueryOffset string            `yaml:"query_offset,omitempty"`
+	Limit       int               `yaml:"limit,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Rules       []rule            `yaml:"rules"`
+}
+
+type rule struct {
+	Record        string            `yaml:"record,omitempty"`
+	Alert         string            `yaml:"alert,omitempty"`
+	Expr          string            `yaml:"expr"`
+	For           string            `yaml:"for,omitempty"`
+	KeepFiringFor string            `yaml:"keep_firing_for,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+	Annotations   map[string]string `yaml:"annotations,omitempty"`
+}
+
+// ValidateRuleGroups checks that data is a well formed Prometheus rules file.
+// Errors name the offending group and rule by their index in the file.
+func ValidateRuleGroups(data string) error {
+	var file ruleGroups
+	if err := decodeStrict(data, &file); err != nil {
+		return err
+	}
+
+	names := map[string]struct{}{}
+	for i, group := range file.Groups {
+		if err := validateRuleGroup(group, names); err != nil {
+			return fmt.Errorf("groups[%d] %q: %w", i, group.Name, err)
+		}
+		for j, r := range group.Rules {
+			if err := validateRule(r); err != nil {
+				return fmt.Errorf("groups[%d] %q: rules[%d] %q: %w", i, group.Name, j, r.name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// RuleGroupsEqual reports whether a and b define the same rule groups.
+// Formatting, key order and whitespace around expressions are ignored. Rule
+// files that don't parse are only equal if they are identical.
+func RuleGroupsEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	canonicalA, err := canonicalRuleGroups(a)
+	if err != nil {
+		return false
+	}
+	canonicalB, err := canonicalRuleGroups(b)
+	if err != nil {
+		return false
+	}
+	return yamlValuesEqual(canonicalA, canonicalB)
+}
+
+// canonicalRuleGroups decodes a rules file, trimming the whitespace block
+// scalars leave around expressions.
+func canonicalRuleGroups(data string) (interface{}, error) {
+	value, err := yamlValue(data)
+	if err != nil {
+		return nil, err
+	}
+	file, _ := value.(map[string]interface{})
+	groups, _ := file["groups"].([]interface{})
+	for _, group := range groups {
+		group, _ := group.(map[string]interface{})
+		rules, _ := group["rules"].([]interface{})
+		for _, r := range rules {
+			r, _ := r.(map[string]interface{})
+			if expr, ok := r["expr"].(string); ok {
+				r["expr"] = strings.TrimSpace(expr)
+			}
+		}
+	}
+	return value, nil
+}
+
+func validateRuleGroup(group ruleGroup, names map[string]struct{}) error {
+	if group.Name == "" {
+		return errors.New("group name should not be empty")
+	}
+	if _, ok := names[group.Name]; ok {
+		return errors.New("group name is repeated in the same file")
+	}
+	names[group.Name] = struct{}{}
+
+	if err := validateOptionalDuration("interval", group.Interval); err != nil {
+		return err
+	}
+	if err := validateOptionalDuration("query_offset", group.QueryOffset); err != nil {
+		return err
+	}
+	if group.Limit < 0 {
+		return fmt.Errorf("invalid limit %d: must not be negative", group.Limit)
+	}
+	return validateLabelNames("label", group.Labels)
+}
+
+// name returns the name of the recorded series or alert.
+func (r rule) name() string {
+	if r.Record != "" {
+		return r.Record
+	}
+	return r.Alert
+}
+
+func validateRule(r rule) error {
+	switch {
+	case r.Record != "" && r.Alert != "":
+		return errors.New("only one of 'record' and 'alert' must be set")
+	case r.Record == "" && r.Alert == "":
+		return errors.New("one of 'record' or 'alert' must be set")
+	case r.Expr == "":
+		return errors.New("field 'expr' must be set")
+	}
+
+	if r.Record != "" {
+		switch {
+		case !metricNameRE.MatchString(r.Record):
+			return fmt.Errorf("invalid recording rule name %q", r.Record)
+		case len(r.Annotations) > 0:
+			return errors.New("invalid field 'annotations' in recording rule")
+		case r.For != "":
+			return errors.New("invalid field 'for' in recording rule")
+		case r.KeepFiringFor != "":
+			return errors.New("invalid field 'keep_firing_for' in recording rule")
+		}
+	}
+
+	if err := validateOptionalDuration("for", r.For); err != nil {
+		return err
+	}
+	if err := validateOptionalDuration("keep_firing_for", r.KeepFiringFor); err != nil {
+		return err
+	}
+	if err := validateLabelNames("label", r.Labels); err != nil {
+		return err
+	}
+	if err := validateLabelNames("annotation", r.Annotations); err != nil {
+		return err
+	}
+
+	typ, err := checkPromQL(r.Expr)
+	if err != nil {
+		return fmt.Errorf("could not parse expression: %w", err)
+	}
+	if typ != promqlVector && typ != promqlScalar {
+		return fmt.Errorf("expression must evaluate to an instant vector or scalar, got %s", typ)
+	}
+	return nil
+}
+
+func validateOptionalDuration(field, value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := parseDuration(value); err != nil {
+		return fmt.Errorf("invalid '%s': %w", field, err)
+	}
+	return nil
+}
+
+func validateLabelNames(kind string, labels map[string]string) error {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !labelNameRE.MatchString(name) {
+			return fmt.Errorf("invalid %s name %q", kind, name)
+		}
+	}
+	return nil
+}
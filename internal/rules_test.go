@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRuleGroups = `groups:
+  - name: example
+    interval: 1m
+    rules:
+      - record: job:http_inprogress_requests:sum
+        expr: sum by (job) (http_inprogress_requests)
+        labels:
+          team: api
+      - alert: HighRequestLatency
+        expr: job:request_latency_seconds:mean5m{job="myjob"} > 0.5
+        for: 10m
+        keep_firing_for: 5m
+        labels:
+          severity: page
+        annotations:
+          summary: High request latency on {{ $labels.instance }}
+  - name: empty
+    rules: []
+`
+
+func TestValidateRuleGroups(t *testing.T) {
+	assert.NoError(t, ValidateRuleGroups(testRuleGroups))
+	assert.NoError(t, ValidateRuleGroups("groups: []"))
+}
+
+func TestValidateRuleGroups_invalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    string
+		message string
+	}{
+		{
+			"malformed yaml",
+			"groups: [",
+			"yaml: line 1: did not find expected node content",
+		},
+		{
+			"unknown field",
+			"groups:\n  - name: a\n    rules:\n      - alert: A\n        exp: up\n",
+			"line 5: field exp not found",
+		},
+		{
+			"duplicate group",
+			"groups:\n  - name: a\n  - name: a\n",
+			`groups[1] "a": group name is repeated in the same file`,
+		},
+		{
+			"missing group name",
+			"groups:\n  - rules: []\n",
+			`groups[0] "": group name should not be empty`,
+		},
+		{
+			"bad interval",
+			"groups:\n  - name: a\n    interval: 1 minute\n",
+			`groups[0] "a": invalid 'interval': not a valid duration string: "1 minute"`,
+		},
+		{
+			"record and alert",
+			"groups:\n  - name: a\n    rules:\n      - record: a\n        alert: A\n        expr: up\n",
+			`groups[0] "a": rules[0] "a": only one of 'record' and 'alert' must be set`,
+		},
+		{
+			"neither record nor alert",
+			"groups:\n  - name: a\n    rules:\n      - expr: up\n",
+			`groups[0] "a": rules[0] "": one of 'record' or 'alert' must be set`,
+		},
+		{
+			"missing expr",
+			"groups:\n  - name: a\n    rules:\n      - alert: A\n",
+			`groups[0] "a": rules[0] "A": field 'expr' must be set`,
+		},
+		{
+			"invalid recording rule name",
+			"groups:\n  - name: a\n    rules:\n      - record: job-rate\n        expr: up\n",
+			`invalid recording rule name "job-rate"`,
+		},
+		{
+			"annotations on recording rule",
+			"groups:\n  - name: a\n    rules:\n      - record: r\n        expr: up\n        annotations:\n          a: b\n",
+			"invalid field 'annotations' in recording rule",
+		},
+		{
+			"for on recording rule",
+			"groups:\n  - name: a\n    rules:\n      - record: r\n        expr: up\n        for: 5m\n",
+			"invalid field 'for' in recording rule",
+		},
+		{
+			"bad for",
+			"groups:\n  - name: a\n    rules:\n      - alert: A\n        expr: up\n        for: 5 minutes\n",
+			`groups[0] "a": rules[0] "A": invalid 'for': not a valid duration string: "5 minutes"`,
+		},
+		{
+			"bad label name",
+			"groups:\n  - name: a\n    rules:\n      - alert: A\n        expr: up\n        labels:\n          team-name: x\n",
+			`invalid label name "team-name"`,
+		},
+		{
+			"bad annotation name",
+			"groups:\n  - name: a\n    rules:\n      - alert: A\n        expr: up\n        annotations:\n          1summary: x\n",
+			`invalid annotation name "1summary"`,
+		},
+		{
+			"labels not a map",
+			"groups:\n  - name: a\n    rules:\n      - alert: A\n        expr: up\n        labels: [a, b]\n",
+			"cannot unmarshal !!seq into map[string]string",
+		},
+		{
+			"bad expr",
+			"groups:\n  - name: a\n    rules:\n      - alert: A\n        expr: up\n      - alert: B\n        expr: sum(rate(x[5m])\n",
+			`groups[0] "a": rules[1] "B": could not parse expression: 1:16: parse error: unexpected end of input in aggregation`,
+		},
+		{
+			"range vector expr",
+			"groups:\n  - name: a\n    rules:\n      - record: r\n        expr: up[5m]\n",
+			"expression must evaluate to an instant vector or scalar, got range vector",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateRuleGroups(tc.data)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.message)
+			}
+		})
+	}
+}
+
+func TestRuleGroupsEqual(t *testing.T) {
+	reformatted := `groups:
+- rules:
+  - expr: >
+      sum by (job) (http_inprogress_requests)
+    labels: {team: api}
+    record: job:http_inprogress_requests:sum
+  - alert: HighRequestLatency
+    expr: 'job:request_latency_seconds:mean5m{job="myjob"} > 0.5'
+    for: 10m
+    keep_firing_for: 5m
+    labels: {severity: page}
+    annotations: {summary: "High request latency on {{ $labels.instance }}"}
+  interval: 1m
+  name: example
+- name: empty
+`
+	testCases := []struct {
+		name  string
+		a, b  string
+		equal bool
+	}{
+		{"identical", testRuleGroups, testRuleGroups, true},
+		{"reformatted", testRuleGroups, reformatted, true},
+		{"changed expr", testRuleGroups, strings.Replace(testRuleGroups, "> 0.5", "> 0.7", 1), false},
+		{"changed for", testRuleGroups, strings.Replace(testRuleGroups, "for: 10m", "for: 5m", 1), false},
+		{"reordered rules", "groups: [{name: a, rules: [{record: a, expr: up}, {record: b, expr: up}]}]",
+			"groups: [{name: a, rules: [{record: b, expr: up}, {record: a, expr: up}]}]", false},
+		{"unparseable", "groups: [", "groups:  [", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.equal, RuleGroupsEqual(tc.a, tc.b))
+			assert.Equal(t, tc.equal, RuleGroupsEqual(tc.b, tc.a))
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"0", 0},
+		{"0s", 0},
+		{"500ms", 500 * time.Millisecond},
+		{"1h30m", 90 * time.Minute},
+		{"2d", 48 * time.Hour},
+		{"1w", 7 * 24 * time.Hour},
+		{"1y", 365 * 24 * time.Hour},
+	}
+	for _, tc := range testCases {
+		d, err := parseDuration(tc.value)
+		assert.NoError(t, err, tc.value)
+		assert.Equal(t, tc.expected, d, tc.value)
+	}
+
+	for _, value := range []string{"", "1", "1.5h", "30m1h", "-1m", "1 m", "99999999999999y"} {
+		_, err := parseDuration(value)
+		assert.Error(t, err, value)
+	}
+}
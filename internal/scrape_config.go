@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Defaults Prometheus applies when the global section leaves them unset.
+const (
+	defaultScrapeInterval = time.Minute
+	defaultScrapeTimeout  = 10 * time.Second
+)
+
+// supportedServiceDiscovery lists the service discovery mechanisms managed
+// collectors can run.
+var supportedServiceDiscovery = map[string]struct{}{
+	"kubernetes_sd_configs": {},
+}
+
+// relabelTargetRE matches the target labels accepted by the replace action,
+// which may reference regex capture groups.
+var relabelTargetRE = regexp.MustCompile(`^(?:(?:[a-zA-Z_]|\$(?:\{\w+\}|\w+))+\w*)+$`)
+
+// scrapeConfigFile mirrors the parts of a Prometheus configuration file that
+// matter to a managed collector. Fields the validator doesn't check are kept
+// in Other so they don't fail decoding.
+type scrapeConfigFile struct {
+	Global        scrapeGlobal           `yaml:"global,omitempty"`
+	ScrapeConfigs []scrapeConfig         `yaml:"scrape_configs"`
+	Other         map[string]interface{} `yaml:",inline"`
+}
+
+type scrapeGlobal struct {
+	ScrapeInterval string                 `yaml:"scrape_interval,omitempty"`
+	ScrapeTimeout  string                 `yaml:"scrape_timeout,omitempty"`
+	Other          map[string]interface{} `yaml:",inline"`
+}
+
+type scrapeConfig struct {
+	JobName              string                 `yaml:"job_name"`
+	ScrapeInterval       string                 `yaml:"scrape_interval,omitempty"`
+	ScrapeTimeout        string                 `yaml:"scrape_timeout,omitempty"`
+	RelabelConfigs       []relabelConfig        `yaml:"relabel_configs,omitempty"`
+	MetricRelabelConfigs []relabelConfig        `yaml:"metric_relabel_configs,omitempty"`
+	Other                map[string]interface{} `yaml:",inline"`
+}
+
+type relabelConfig struct {
+	SourceLabels []string `yaml:"source_labels,omitempty"`
+	Separator    *string  `yaml:"separator,omitempty"`
+	Regex        *string  `yaml:"regex,omitempty"`
+	Modulus      uint64   `yaml:"modulus,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Replacement  *string  `yaml:"replacement,omitempty"`
+	Action       string   `yaml:"action,omitempty"`
+}
+
+// ValidateScrapeConfiguration checks that data is a Prometheus configuration
+// a managed collector can run. Errors name the offending job by its index and
+// name, followed by the path of the offending field.
+func ValidateScrapeConfiguration(data []byte) error {
+	var file scrapeConfigFile
+	if err := decodeStrict(string(data), &file); err != nil {
+		return err
+	}
+
+	interval, timeout, err := validateScrapeGlobal(file.Global)
+	if err != nil {
+		return err
+	}
+
+	names := map[string]struct{}{}
+	for i, job := range file.ScrapeConfigs {
+		if err := validateScrapeJob(job, names, interval, timeout); err != nil {
+			return fmt.Errorf("scrape_configs[%d] %q: %w", i, job.JobName, err)
+		}
+	}
+	return nil
+}
+
+// validateScrapeGlobal returns the scrape interval and timeout jobs inherit.
+func validateScrapeGlobal(global scrapeGlobal) (time.Duration, time.Duration, error) {
+	interval, err := optionalDuration("global.scrape_interval", global.ScrapeInterval, defaultScrapeInterval)
+	if err != nil {
+		return 0, 0, err
+	}
+	fallback := defaultScrapeTimeout
+	if fallback > interval {
+		fallback = interval
+	}
+	timeout, err := optionalDuration("global.scrape_timeout", global.ScrapeTimeout, fallback)
+	if err != nil {
+		return 0, 0, err
+	}
+	if timeout > interval {
+		return 0, 0, fmt.Errorf("global.scrape_timeout: %s must not be greater than scrape_interval %s", global.ScrapeTimeout, interval)
+	}
+	return interval, timeout, nil
+}
+
+func validateScrapeJob(job scrapeConfig, names map[string]struct{}, globalInterval, globalTimeout time.Duration) error {
+	if job.JobName == "" {
+		return errors.New("job_name: must not be empty")
+	}
+	if _, ok := names[job.JobName]; ok {
+		return errors.New("job_name: is repeated in the same file")
+	}
+	names[job.JobName] = struct{}{}
+
+	interval, err := optionalDuration("scrape_interval", job.ScrapeInterval, globalInterval)
+	if err != nil {
+		return err
+	}
+	// like Prometheus, an inherited timeout is capped to the job's interval
+	if globalTimeout > interval {
+		globalTimeout = interval
+	}
+	timeout, err := optionalDuration("scrape_timeout", job.ScrapeTimeout, globalTimeout)
+	if err != nil {
+		return err
+	}
+	if timeout > interval {
+		return fmt.Errorf("scrape_timeout: %s must not be greater than scrape_interval %s", job.ScrapeTimeout, interval)
+	}
+
+	keys := make([]string, 0, len(job.Other))
+	for key := range job.Other {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := supportedServiceDiscovery[key]; strings.HasSuffix(key, "_sd_configs") && !ok {
+			return fmt.Errorf("%s: service discovery is not supported by managed collectors", key)
+		}
+	}
+
+	for i, config := range job.RelabelConfigs {
+		if err := validateRelabelConfig(config); err != nil {
+			return fmt.Errorf("relabel_configs[%d].%w", i, err)
+		}
+	}
+	for i, config := range job.MetricRelabelConfigs {
+		if err := validateRelabelConfig(config); err != nil {
+			return fmt.Errorf("metric_relabel_configs[%d].%w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateRelabelConfig applies the checks Prometheus runs when it loads a
+// relabel config. Errors start with the name of the offending field.
+func validateRelabelConfig(config relabelConfig) error {
+	action := config.Action
+	if action == "" {
+		action = "replace"
+	}
+
+	for _, label := range config.SourceLabels {
+		if !labelNameRE.MatchString(label) {
+			return fmt.Errorf("source_labels: invalid label name %q", label)
+		}
+	}
+	if config.Regex != nil {
+		if _, err := regexp.Compile("^(?:" + *config.Regex + ")$"); err != nil {
+			return fmt.Errorf("regex: %w", err)
+		}
+	}
+
+	switch action {
+	case "replace":
+		if config.TargetLabel == "" {
+			return errors.New("target_label: must be set for action replace")
+		}
+		if !relabelTargetRE.MatchString(config.TargetLabel) {
+			return fmt.Errorf("target_label: %q is invalid for action replace", config.TargetLabel)
+		}
+	case "hashmod":
+		if config.Modulus == 0 {
+			return errors.New("modulus: must not be zero for action hashmod")
+		}
+		fallthrough
+	case "lowercase", "uppercase", "keepequal", "dropequal":
+		if config.TargetLabel == "" {
+			return fmt.Errorf("target_label: must be set for action %s", action)
+		}
+		if !labelNameRE.MatchString(config.TargetLabel) {
+			return fmt.Errorf("target_label: %q is invalid for action %s", config.TargetLabel, action)
+		}
+	case "keep", "drop", "labelmap":
+	case "labeldrop", "labelkeep":
+		if len(config.SourceLabels) > 0 || config.TargetLabel != "" || config.Modulus != 0 || config.Separator != nil || config.Replacement != nil {
+			return fmt.Errorf("action: %s only accepts 'regex'", action)
+		}
+	default:
+		return fmt.Errorf("action: unknown relabel action %q", config.Action)
+	}
+	return nil
+}
+
+// optionalDuration parses value, returning fallback if it is empty.
+func optionalDuration(field, value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := parseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", field, err)
+	}
+	return d, nil
+}
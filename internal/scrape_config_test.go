@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testScrapeConfig = `global:
+  scrape_interval: 30s
+  external_labels:
+    cluster: demo
+scrape_configs:
+  - job_name: pods
+    scrape_timeout: 20s
+    kubernetes_sd_configs:
+      - role: pod
+    relabel_configs:
+      - source_labels: [__meta_kubernetes_pod_annotation_prometheus_io_scrape]
+        action: keep
+        regex: "true"
+      - source_labels: [__meta_kubernetes_namespace]
+        target_label: namespace
+      - source_labels: [__address__]
+        modulus: 4
+        target_label: __tmp_hash
+        action: hashmod
+      - regex: __meta_kubernetes_pod_label_(.+)
+        action: labelmap
+      - regex: pod_template_hash
+        action: labeldrop
+      - regex: (.+)
+        target_label: ${1}_copy
+    metric_relabel_configs:
+      - source_labels: [__name__]
+        regex: go_.*
+        action: drop
+  - job_name: static
+    scrape_interval: 5s
+    static_configs:
+      - targets: [localhost:9090]
+`
+
+func TestValidateScrapeConfiguration(t *testing.T) {
+	assert.NoError(t, ValidateScrapeConfiguration([]byte(testScrapeConfig)))
+	assert.NoError(t, ValidateScrapeConfiguration([]byte("scrape_configs: []")))
+	assert.NoError(t, ValidateScrapeConfiguration([]byte("global:\n  scrape_interval: 5s\n")))
+}
+
+func TestValidateScrapeConfiguration_invalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		data    string
+		message string
+	}{
+		{
+			"malformed yaml",
+			"scrape_configs: [",
+			"yaml: line 1: did not find expected node content",
+		},
+		{
+			"missing job name",
+			"scrape_configs:\n  - scrape_interval: 1m\n",
+			`scrape_configs[0] "": job_name: must not be empty`,
+		},
+		{
+			"duplicate job",
+			"scrape_configs:\n  - job_name: a\n  - job_name: a\n",
+			`scrape_configs[1] "a": job_name: is repeated in the same file`,
+		},
+		{
+			"bad global interval",
+			"global:\n  scrape_interval: 1 minute\n",
+			`global.scrape_interval: not a valid duration string: "1 minute"`,
+		},
+		{
+			"global timeout exceeds interval",
+			"global:\n  scrape_interval: 10s\n  scrape_timeout: 15s\n",
+			"global.scrape_timeout: 15s must not be greater than scrape_interval 10s",
+		},
+		{
+			"job timeout exceeds interval",
+			"scrape_configs:\n  - job_name: a\n    scrape_interval: 10s\n    scrape_timeout: 15s\n",
+			`scrape_configs[0] "a": scrape_timeout: 15s must not be greater than scrape_interval 10s`,
+		},
+		{
+			"job timeout exceeds inherited interval",
+			"global:\n  scrape_interval: 10s\nscrape_configs:\n  - job_name: a\n    scrape_timeout: 15s\n",
+			`scrape_configs[0] "a": scrape_timeout: 15s must not be greater than scrape_interval 10s`,
+		},
+		{
+			"unsupported service discovery",
+			"scrape_configs:\n  - job_name: a\n    consul_sd_configs: []\n",
+			`scrape_configs[0] "a": consul_sd_configs: service discovery is not supported by managed collectors`,
+		},
+		{
+			"invalid regex",
+			"scrape_configs:\n  - job_name: a\n    relabel_configs:\n      - action: keep\n      - action: drop\n        regex: (foo\n",
+			"scrape_configs[0] \"a\": relabel_configs[1].regex: error parsing regexp: missing closing ): `^(?:(foo)$`",
+		},
+		{
+			"unknown action",
+			"scrape_configs:\n  - job_name: a\n    metric_relabel_configs:\n      - action: delete\n",
+			`scrape_configs[0] "a": metric_relabel_configs[0].action: unknown relabel action "delete"`,
+		},
+		{
+			"unknown relabel field",
+			"scrape_configs:\n  - job_name: a\n    relabel_configs:\n      - target: foo\n",
+			"yaml: unmarshal errors:\n  line 4: field target not found in type internal.relabelConfig",
+		},
+		{
+			"replace without target",
+			"scrape_configs:\n  - job_name: a\n    relabel_configs:\n      - source_labels: [a]\n",
+			`scrape_configs[0] "a": relabel_configs[0].target_label: must be set for action replace`,
+		},
+		{
+			"invalid source label",
+			"scrape_configs:\n  - job_name: a\n    relabel_configs:\n      - source_labels: [a-b]\n        action: keep\n",
+			`scrape_configs[0] "a": relabel_configs[0].source_labels: invalid label name "a-b"`,
+		},
+		{
+			"hashmod without modulus",
+			"scrape_configs:\n  - job_name: a\n    relabel_configs:\n      - action: hashmod\n        target_label: a\n",
+			`scrape_configs[0] "a": relabel_configs[0].modulus: must not be zero for action hashmod`,
+		},
+		{
+			"lowercase with template target",
+			"scrape_configs:\n  - job_name: a\n    relabel_configs:\n      - action: lowercase\n        target_label: $1\n",
+			`scrape_configs[0] "a": relabel_configs[0].target_label: "$1" is invalid for action lowercase`,
+		},
+		{
+			"labeldrop with target",
+			"scrape_configs:\n  - job_name: a\n    relabel_configs:\n      - action: labeldrop\n        target_label: a\n",
+			`scrape_configs[0] "a": relabel_configs[0].action: labeldrop only accepts 'regex'`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateScrapeConfiguration([]byte(tc.data))
+			if assert.Error(t, err) {
+				assert.Equal(t, tc.message, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+)
+
+// Scrapers can be updated in place since after the aws-sdk-go v1
+// prometheusservice client was generated, which lacks UpdateScraper and the
+// statuses that come with it.
+
+const (
+	ScraperStatusCodeUpdating     = "UPDATING"
+	ScraperStatusCodeUpdateFailed = "UPDATE_FAILED"
+)
+
+// UpdateScraperInput changes the alias, destination or scrape configuration of
+// a scraper. Fields left nil are not changed. The source of a scraper can't be
+// changed.
+type UpdateScraperInput struct {
+	_ struct{} `type:"structure"`
+
+	Alias               *string                                `locationName:"alias" min:"1" type:"string"`
+	ClientToken         *string                                `locationName:"clientToken" min:"1" type:"string" idempotencyToken:"true"`
+	Destination         *prometheusservice.Destination         `locationName:"destination" type:"structure"`
+	ScrapeConfiguration *prometheusservice.ScrapeConfiguration `locationName:"scrapeConfiguration" type:"structure"`
+	ScraperId           *string                                `location:"uri" locationName:"scraperId" min:"1" type:"string" required:"true"`
+}
+
+// Validate checks the required parameters of the request.
+func (s *UpdateScraperInput) Validate() error {
+	invalidParams := request.ErrInvalidParams{Context: "UpdateScraperInput"}
+	if s.ScraperId == nil {
+		invalidParams.Add(request.NewErrParamRequired("ScraperId"))
+	} else if len(*s.ScraperId) < 1 {
+		invalidParams.Add(request.NewErrParamMinLen("ScraperId", 1))
+	}
+	if s.Alias != nil && len(*s.Alias) < 1 {
+		invalidParams.Add(request.NewErrParamMinLen("Alias", 1))
+	}
+	if s.Destination != nil {
+		if err := s.Destination.Validate(); err != nil {
+			invalidParams.AddNested("Destination", err.(request.ErrInvalidParams))
+		}
+	}
+	if invalidParams.Len() > 0 {
+		return invalidParams
+	}
+	return nil
+}
+
+type UpdateScraperOutput struct {
+	_ struct{} `type:"structure"`
+
+	Arn       *string                          `locationName:"arn" type:"string" required:"true"`
+	ScraperId *string                          `locationName:"scraperId" min:"1" type:"string" required:"true"`
+	Status    *prometheusservice.ScraperStatus `locationName:"status" type:"structure" required:"true"`
+	Tags      map[string]*string               `locationName:"tags" type:"map"`
+}
+
+// UpdateScraper changes a scraper in place. The change is applied
+// asynchronously.
+func (c *Client) UpdateScraper(input *UpdateScraperInput) (*UpdateScraperOutput, error) {
+	op := &request.Operation{
+		Name:       "UpdateScraper",
+		HTTPMethod: "PUT",
+		HTTPPath:   "/scrapers/{scraperId}",
+	}
+	if input == nil {
+		input = &UpdateScraperInput{}
+	}
+
+	output := &UpdateScraperOutput{}
+	return output, c.NewRequest(op, input, output).Send()
+}
+
+// DecodeScrapeConfiguration decodes a base64 encoded scrape configuration.
+// Both padded and unpadded encodings are accepted.
+func DecodeScrapeConfiguration(encoded string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(encoded)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("configuration blob is not valid base64: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("configuration blob must not be empty")
+	}
+	return data, nil
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_UpdateScraper(t *testing.T) {
+	var body map[string]interface{}
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/scrapers/s-1", r.URL.Path)
+		data, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &body))
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"arn": "arn:aws:aps:us-west-2:111111111111:scraper/s-1", "scraperId": "s-1", "status": {"statusCode": "UPDATING"}}`))
+	})
+
+	out, err := client.UpdateScraper(&UpdateScraperInput{
+		ScraperId: aws.String("s-1"),
+		Alias:     aws.String("renamed"),
+		Destination: &prometheusservice.Destination{
+			AmpConfiguration: &prometheusservice.AmpConfiguration{
+				WorkspaceArn: aws.String("arn:aws:aps:us-west-2:111111111111:workspace/ws-1"),
+			},
+		},
+		ScrapeConfiguration: &prometheusservice.ScrapeConfiguration{ConfigurationBlob: []byte("scrape_configs: []\n")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ScraperStatusCodeUpdating, aws.StringValue(out.Status.StatusCode))
+	assert.Equal(t, "s-1", aws.StringValue(out.ScraperId))
+
+	assert.NotEmpty(t, body["clientToken"])
+	assert.Equal(t, "renamed", body["alias"])
+	assert.Equal(t, map[string]interface{}{
+		"ampConfiguration": map[string]interface{}{"workspaceArn": "arn:aws:aps:us-west-2:111111111111:workspace/ws-1"},
+	}, body["destination"])
+	assert.Equal(t, map[string]interface{}{"configurationBlob": "c2NyYXBlX2NvbmZpZ3M6IFtdCg=="}, body["scrapeConfiguration"])
+
+	_, err = client.UpdateScraper(&UpdateScraperInput{
+		ScraperId:   aws.String("s-1"),
+		Destination: &prometheusservice.Destination{AmpConfiguration: &prometheusservice.AmpConfiguration{}},
+	})
+	assert.EqualError(t, err, "InvalidParameter: 1 validation error(s) found.\n- missing required field, UpdateScraperInput.Destination.AmpConfiguration.WorkspaceArn.\n")
+}
+
+func TestDecodeScrapeConfiguration(t *testing.T) {
+	for _, encoded := range []string{"c2NyYXBlX2NvbmZpZ3M6IFtdCg==", "c2NyYXBlX2NvbmZpZ3M6IFtdCg"} {
+		data, err := DecodeScrapeConfiguration(encoded)
+		require.NoError(t, err, encoded)
+		assert.Equal(t, "scrape_configs: []\n", string(data))
+	}
+
+	_, err := DecodeScrapeConfiguration("scrape_configs: []")
+	assert.EqualError(t, err, "configuration blob is not valid base64: illegal base64 data at input byte 6")
+	_, err = DecodeScrapeConfiguration("")
+	assert.EqualError(t, err, "configuration blob must not be empty")
+}
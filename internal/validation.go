@@ -0,0 +1,24 @@
+package internal
+
+import "fmt"
+
+// ValidationError is returned when a resource property fails the checks a
+// handler runs before calling APS. NewFailedEvent maps it to InvalidRequest.
+type ValidationError struct {
+	// Property is the name of the offending resource property.
+	Property string
+	Err      error
+}
+
+// NewValidationError returns a ValidationError for property.
+func NewValidationError(property string, err error) *ValidationError {
+	return &ValidationError{Property: property, Err: err}
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Property, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// The workspace configuration operations are newer than the aws-sdk-go v1
+// prometheusservice client. The types below follow the shapes of the service
+// API so the operations can be sent through the SDK's REST-JSON protocol.
+
+const (
+	WorkspaceConfigurationStatusCodeActive       = "ACTIVE"
+	WorkspaceConfigurationStatusCodeUpdating     = "UPDATING"
+	WorkspaceConfigurationStatusCodeUpdateFailed = "UPDATE_FAILED"
+
+	// DefaultRetentionPeriodInDays is the retention period of a workspace
+	// that was never configured.
+	DefaultRetentionPeriodInDays = 150
+)
+
+// LimitsPerLabelSet is an ingestion limit for the time series matching a
+// label set. An empty label set is the default label set.
+type LimitsPerLabelSet struct {
+	_ struct{} `type:"structure"`
+
+	LabelSet map[string]*string      `locationName:"labelSet" type:"map" required:"true"`
+	Limits   *LimitsPerLabelSetEntry `locationName:"limits" type:"structure" required:"true"`
+}
+
+type LimitsPerLabelSetEntry struct {
+	_ struct{} `type:"structure"`
+
+	MaxSeries *int64 `locationName:"maxSeries" type:"long"`
+}
+
+type WorkspaceConfigurationStatus struct {
+	_ struct{} `type:"structure"`
+
+	StatusCode   *string `locationName:"statusCode" type:"string" required:"true"`
+	StatusReason *string `locationName:"statusReason" type:"string"`
+}
+
+type WorkspaceConfigurationDescription struct {
+	_ struct{} `type:"structure"`
+
+	LimitsPerLabelSet     []*LimitsPerLabelSet          `locationName:"limitsPerLabelSet" type:"list"`
+	RetentionPeriodInDays *int64                        `locationName:"retentionPeriodInDays" min:"1" type:"integer"`
+	Status                *WorkspaceConfigurationStatus `locationName:"status" type:"structure" required:"true"`
+}
+
+type DescribeWorkspaceConfigurationInput struct {
+	_ struct{} `type:"structure" nopayload:"true"`
+
+	WorkspaceId *string `location:"uri" locationName:"workspaceId" min:"1" type:"string" required:"true"`
+}
+
+// Validate checks the required parameters of the request.
+func (s *DescribeWorkspaceConfigurationInput) Validate() error {
+	return validateWorkspaceID("DescribeWorkspaceConfigurationInput", s.WorkspaceId)
+}
+
+type DescribeWorkspaceConfigurationOutput struct {
+	_ struct{} `type:"structure"`
+
+	WorkspaceConfiguration *WorkspaceConfigurationDescription `locationName:"workspaceConfiguration" type:"structure" required:"true"`
+}
+
+// UpdateWorkspaceConfigurationInput replaces the retention period and the
+// label set limits of a workspace. Fields left nil are not changed, an empty
+// LimitsPerLabelSet removes every limit.
+type UpdateWorkspaceConfigurationInput struct {
+	_ struct{} `type:"structure"`
+
+	ClientToken           *string              `locationName:"clientToken" min:"1" type:"string" idempotencyToken:"true"`
+	LimitsPerLabelSet     []*LimitsPerLabelSet `locationName:"limitsPerLabelSet" type:"list"`
+	RetentionPeriodInDays *int64               `locationName:"retentionPeriodInDays" min:"1" type:"integer"`
+	WorkspaceId           *string              `location:"uri" locationName:"workspaceId" min:"1" type:"string" required:"true"`
+}
+
+// Validate checks the required parameters of the request.
+func (s *UpdateWorkspaceConfigurationInput) Validate() error {
+	if err := validateWorkspaceID("UpdateWorkspaceConfigurationInput", s.WorkspaceId); err != nil {
+		return err
+	}
+	invalidParams := request.ErrInvalidParams{Context: "UpdateWorkspaceConfigurationInput"}
+	if s.RetentionPeriodInDays != nil && *s.RetentionPeriodInDays < 1 {
+		invalidParams.Add(request.NewErrParamMinValue("RetentionPeriodInDays", 1))
+	}
+	for i, limits := range s.LimitsPerLabelSet {
+		if limits == nil || limits.LabelSet == nil {
+			invalidParams.Add(request.NewErrParamRequired(fmt.Sprintf("LimitsPerLabelSet[%d].LabelSet", i)))
+		}
+		if limits == nil || limits.Limits == nil {
+			invalidParams.Add(request.NewErrParamRequired(fmt.Sprintf("LimitsPerLabelSet[%d].Limits", i)))
+		}
+	}
+	if invalidParams.Len() > 0 {
+		return invalidParams
+	}
+	return nil
+}
+
+type UpdateWorkspaceConfigurationOutput struct {
+	_ struct{} `type:"structure"`
+
+	Status *WorkspaceConfigurationStatus `locationName:"status" type:"structure" required:"true"`
+}
+
+func validateWorkspaceID(context string, workspaceID *string) error {
+	invalidParams := request.ErrInvalidParams{Context: context}
+	if workspaceID == nil {
+		invalidParams.Add(request.NewErrParamRequired("WorkspaceId"))
+	} else if len(*workspaceID) < 1 {
+		invalidParams.Add(request.NewErrParamMinLen("WorkspaceId", 1))
+	}
+	if invalidParams.Len() > 0 {
+		return invalidParams
+	}
+	return nil
+}
+
+// DescribeWorkspaceConfiguration returns the retention period and label set
+// limits of a workspace.
+func (c *Client) DescribeWorkspaceConfiguration(input *DescribeWorkspaceConfigurationInput) (*DescribeWorkspaceConfigurationOutput, error) {
+	op := &request.Operation{
+		Name:       "DescribeWorkspaceConfiguration",
+		HTTPMethod: "GET",
+		HTTPPath:   "/workspaces/{workspaceId}/configuration",
+	}
+	if input == nil {
+		input = &DescribeWorkspaceConfigurationInput{}
+	}
+
+	output := &DescribeWorkspaceConfigurationOutput{}
+	return output, c.NewRequest(op, input, output).Send()
+}
+
+// UpdateWorkspaceConfiguration changes the retention period and label set
+// limits of a workspace. The change is applied asynchronously.
+func (c *Client) UpdateWorkspaceConfiguration(input *UpdateWorkspaceConfigurationInput) (*UpdateWorkspaceConfigurationOutput, error) {
+	op := &request.Operation{
+		Name:       "UpdateWorkspaceConfiguration",
+		HTTPMethod: "PATCH",
+		HTTPPath:   "/workspaces/{workspaceId}/configuration",
+	}
+	if input == nil {
+		input = &UpdateWorkspaceConfigurationInput{}
+	}
+
+	output := &UpdateWorkspaceConfigurationOutput{}
+	return output, c.NewRequest(op, input, output).Send()
+}
+
+// LimitsPerLabelSetsEqual reports whether a and b set the same limits on the
+// same label sets, regardless of the order of the entries.
+func LimitsPerLabelSetsEqual(a, b []*LimitsPerLabelSet) bool {
+	limitsA, limitsB := limitsByLabelSet(a), limitsByLabelSet(b)
+	if len(a) != len(b) || len(limitsA) != len(limitsB) {
+		return false
+	}
+	for labelSet, maxSeries := range limitsA {
+		if other, ok := limitsB[labelSet]; !ok || other != maxSeries {
+			return false
+		}
+	}
+	return true
+}
+
+// limitsByLabelSet indexes the max series limits by a canonical form of their
+// label set. A missing limit is the same as 0, which enforces no limit.
+func limitsByLabelSet(limits []*LimitsPerLabelSet) map[string]int64 {
+	index := make(map[string]int64, len(limits))
+	for _, l := range limits {
+		if l == nil {
+			continue
+		}
+		var maxSeries int64
+		if l.Limits != nil {
+			maxSeries = aws.Int64Value(l.Limits.MaxSeries)
+		}
+		index[labelSetKey(l.LabelSet)] = maxSeries
+	}
+	return index
+}
+
+func labelSetKey(labelSet map[string]*string) string {
+	pairs := make([]string, 0, len(labelSet))
+	for name, value := range labelSet {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, aws.StringValue(value)))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
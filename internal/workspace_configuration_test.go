@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/prometheusservice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClient returns a Client that sends its requests to handler.
+func testClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		MaxRetries:  aws.Int(0),
+		Region:      aws.String("us-west-2"),
+	}))
+	return &Client{prometheusservice.New(sess)}
+}
+
+func TestClient_UpdateWorkspaceConfiguration(t *testing.T) {
+	var body map[string]interface{}
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method)
+		assert.Equal(t, "/workspaces/ws-1/configuration", r.URL.Path)
+		data, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &body))
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status": {"statusCode": "UPDATING"}}`))
+	})
+
+	out, err := client.UpdateWorkspaceConfiguration(&UpdateWorkspaceConfigurationInput{
+		WorkspaceId: aws.String("ws-1"),
+		LimitsPerLabelSet: []*LimitsPerLabelSet{{
+			LabelSet: map[string]*string{"team": aws.String("a")},
+			Limits:   &LimitsPerLabelSetEntry{MaxSeries: aws.Int64(1000)},
+		}},
+		RetentionPeriodInDays: aws.Int64(30),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, WorkspaceConfigurationStatusCodeUpdating, aws.StringValue(out.Status.StatusCode))
+
+	assert.NotEmpty(t, body["clientToken"])
+	assert.Equal(t, float64(30), body["retentionPeriodInDays"])
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"labelSet": map[string]interface{}{"team": "a"},
+		"limits":   map[string]interface{}{"maxSeries": float64(1000)},
+	}}, body["limitsPerLabelSet"])
+}
+
+func TestClient_DescribeWorkspaceConfiguration(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/workspaces/ws-1/configuration", r.URL.Path)
+
+		w.Write([]byte(`{"workspaceConfiguration": {
+			"limitsPerLabelSet": [{"labelSet": {}, "limits": {"maxSeries": 10}}],
+			"retentionPeriodInDays": 90,
+			"status": {"statusCode": "UPDATE_FAILED", "statusReason": "invalid limits"}
+		}}`))
+	})
+
+	out, err := client.DescribeWorkspaceConfiguration(&DescribeWorkspaceConfigurationInput{WorkspaceId: aws.String("ws-1")})
+	require.NoError(t, err)
+	config := out.WorkspaceConfiguration
+	assert.Equal(t, int64(90), aws.Int64Value(config.RetentionPeriodInDays))
+	require.Len(t, config.LimitsPerLabelSet, 1)
+	assert.Empty(t, config.LimitsPerLabelSet[0].LabelSet)
+	assert.Equal(t, int64(10), aws.Int64Value(config.LimitsPerLabelSet[0].Limits.MaxSeries))
+	assert.Equal(t, WorkspaceConfigurationStatusCodeUpdateFailed, aws.StringValue(config.Status.StatusCode))
+	assert.Equal(t, "invalid limits", aws.StringValue(config.Status.StatusReason))
+}
+
+func TestClient_workspaceConfigurationErrors(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-Errortype", "ResourceNotFoundException")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "workspace not found"}`))
+	})
+
+	_, err := client.DescribeWorkspaceConfiguration(&DescribeWorkspaceConfigurationInput{WorkspaceId: aws.String("ws-1")})
+	assert.True(t, IsNotFound(err))
+
+	_, err = client.UpdateWorkspaceConfiguration(&UpdateWorkspaceConfigurationInput{})
+	assert.EqualError(t, err, "InvalidParameter: 1 validation error(s) found.\n- missing required field, UpdateWorkspaceConfigurationInput.WorkspaceId.\n")
+}
+
+func TestLimitsPerLabelSetsEqual(t *testing.T) {
+	limits := func(maxSeries int64, labels ...string) *LimitsPerLabelSet {
+		labelSet := map[string]*string{}
+		for i := 0; i+1 < len(labels); i += 2 {
+			labelSet[labels[i]] = aws.String(labels[i+1])
+		}
+		return &LimitsPerLabelSet{
+			LabelSet: labelSet,
+			Limits:   &LimitsPerLabelSetEntry{MaxSeries: aws.Int64(maxSeries)},
+		}
+	}
+
+	testCases := []struct {
+		name  string
+		a, b  []*LimitsPerLabelSet
+		equal bool
+	}{
+		{"empty", nil, []*LimitsPerLabelSet{}, true},
+		{"reordered", []*LimitsPerLabelSet{limits(1, "a", "1"), limits(2)}, []*LimitsPerLabelSet{limits(2), limits(1, "a", "1")}, true},
+		{"label order", []*LimitsPerLabelSet{limits(1, "a", "1", "b", "2")}, []*LimitsPerLabelSet{limits(1, "b", "2", "a", "1")}, true},
+		{"missing limit", []*LimitsPerLabelSet{{LabelSet: map[string]*string{}}}, []*LimitsPerLabelSet{limits(0)}, true},
+		{"changed limit", []*LimitsPerLabelSet{limits(1, "a", "1")}, []*LimitsPerLabelSet{limits(2, "a", "1")}, false},
+		{"changed label", []*LimitsPerLabelSet{limits(1, "a", "1")}, []*LimitsPerLabelSet{limits(1, "a", "2")}, false},
+		{"added entry", []*LimitsPerLabelSet{limits(1)}, []*LimitsPerLabelSet{limits(1), limits(1, "a", "1")}, false},
+		{"duplicate entry", []*LimitsPerLabelSet{limits(1), limits(1)}, []*LimitsPerLabelSet{limits(1)}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.equal, LimitsPerLabelSetsEqual(tc.a, tc.b))
+			assert.Equal(t, tc.equal, LimitsPerLabelSetsEqual(tc.b, tc.a))
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeStrict unmarshals YAML into out, failing on fields out doesn't
+// declare.
+func decodeStrict(data string, out interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewBufferString(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// yamlValue decodes a YAML document into plain maps, slices and scalars, so
+// documents that only differ in formatting or key order decode equal.
+func yamlValue(data string) (interface{}, error) {
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(data), &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// yamlValuesEqual compares decoded YAML documents. Null values and empty
+// collections are considered equal to missing ones.
+func yamlValuesEqual(a, b interface{}) bool {
+	return cmp.Equal(pruneEmpty(a), pruneEmpty(b), cmpopts.EquateEmpty())
+}
+
+// pruneEmpty drops the null and empty values from the mappings in value.
+func pruneEmpty(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		pruned := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			item = pruneEmpty(item)
+			if item == nil {
+				continue
+			}
+			pruned[key] = item
+		}
+		if len(pruned) == 0 {
+			return nil
+		}
+		return pruned
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		pruned := make([]interface{}, len(v))
+		for i, item := range v {
+			pruned[i] = pruneEmpty(item)
+		}
+		return pruned
+	}
+	return value
+}